@@ -0,0 +1,183 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuthBan is the failed authentication state of an IP
+type AuthBan struct {
+	IP          string     `json:"ip"`
+	Failures    int        `json:"failures"`
+	Bans        int        `json:"bans"`
+	LastFailure time.Time  `json:"last_failure"`
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+}
+
+// authGuard locks out IPs after repeated authentication failures. Every ban of the same IP doubles the ban duration,
+// until the IP stays without failures for the maximum ban duration.
+type authGuard struct {
+	maxFailures    int
+	failureWindow  time.Duration
+	banDuration    time.Duration
+	maxBanDuration time.Duration
+	// securityLog receives authentication failures and bans
+	securityLog *log.Logger
+
+	entries map[string]*AuthBan
+	mtx     sync.Mutex
+}
+
+func newAuthGuard(opts AuthGuardOptions, securityLog *log.Logger) *authGuard {
+	guard := &authGuard{
+		maxFailures:    opts.MaxFailures,
+		failureWindow:  opts.FailureWindow,
+		banDuration:    opts.BanDuration,
+		maxBanDuration: opts.MaxBanDuration,
+		securityLog:    securityLog,
+		entries:        make(map[string]*AuthBan),
+	}
+	if guard.maxFailures <= 0 {
+		guard.maxFailures = 5
+	}
+	if guard.failureWindow <= 0 {
+		guard.failureWindow = 10 * time.Minute
+	}
+	if guard.banDuration <= 0 {
+		guard.banDuration = time.Minute
+	}
+	if guard.maxBanDuration <= 0 {
+		guard.maxBanDuration = 24 * time.Hour
+	}
+	return guard
+}
+
+// bannedFor returns the remaining ban duration of the IP
+func (g *authGuard) bannedFor(ip string) time.Duration {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	entry, ok := g.entries[ip]
+	if !ok || entry.BannedUntil == nil {
+		return 0
+	}
+	if remaining := time.Until(*entry.BannedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// recordFailure counts a failed authentication and bans the IP once it reaches the maximum failures within the window
+func (g *authGuard) recordFailure(ip, reason string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	now := time.Now()
+	entry, ok := g.entries[ip]
+	if !ok {
+		entry = &AuthBan{IP: ip}
+		g.entries[ip] = entry
+	}
+	if now.Sub(entry.LastFailure) > g.failureWindow {
+		entry.Failures = 0
+	}
+	entry.Failures++
+	entry.LastFailure = now
+	g.securityLog.WithFields(log.Fields{"ip": ip, "failures": entry.Failures, "reason": reason}).Warn("authentication failed")
+
+	if entry.Failures < g.maxFailures {
+		return
+	}
+	duration := g.banDuration << entry.Bans
+	if duration > g.maxBanDuration || duration <= 0 {
+		duration = g.maxBanDuration
+	}
+	bannedUntil := now.Add(duration)
+	entry.Bans++
+	entry.Failures = 0
+	entry.BannedUntil = &bannedUntil
+	g.securityLog.WithFields(log.Fields{"ip": ip, "bans": entry.Bans, "duration": duration.String()}).Warn("ip banned")
+}
+
+// recordSuccess resets the failure count of the IP; previous bans still escalate the next one
+func (g *authGuard) recordSuccess(ip string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if entry, ok := g.entries[ip]; ok {
+		entry.Failures = 0
+	}
+}
+
+// list returns the state of all IPs with failures or bans
+func (g *authGuard) list() []AuthBan {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	bans := make([]AuthBan, 0, len(g.entries))
+	for _, entry := range g.entries {
+		bans = append(bans, *entry)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	return bans
+}
+
+// clear removes the state of the IP, or of all IPs if ip is empty; it returns false if the IP is unknown
+func (g *authGuard) clear(ip string) bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if len(ip) == 0 {
+		g.entries = make(map[string]*AuthBan)
+		return true
+	}
+	if _, ok := g.entries[ip]; !ok {
+		return false
+	}
+	delete(g.entries, ip)
+	return true
+}
+
+// expire forgets IPs which had no failures for the maximum ban duration
+func (g *authGuard) expire() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	now := time.Now()
+	for ip, entry := range g.entries {
+		if now.Sub(entry.LastFailure) > g.maxBanDuration && (entry.BannedUntil == nil || now.After(*entry.BannedUntil)) {
+			delete(g.entries, ip)
+		}
+	}
+}
+
+func adminGetBans(w http.ResponseWriter, r *http.Request) {
+	// 200 OK
+	w.WriteHeader(200)
+	if errEncode := json.NewEncoder(w).Encode(getRequestServer(r).authGuard.list()); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func adminClearBan(w http.ResponseWriter, r *http.Request) {
+	ip := chi.URLParam(r, "ip")
+	if !getRequestServer(r).authGuard.clear(ip) {
+		w.WriteHeader(404)
+		errorHTTPResponse(w, NOT_FOUND, ip)
+		return
+	}
+	getRequestServer(r).securityLog.WithFields(log.Fields{"ip": ip, "admin": getRequestSession(r).GetIdentity()}).Info("ban cleared")
+	// 204 No Content
+	w.WriteHeader(204)
+}
+
+func adminClearBans(w http.ResponseWriter, r *http.Request) {
+	getRequestServer(r).authGuard.clear("")
+	getRequestServer(r).securityLog.WithFields(log.Fields{"admin": getRequestSession(r).GetIdentity()}).Info("all bans cleared")
+	// 204 No Content
+	w.WriteHeader(204)
+}
@@ -0,0 +1,49 @@
+package apiserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthGuardLockout(t *testing.T) {
+	handler := newTestRequestHandler(NewDefaultKeystore("key"))
+	guard := handler.server.authGuard
+
+	// Stale session tokens don't count as failures
+	for i := 0; i < 2*guard.maxFailures; i++ {
+		if response := testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Session-Id": "stale"}); response.Code != 401 {
+			t.Fatalf("attempt %v: expected 401, got %v", i, response.Code)
+		}
+	}
+	if bannedFor := guard.bannedFor("192.0.2.1"); bannedFor != 0 {
+		t.Fatalf("expected stale session tokens not to lock out, got ban of %v", bannedFor)
+	}
+
+	for i := 0; i < guard.maxFailures; i++ {
+		if response := testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Api-Key": "wrong"}); response.Code != 400 {
+			t.Fatalf("attempt %v: expected 400, got %v", i, response.Code)
+		}
+	}
+	// Locked out, even with the correct key
+	response := testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Api-Key": "key"})
+	if response.Code != 429 || response.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected lockout, got %v (Retry-After %q)", response.Code, response.Header().Get("Retry-After"))
+	}
+
+	// The next ban doubles the duration
+	guard.entries["192.0.2.1"].BannedUntil = nil
+	for i := 0; i < guard.maxFailures; i++ {
+		guard.recordFailure("192.0.2.1", "test")
+	}
+	if bannedFor := guard.bannedFor("192.0.2.1"); bannedFor <= time.Minute || bannedFor > 2*time.Minute {
+		t.Errorf("expected doubled ban duration, got %v", bannedFor)
+	}
+
+	// Admins can clear bans
+	if !guard.clear("192.0.2.1") || guard.bannedFor("192.0.2.1") != 0 {
+		t.Error("expected ban to be cleared")
+	}
+	if response = testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Api-Key": "key"}); response.Code != 200 {
+		t.Errorf("expected request after clearing the ban to succeed, got %v", response.Code)
+	}
+}
@@ -0,0 +1,142 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/constants"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+// OptionsFromConfig reads the options of the launch command from the config and environment.
+// Loggers are left to the caller; the light clients of the networks have to be initialized before New.
+func OptionsFromConfig() (Options, error) {
+	// Load API keys; without a keystore file only DEFAULT_API_KEY is accepted
+	keystore := NewDefaultKeystore(viper.GetString("DEFAULT_API_KEY"))
+	if keystoreFile := viper.GetString("KEYSTORE_FILE"); len(keystoreFile) > 0 {
+		var errKeystore error
+		if keystore, errKeystore = LoadKeystore(keystoreFile); errKeystore != nil {
+			return Options{}, errKeystore
+		}
+	}
+
+	networks, errNetworks := validation.NewNetworks(validation.ConfigFromEnv())
+	if errNetworks != nil {
+		return Options{}, errNetworks
+	}
+
+	opts := Options{
+		Networks:               networks,
+		Keystore:               keystore,
+		KeystoreReloadInterval: configSeconds("KEYSTORE_RELOAD_INTERVAL"),
+		Sessions: SessionOptions{
+			TTL:                  configSeconds("SESSION_TTL"),
+			MaxLifetime:          configSeconds("SESSION_MAX_LIFETIME"),
+			DisableSlidingExpiry: !configBool("SESSION_SLIDING_EXPIRY", true),
+			DisableIdentityCheck: !configBool("VERIFY_SESSION_IDENTITY", true),
+			MaxPerIdentity:       viper.GetInt("SESSION_MAX_PER_IDENTITY"),
+			Secret:               viper.GetString("SESSION_SECRET"),
+		},
+		RateLimits: RateLimitOptions{
+			Key:          configRateLimit("RATE_LIMIT"),
+			IP:           configRateLimit("RATE_LIMIT_IP"),
+			Routes:       make(map[string]RateLimit),
+			DailyQuota:   viper.GetInt64("RATE_LIMIT_DAILY_QUOTA"),
+			MonthlyQuota: viper.GetInt64("RATE_LIMIT_MONTHLY_QUOTA"),
+			QuotaFile:    configString("RATE_LIMIT_QUOTA_FILE", "quotas.json"),
+		},
+		AuthGuard: AuthGuardOptions{
+			MaxFailures:    viper.GetInt("AUTH_MAX_FAILURES"),
+			FailureWindow:  configSeconds("AUTH_FAILURE_WINDOW"),
+			BanDuration:    configSeconds("AUTH_BAN_DURATION"),
+			MaxBanDuration: configSeconds("AUTH_MAX_BAN_DURATION"),
+		},
+		Siwe: SiweOptions{
+			Domain:        viper.GetString("SIWE_DOMAIN"),
+			Scheme:        viper.GetString("SIWE_SCHEME"),
+			DefaultScopes: splitScopes(viper.GetString("SIWE_DEFAULT_SCOPES")),
+		},
+		TLS: TLSOptions{
+			CertFile:       viper.GetString("TLS_CERT_FILE"),
+			KeyFile:        viper.GetString("TLS_KEY_FILE"),
+			ClientCAFile:   viper.GetString("TLS_CLIENT_CA_FILE"),
+			ClientAuth:     viper.GetString("TLS_CLIENT_AUTH"),
+			ReloadInterval: configSeconds("TLS_RELOAD_INTERVAL"),
+		},
+		SignatureMaxSkew: configSeconds("SIGNATURE_MAX_SKEW"),
+		TrustedProxies:   []string{viper.GetString("TRUSTED_PROXIES")},
+		IPRules: IPRules{
+			Allow: []string{viper.GetString("IP_ALLOWLIST")},
+			Deny:  []string{viper.GetString("IP_DENYLIST")},
+		},
+		Jobs: JobOptions{
+			Directory:         configString("JOBS_DIR", "jobs"),
+			MaxRunning:        viper.GetInt("JOBS_MAX_RUNNING"),
+			Workers:           viper.GetInt("JOBS_WORKERS"),
+			Retention:         configSeconds("JOBS_RETENTION"),
+			MaxSlots:          viper.GetUint64("JOBS_MAX_SLOTS"),
+			MaxQueuedPerOwner: viper.GetInt("JOBS_MAX_QUEUED_PER_OWNER"),
+		},
+		Metrics: MetricsOptions{
+			Listener: viper.GetString("METRICS_LISTENER"),
+		},
+		DrainTimeout:  configSeconds("SHUTDOWN_DRAIN_TIMEOUT"),
+		HandleSignals: true,
+	}
+	// RATE_LIMIT_<ROUTE>_RPS and RATE_LIMIT_<ROUTE>_BURST override the per identity limit of a route
+	for _, route := range rateLimitedRoutes {
+		if limit := configRateLimit("RATE_LIMIT_" + strings.ToUpper(route)); limit != (RateLimit{}) {
+			opts.RateLimits.Routes[route] = limit
+		}
+	}
+
+	// Listen on PORT unless the listeners are configured explicitly or passed by systemd socket activation
+	listenerConfig := viper.GetString("LISTENERS")
+	if len(listenerConfig) == 0 {
+		listenerConfig = systemdListenerConfig(len(opts.TLS.CertFile) > 0)
+	}
+	if len(listenerConfig) == 0 {
+		servicePort := viper.GetInt("PORT")
+		if servicePort < 1024 {
+			return Options{}, fmt.Errorf(constants.ErrConfigValue, "Port")
+		}
+		listenerConfig = fmt.Sprintf("tcp://:%v", servicePort)
+	}
+	opts.Listeners = strings.Split(listenerConfig, ",")
+
+	return opts, nil
+}
+
+// configSeconds reads a duration config value given in seconds; unset and invalid values select the default of the option
+func configSeconds(key string) time.Duration {
+	return time.Duration(viper.GetInt(key)) * time.Second
+}
+
+// configBool reads a boolean config value which defaults to fallback if it isn't set
+func configBool(key string, fallback bool) bool {
+	if !viper.IsSet(key) {
+		return fallback
+	}
+	return viper.GetBool(key)
+}
+
+// configString reads a string config value which defaults to fallback if it isn't set
+func configString(key string, fallback string) string {
+	if !viper.IsSet(key) {
+		return fallback
+	}
+	return viper.GetString(key)
+}
+
+// configRateLimit reads <prefix>_RPS and <prefix>_BURST; unset values select the default of the option
+func configRateLimit(prefix string) RateLimit {
+	return RateLimit{
+		RequestsPerSecond: viper.GetFloat64(prefix + "_RPS"),
+		Burst:             viper.GetInt(prefix + "_BURST"),
+	}
+}
@@ -0,0 +1,127 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+var errIPNotAllowed = errors.New("ip not allowed")
+
+// IPRules restricts the IPs requests are accepted from. Entries are IPv4 or IPv6 CIDRs or single IPs.
+// Denied IPs are always rejected; if the allowlist isn't empty, the IP must match one of its entries.
+type IPRules struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	// compiled is stored by the keystore when the rules are set or loaded, so requests don't parse them again
+	compiled *ipRuleSet
+}
+
+// ipRuleSet is the parsed form of IPRules
+type ipRuleSet struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// compile parses the rules; a nil IPRules results in an empty rule set which allows all IPs
+func (r *IPRules) compile() (*ipRuleSet, error) {
+	rules := &ipRuleSet{}
+	if r == nil {
+		return rules, nil
+	}
+	var errParse error
+	if rules.allow, errParse = parseCIDRList(strings.Join(r.Allow, ",")); errParse != nil {
+		return nil, errParse
+	}
+	if rules.deny, errParse = parseCIDRList(strings.Join(r.Deny, ",")); errParse != nil {
+		return nil, errParse
+	}
+	return rules, nil
+}
+
+// prepare compiles the rules and stores the result for ruleSet; it has to be called before the rules are shared
+func (r *IPRules) prepare() error {
+	compiled, errRules := r.compile()
+	if errRules != nil {
+		return errRules
+	}
+	if r != nil {
+		r.compiled = compiled
+	}
+	return nil
+}
+
+// ruleSet returns the compiled rules; rules which weren't prepared are compiled on every call
+func (r *IPRules) ruleSet() (*ipRuleSet, error) {
+	if r != nil && r.compiled != nil {
+		return r.compiled, nil
+	}
+	return r.compile()
+}
+
+// IsEmpty returns true if the rules don't restrict any IP
+func (r *IPRules) IsEmpty() bool {
+	return r == nil || (len(r.Allow) == 0 && len(r.Deny) == 0)
+}
+
+// allows returns true if the IP isn't denied and matches the allowlist, if there is one
+func (s *ipRuleSet) allows(ip net.IP) bool {
+	if s == nil {
+		return true
+	}
+	if containsIP(s.deny, ip) {
+		return false
+	}
+	return len(s.allow) == 0 || containsIP(s.allow, ip)
+}
+
+// checkIPRules checks the IP against the static rules of the server, the global rules of the keystore
+// and the rules of the API key, if the session was authenticated with one
+func (e *EthereumValidatorServer) checkIPRules(ip net.IP, apiKey *ApiKey) error {
+	if ip == nil {
+		return errIPNotAllowed
+	}
+	if !e.ipRules.allows(ip) || !e.keystore.allowsIP(ip, apiKey) {
+		return errIPNotAllowed
+	}
+	return nil
+}
+
+// watchFile calls onChange whenever the modification time or size of the file changes, until the context is done.
+// The file is polled, which also works for files replaced by a rename and on volumes without inotify support.
+func watchFile(ctx context.Context, path string, interval time.Duration, logger *log.Logger, onChange func()) {
+	var modTime time.Time
+	var size int64
+	if info, errStat := os.Stat(path); errStat == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, errStat := os.Stat(path)
+			if errStat != nil {
+				if !errors.Is(errStat, os.ErrNotExist) {
+					logger.Warnf("unable to watch file '%v': %v", path, errStat)
+				}
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			onChange()
+		}
+	}
+}
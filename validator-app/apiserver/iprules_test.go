@@ -0,0 +1,98 @@
+package apiserver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIPRules(t *testing.T) {
+	rules, errRules := (&IPRules{Allow: []string{"10.0.0.0/8", "2001:db8::/32"}, Deny: []string{"10.0.0.13"}}).compile()
+	if errRules != nil {
+		t.Fatal(errRules)
+	}
+	tests := map[string]bool{
+		"10.1.2.3":        true,
+		"10.0.0.13":       false,
+		"192.0.2.1":       false,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"::ffff:10.0.0.1": true,
+	}
+	for ip, expected := range tests {
+		if allowed := rules.allows(net.ParseIP(ip)); allowed != expected {
+			t.Errorf("%v: expected %v, got %v", ip, expected, allowed)
+		}
+	}
+
+	if _, errRules = (&IPRules{Deny: []string{"10.0.0.0/33"}}).compile(); errRules == nil {
+		t.Error("expected invalid CIDR to be rejected")
+	}
+}
+
+func TestKeyIPRulesReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	keystore, _ := LoadKeystore(path)
+	secret, key, _ := keystore.CreateKey("test", []string{ScopeAdmin}, nil)
+	if errSave := keystore.Save(); errSave != nil {
+		t.Fatal(errSave)
+	}
+	handler := newTestRequestHandler(keystore)
+
+	// Test requests come from 192.0.2.1
+	response := testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Api-Key": secret})
+	token := response.Header().Get("Validator-Session-Id")
+	if response.Code != 200 {
+		t.Fatalf("expected request without rules to succeed, got %v", response.Code)
+	}
+
+	// Restrict the key in the file, as the keys command does, and reload it like the file watcher
+	fileKeystore, _ := LoadKeystore(path)
+	if errSet := fileKeystore.SetIPRules(key.Id, &IPRules{Allow: []string{"198.51.100.0/24"}}); errSet != nil {
+		t.Fatal(errSet)
+	}
+	if errSave := fileKeystore.Save(); errSave != nil {
+		t.Fatal(errSave)
+	}
+	if errReload := keystore.Reload(); errReload != nil {
+		t.Fatal(errReload)
+	}
+
+	// Reloaded rules are compiled once, not on every request
+	if reloaded, _ := keystore.GetKey(key.Id); reloaded.IPRules == nil || reloaded.IPRules.compiled == nil {
+		t.Error("expected reloaded rules to be compiled")
+	}
+
+	// The existing session is checked against the new rules
+	response = testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Session-Id": token})
+	if response.Code != 403 || !strings.Contains(response.Body.String(), IP_NOT_ALLOWED) {
+		t.Fatalf("expected IP_NOT_ALLOWED, got %v %v", response.Code, response.Body.String())
+	}
+
+	// An invalid file keeps the previous rules
+	if errWrite := os.WriteFile(path, []byte(`{"keys": [], "ip_rules": {"deny": ["invalid"]}}`), 0600); errWrite != nil {
+		t.Fatal(errWrite)
+	}
+	if errReload := keystore.Reload(); errReload == nil {
+		t.Error("expected invalid keystore to be rejected")
+	}
+	if _, errKey := keystore.GetKey(key.Id); errKey != nil {
+		t.Errorf("expected previous keys to be kept, got %v", errKey)
+	}
+
+	// Global rules apply to all keys
+	_ = fileKeystore.SetIPRules(key.Id, nil)
+	_ = fileKeystore.SetIPRules("", &IPRules{Deny: []string{"192.0.2.0/24"}})
+	if errSave := fileKeystore.Save(); errSave != nil {
+		t.Fatal(errSave)
+	}
+	if errReload := keystore.Reload(); errReload != nil {
+		t.Fatal(errReload)
+	}
+	response = testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Api-Key": secret})
+	if response.Code != 403 {
+		t.Errorf("expected globally denied IP to be rejected, got %v", response.Code)
+	}
+}
@@ -0,0 +1,695 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/runtimeracer/ethereum-validator-go/export"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Job Kinds
+	JobKindExport  = "export"  // Writes the block rewards of the range to a file
+	JobKindSummary = "summary" // Sums up the block rewards of the range
+
+	// Job States
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+
+	// jobCheckpointInterval is the interval the progress of a running job is saved in
+	jobCheckpointInterval = time.Second
+)
+
+var (
+	errJobNotFound    = errors.New("job not found")
+	errJobFinished    = errors.New("job already finished")
+	errJobNotFinished = errors.New("job is not finished")
+	errTooManyJobs    = errors.New("too many unfinished jobs")
+)
+
+// JobOptions configure the asynchronous range jobs
+type JobOptions struct {
+	// Directory keeps the jobs and their results, so they survive a restart; the job API is disabled without it
+	Directory string
+	// MaxRunning limits the jobs computed at once; further jobs are queued. Defaults to 2.
+	MaxRunning int
+	// Workers compute the slots of a job concurrently; defaults to 4
+	Workers int
+	// Retention is the time finished jobs and their results are kept; defaults to 7 days
+	Retention time.Duration
+	// MaxSlots limits the range of a job; defaults to 1,000,000 slots, about 4.5 months on mainnet
+	MaxSlots uint64
+	// MaxQueuedPerOwner limits the queued and running jobs of an identity; defaults to 10
+	MaxQueuedPerOwner int
+}
+
+// JobRequest is the body of a job submission
+type JobRequest struct {
+	Kind  string       `json:"kind"`
+	Range export.Range `json:"range"`
+	// Format of export jobs; defaults to JSON Lines
+	Format string `json:"format,omitempty"`
+}
+
+// Job is a range computation which runs in the background
+type Job struct {
+	Id      string       `json:"id"`
+	Kind    string       `json:"kind"`
+	Owner   string       `json:"owner"`
+	Network string       `json:"network"`
+	Range   export.Range `json:"range"`
+	// FirstSlot and LastSlot are the resolved range; open ended date ranges end at the slot of the submission
+	FirstSlot uint64      `json:"first_slot"`
+	LastSlot  uint64      `json:"last_slot"`
+	Format    string      `json:"format,omitempty"`
+	Status    string      `json:"status"`
+	Progress  JobProgress `json:"progress"`
+	// Summary is the result of summary jobs; it holds the partial sums while the job runs
+	Summary *JobSummary `json:"summary,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	// Result is the location of the result once the job completed
+	Result     string     `json:"result,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobProgress counts the slots of a job; Rows is the number of blocks, which excludes missed slots
+type JobProgress struct {
+	Done  uint64 `json:"done"`
+	Total uint64 `json:"total"`
+	Rows  uint64 `json:"rows"`
+}
+
+// JobSummary sums up the block rewards of a range
+type JobSummary struct {
+	Blocks        uint64  `json:"blocks"`
+	Missed        uint64  `json:"missed"`
+	MEVBlocks     uint64  `json:"mev_blocks"`
+	RewardGwei    float64 `json:"reward_gwei"`
+	MEVRewardGwei float64 `json:"mev_reward_gwei"`
+}
+
+// isFinished returns true if the job won't run anymore
+func (j *Job) isFinished() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// copy returns a snapshot of the job which is safe to use while it runs
+func (j *Job) copy() *Job {
+	snapshot := *j
+	if j.Summary != nil {
+		summary := *j.Summary
+		snapshot.Summary = &summary
+	}
+	return &snapshot
+}
+
+// jobManager runs the submitted jobs with limited concurrency and keeps them in the job directory
+type jobManager struct {
+	directory  string
+	maxRunning int
+	workers    int
+	retention  time.Duration
+	maxSlots   uint64
+	maxQueued  int
+	validation ValidationService
+	metrics    *serverMetrics
+	logger     *log.Logger
+
+	jobs      map[string]*Job
+	cancels   map[string]context.CancelFunc // Running jobs
+	executing sync.WaitGroup
+	running   sync.WaitGroup // Held by run until it returned
+	wake      chan struct{}
+	mtx       sync.Mutex
+}
+
+// newJobManager loads the jobs of the directory; jobs which were running when the server stopped are queued again
+// and resume where they were interrupted. It returns nil if no directory is configured.
+func newJobManager(opts JobOptions, validationService ValidationService, metrics *serverMetrics, logger *log.Logger) (*jobManager, error) {
+	if len(opts.Directory) == 0 {
+		return nil, nil
+	}
+	if errDir := os.MkdirAll(opts.Directory, 0700); errDir != nil {
+		return nil, fmt.Errorf("unable to create job directory: %v", errDir)
+	}
+	manager := &jobManager{
+		directory:  opts.Directory,
+		maxRunning: opts.MaxRunning,
+		workers:    opts.Workers,
+		retention:  withDefaultDuration(opts.Retention, 7*24*time.Hour),
+		maxSlots:   opts.MaxSlots,
+		maxQueued:  opts.MaxQueuedPerOwner,
+		validation: validationService,
+		metrics:    metrics,
+		logger:     logger,
+		jobs:       make(map[string]*Job),
+		cancels:    make(map[string]context.CancelFunc),
+		wake:       make(chan struct{}, 1),
+	}
+	if manager.maxRunning <= 0 {
+		manager.maxRunning = 2
+	}
+	if manager.workers <= 0 {
+		manager.workers = 4
+	}
+	if manager.maxSlots == 0 {
+		manager.maxSlots = 1000000
+	}
+	if manager.maxQueued <= 0 {
+		manager.maxQueued = 10
+	}
+
+	paths, errGlob := filepath.Glob(filepath.Join(opts.Directory, "*.json"))
+	if errGlob != nil {
+		return nil, errGlob
+	}
+	for _, path := range paths {
+		content, errRead := os.ReadFile(path)
+		if errRead != nil {
+			return nil, errRead
+		}
+		job := &Job{}
+		if errDecode := json.Unmarshal(content, job); errDecode != nil {
+			return nil, fmt.Errorf("invalid job file %v: %v", path, errDecode)
+		}
+		if _, errId := uuid.Parse(job.Id); errId != nil || filepath.Base(path) != job.Id+".json" {
+			return nil, fmt.Errorf("invalid job file %v: id doesn't match", path)
+		}
+		if job.Status == JobRunning {
+			job.Status = JobQueued
+		}
+		manager.jobs[job.Id] = job
+	}
+	return manager, nil
+}
+
+// submit validates and queues a job. It returns errTooManyJobs if the owner has the maximum of unfinished jobs.
+func (m *jobManager) submit(owner string, network *validation.Network, request JobRequest) (*Job, error) {
+	switch request.Kind {
+	case JobKindExport:
+		if len(request.Format) == 0 {
+			request.Format = export.FormatJSONL
+		}
+		if !slices.Contains(export.Formats, request.Format) {
+			return nil, fmt.Errorf("unknown format %q; use one of %v", request.Format, strings.Join(export.Formats, ", "))
+		}
+	case JobKindSummary:
+		request.Format = ""
+	default:
+		return nil, fmt.Errorf("unknown job kind %q; use %v or %v", request.Kind, JobKindExport, JobKindSummary)
+	}
+	first, last, errRange := request.Range.Resolve(network)
+	if errRange != nil {
+		return nil, errRange
+	}
+	if last-first+1 > m.maxSlots {
+		return nil, fmt.Errorf("range of %v slots exceeds the maximum of %v slots", last-first+1, m.maxSlots)
+	}
+
+	job := &Job{
+		Id:        uuid.New().String(),
+		Kind:      request.Kind,
+		Owner:     owner,
+		Network:   network.Name,
+		Range:     request.Range,
+		FirstSlot: first,
+		LastSlot:  last,
+		Format:    request.Format,
+		Status:    JobQueued,
+		Progress:  JobProgress{Total: last - first + 1},
+		CreatedAt: time.Now().UTC(),
+	}
+	if job.Kind == JobKindSummary {
+		job.Summary = &JobSummary{}
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	unfinished := 0
+	for _, other := range m.jobs {
+		if other.Owner == owner && (other.Status == JobQueued || other.Status == JobRunning) {
+			unfinished++
+		}
+	}
+	if unfinished >= m.maxQueued {
+		return nil, fmt.Errorf("%w: %v jobs are queued or running", errTooManyJobs, unfinished)
+	}
+	if errSave := m.save(job); errSave != nil {
+		return nil, errSave
+	}
+	m.jobs[job.Id] = job
+	m.notify()
+	return job.copy(), nil
+}
+
+// get returns a snapshot of the job
+func (m *jobManager) get(id string) (*Job, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	return job.copy(), nil
+}
+
+// cancel stops a queued or running job; its partial results are removed once it stopped
+func (m *jobManager) cancel(id string) (*Job, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	if job.isFinished() {
+		return nil, errJobFinished
+	}
+	m.finish(job, JobCancelled, "")
+	if cancel, running := m.cancels[id]; running {
+		cancel()
+	} else {
+		m.removeFiles(job)
+	}
+	if errSave := m.save(job); errSave != nil {
+		return nil, errSave
+	}
+	return job.copy(), nil
+}
+
+// remove deletes a finished job and its result
+func (m *jobManager) remove(id string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return errJobNotFound
+	}
+	if !job.isFinished() {
+		return errJobNotFinished
+	}
+	delete(m.jobs, id)
+	m.removeFiles(job)
+	return os.Remove(m.jobPath(job.Id))
+}
+
+// start runs the job manager in the background until the context is done; wait blocks until it returned
+func (m *jobManager) start(ctx context.Context) {
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		m.run(ctx)
+	}()
+}
+
+func (m *jobManager) wait() {
+	m.running.Wait()
+}
+
+// run starts queued jobs in the order they were submitted and removes expired ones until the context is done.
+// Running jobs are interrupted with the context and resume on the next start.
+func (m *jobManager) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		m.startQueued(ctx)
+		select {
+		case <-ctx.Done():
+			// Running jobs are cancelled with the context; they record their progress before they end
+			m.executing.Wait()
+			return
+		case <-m.wake:
+		case <-ticker.C:
+			m.expire()
+		}
+	}
+}
+
+// notify wakes up run to start queued jobs
+func (m *jobManager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *jobManager) startQueued(ctx context.Context) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	queued := make([]*Job, 0)
+	for _, job := range m.jobs {
+		if job.Status == JobQueued {
+			queued = append(queued, job)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].CreatedAt.Before(queued[j].CreatedAt) })
+	for _, job := range queued {
+		if len(m.cancels) >= m.maxRunning {
+			return
+		}
+		network, errNetwork := m.validation.GetNetwork(job.Network)
+		if errNetwork == nil && !network.IsConfigured() {
+			errNetwork = fmt.Errorf("no backend configured for network %v", job.Network)
+		}
+		if errNetwork != nil {
+			m.finish(job, JobFailed, errNetwork.Error())
+			m.saveOrLog(job)
+			continue
+		}
+		jobCtx, cancel := context.WithCancel(ctx)
+		m.cancels[job.Id] = cancel
+		job.Status = JobRunning
+		if job.StartedAt == nil {
+			startedAt := time.Now().UTC()
+			job.StartedAt = &startedAt
+		}
+		m.saveOrLog(job)
+		m.logger.Infof("Starting %v job '%v' for %v slots %v-%v", job.Kind, job.Id, job.Network, job.FirstSlot, job.LastSlot)
+		m.executing.Add(1)
+		go m.execute(jobCtx, job, network)
+	}
+}
+
+// execute computes a job and records its result
+func (m *jobManager) execute(ctx context.Context, job *Job, network *validation.Network) {
+	defer m.executing.Done()
+	var errJob error
+	if job.Kind == JobKindExport {
+		errJob = m.executeExport(ctx, job, network)
+	} else {
+		errJob = m.executeSummary(ctx, job, network)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.cancels[job.Id]()
+	delete(m.cancels, job.Id)
+	defer m.notify()
+	switch {
+	case job.Status == JobCancelled:
+		// Cancelled while running
+		m.removeFiles(job)
+		m.logger.Infof("Cancelled job '%v'", job.Id)
+		return
+	case errJob == nil:
+		m.finish(job, JobCompleted, "")
+		job.Result = "/jobs/" + job.Id + "/result"
+		m.logger.Infof("Completed job '%v'", job.Id)
+	case ctx.Err() != nil:
+		// The server stopped; the job resumes on the next start
+		job.Status = JobQueued
+	default:
+		m.finish(job, JobFailed, errJob.Error())
+		m.logger.Errorf("job '%v' failed: %v", job.Id, errJob)
+	}
+	m.saveOrLog(job)
+}
+
+// executeExport writes the rows of the range to the result file; the export resumes from its own progress file
+func (m *jobManager) executeExport(ctx context.Context, job *Job, network *validation.Network) error {
+	lastCheckpoint := time.Now()
+	return export.ToFile(ctx, export.FileOptions{
+		Network:      network,
+		First:        job.FirstSlot,
+		Last:         job.LastSlot,
+		Format:       job.Format,
+		Path:         m.resultPath(job),
+		Workers:      m.workers,
+		BlockRewards: m.validation.ForEachBlockReward,
+		Progress: func(progress export.Progress) {
+			m.metrics.processedSlot(network.Name, job.FirstSlot+progress.Done-1)
+			m.mtx.Lock()
+			defer m.mtx.Unlock()
+			job.Progress = JobProgress{Done: progress.Done, Total: progress.Total, Rows: progress.Rows}
+			if time.Since(lastCheckpoint) >= jobCheckpointInterval {
+				lastCheckpoint = time.Now()
+				m.saveOrLog(job)
+			}
+		},
+	})
+}
+
+// executeSummary sums up the block rewards of the range; the partial sums are saved with the job, so it resumes after
+// the last slot saved
+func (m *jobManager) executeSummary(ctx context.Context, job *Job, network *validation.Network) error {
+	m.mtx.Lock()
+	from := job.FirstSlot + job.Progress.Done
+	m.mtx.Unlock()
+	if from > job.LastSlot {
+		return nil
+	}
+	lastCheckpoint := time.Now()
+	errRange := m.validation.ForEachBlockReward(ctx, network, from, job.LastSlot, m.workers, func(slot uint64, reward *validation.BlockRewardSlot) error {
+		m.metrics.processedSlot(network.Name, slot)
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		if reward == nil {
+			job.Summary.Missed++
+		} else {
+			job.Summary.Blocks++
+			job.Summary.RewardGwei += reward.Reward
+			if reward.Status == validation.BlockStatusMEV {
+				job.Summary.MEVBlocks++
+				job.Summary.MEVRewardGwei += reward.Reward
+			}
+		}
+		job.Progress.Done = slot - job.FirstSlot + 1
+		job.Progress.Rows = job.Summary.Blocks
+		if time.Since(lastCheckpoint) >= jobCheckpointInterval {
+			lastCheckpoint = time.Now()
+			m.saveOrLog(job)
+		}
+		return nil
+	})
+	return errRange
+}
+
+// expire removes jobs which finished before the retention time
+func (m *jobManager) expire() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for id, job := range m.jobs {
+		if job.FinishedAt == nil || time.Since(*job.FinishedAt) < m.retention {
+			continue
+		}
+		delete(m.jobs, id)
+		m.removeFiles(job)
+		if errRemove := os.Remove(m.jobPath(id)); errRemove != nil && !errors.Is(errRemove, os.ErrNotExist) {
+			m.logger.Warnf("failed to remove expired job '%v': %v", id, errRemove)
+		}
+	}
+}
+
+// finish records the final state of a job; the caller holds the lock
+func (m *jobManager) finish(job *Job, status, message string) {
+	finishedAt := time.Now().UTC()
+	job.Status = status
+	job.Error = message
+	job.FinishedAt = &finishedAt
+}
+
+func (m *jobManager) jobPath(id string) string {
+	return filepath.Join(m.directory, id+".json")
+}
+
+// resultPath returns the file export jobs write to; summary jobs keep their result in the job file
+func (m *jobManager) resultPath(job *Job) string {
+	return filepath.Join(m.directory, job.Id+"."+job.Format)
+}
+
+// removeFiles removes the result of a job and what an unfinished export left behind; the caller holds the lock
+func (m *jobManager) removeFiles(job *Job) {
+	if job.Kind != JobKindExport {
+		return
+	}
+	matches, _ := filepath.Glob(m.resultPath(job) + "*")
+	for _, path := range matches {
+		if errRemove := os.Remove(path); errRemove != nil {
+			m.logger.Warnf("failed to remove '%v' of job '%v': %v", path, job.Id, errRemove)
+		}
+	}
+}
+
+// save replaces the job file atomically; the caller holds the lock
+func (m *jobManager) save(job *Job) error {
+	content, errEncode := json.Marshal(job)
+	if errEncode != nil {
+		return errEncode
+	}
+	tmpPath := m.jobPath(job.Id) + ".tmp"
+	if errWrite := os.WriteFile(tmpPath, content, 0600); errWrite != nil {
+		return errWrite
+	}
+	return os.Rename(tmpPath, m.jobPath(job.Id))
+}
+
+// saveOrLog saves a job whose state changed in the background; a failure only loses progress since the last save
+func (m *jobManager) saveOrLog(job *Job) {
+	if errSave := m.save(job); errSave != nil {
+		m.logger.Errorf("failed to save job '%v': %v", job.Id, errSave)
+	}
+}
+
+// requireJobs answers like an undefined route if the job API is disabled
+func requireJobs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getRequestServer(r).jobs == nil {
+			w.WriteHeader(400)
+			errorHTTPResponse(w, INVALID_ROUTE, "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getRequestJob returns the job of the route if the session owns it or has the admin scope; it writes the error response otherwise
+func getRequestJob(w http.ResponseWriter, r *http.Request) (*Job, bool) {
+	job, errJob := getRequestServer(r).jobs.get(chi.URLParam(r, "id"))
+	session := getRequestSession(r)
+	if errJob != nil || (job.Owner != session.GetIdentity() && !session.HasScope(ScopeAdmin)) {
+		// Jobs of others aren't revealed
+		w.WriteHeader(404)
+		errorHTTPResponse(w, NOT_FOUND, errJobNotFound.Error())
+		return nil, false
+	}
+	return job, true
+}
+
+func jobSubmit(w http.ResponseWriter, r *http.Request) {
+	server := getRequestServer(r)
+	request := JobRequest{}
+	if errDecode := json.NewDecoder(r.Body).Decode(&request); errDecode != nil {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, "invalid job request")
+		return
+	}
+	job, errSubmit := server.jobs.submit(getRequestSession(r).GetIdentity(), getRequestNetwork(r), request)
+	if errors.Is(errSubmit, errTooManyJobs) {
+		w.WriteHeader(429)
+		errorHTTPResponse(w, TOO_MANY_JOBS, errSubmit.Error())
+		return
+	}
+	if errSubmit != nil {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, errSubmit.Error())
+		return
+	}
+	server.logger.Infof("Queued %v job '%v' of '%v'", job.Kind, job.Id, job.Owner)
+	// 202 Accepted
+	w.Header().Set("Location", "/jobs/"+job.Id)
+	w.WriteHeader(202)
+	if errEncode := json.NewEncoder(w).Encode(job); errEncode != nil {
+		server.logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func jobGet(w http.ResponseWriter, r *http.Request) {
+	job, ok := getRequestJob(w, r)
+	if !ok {
+		return
+	}
+	// 200 OK
+	w.WriteHeader(200)
+	if errEncode := json.NewEncoder(w).Encode(job); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func jobGetResult(w http.ResponseWriter, r *http.Request) {
+	job, ok := getRequestJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != JobCompleted {
+		w.WriteHeader(409)
+		errorHTTPResponse(w, JOB_NOT_COMPLETED, job.Status)
+		return
+	}
+	if job.Kind == JobKindSummary {
+		// 200 OK
+		w.WriteHeader(200)
+		if errEncode := json.NewEncoder(w).Encode(job.Summary); errEncode != nil {
+			getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+		}
+		return
+	}
+
+	server := getRequestServer(r)
+	file, errOpen := os.Open(server.jobs.resultPath(job))
+	if errOpen != nil {
+		server.logger.Errorf("failed to open result of job '%v': %v", job.Id, errOpen)
+		w.WriteHeader(500)
+		errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
+		return
+	}
+	defer file.Close()
+	switch job.Format {
+	case export.FormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case export.FormatJSONL:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.Id+"."+job.Format))
+	http.ServeContent(w, r, "", *job.FinishedAt, file)
+}
+
+// jobDelete cancels a queued or running job, or removes a finished one with its result
+func jobDelete(w http.ResponseWriter, r *http.Request) {
+	job, ok := getRequestJob(w, r)
+	if !ok {
+		return
+	}
+	server := getRequestServer(r)
+	if job.isFinished() {
+		if errRemove := server.jobs.remove(job.Id); errRemove != nil && !errors.Is(errRemove, errJobNotFound) {
+			server.logger.Errorf("failed to remove job '%v': %v", job.Id, errRemove)
+		}
+		// 204 No Content
+		w.WriteHeader(204)
+		return
+	}
+
+	cancelled, errCancel := server.jobs.cancel(job.Id)
+	if errors.Is(errCancel, errJobFinished) {
+		// Finished in the meantime
+		w.WriteHeader(409)
+		errorHTTPResponse(w, JOB_FINISHED, job.Id)
+		return
+	} else if errCancel != nil {
+		server.logger.Errorf("failed to cancel job '%v': %v", job.Id, errCancel)
+		w.WriteHeader(500)
+		errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
+		return
+	}
+	server.logger.Infof("Cancelling job '%v' on behalf of '%v'", job.Id, getRequestSession(r).GetIdentity())
+	// 200 OK
+	w.WriteHeader(200)
+	if errEncode := json.NewEncoder(w).Encode(cancelled); errEncode != nil {
+		server.logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
@@ -0,0 +1,235 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ForEachBlockReward passes blocks for even slots and missed odd slots
+func (s *testValidationService) ForEachBlockReward(ctx context.Context, network *validation.Network, from, to uint64, workers int, fn func(slot uint64, reward *validation.BlockRewardSlot) error) error {
+	for slot := from; slot <= to; slot++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.slotDelay):
+		}
+		var reward *validation.BlockRewardSlot
+		if slot%2 == 0 {
+			reward = &validation.BlockRewardSlot{Slot: slot, Status: validation.BlockStatusMEV, Reward: 42}
+		}
+		if errFn := fn(slot, reward); errFn != nil {
+			return errFn
+		}
+	}
+	return nil
+}
+
+func newTestJobServer(t *testing.T, service *testValidationService, jobs JobOptions) *EthereumValidatorServer {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	keystore := NewDefaultKeystore("key")
+	keystore.Keys = append(keystore.Keys, &ApiKey{Id: "reader", Hash: HashApiKeySecret("reader"), Scopes: []string{ScopeReadBlockReward}, Enabled: true})
+	server, errNew := New(Options{Logger: logger, Validation: service, Keystore: keystore, Jobs: jobs})
+	if errNew != nil {
+		t.Fatal(errNew)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// Jobs write to the directory until they stopped, which has to happen before it's removed
+	t.Cleanup(func() {
+		cancel()
+		if server.jobs != nil {
+			server.jobs.wait()
+		}
+	})
+	go server.RunMaintenance(ctx)
+	return server
+}
+
+// waitForJob polls the job until it has the status
+func waitForJob(t *testing.T, handler http.Handler, id, key, status string) *Job {
+	job := &Job{}
+	for i := 0; i < 200; i++ {
+		response := testRequest(handler, "GET", "/jobs/"+id, "", map[string]string{"Validator-Api-Key": key})
+		if errDecode := json.NewDecoder(response.Body).Decode(job); errDecode != nil || response.Code != 200 {
+			t.Fatalf("expected job, got %v: %v", response.Code, errDecode)
+		}
+		if job.Status == status {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected job to become %v, got %+v", status, job)
+	return nil
+}
+
+func submitTestJob(t *testing.T, handler http.Handler, key, body string) *Job {
+	response := testRequest(handler, "POST", "/jobs?network=testnet", body, map[string]string{"Validator-Api-Key": key})
+	job := &Job{}
+	if errDecode := json.NewDecoder(response.Body).Decode(job); errDecode != nil || response.Code != 202 {
+		t.Fatalf("expected job to be accepted, got %v: %v", response.Code, errDecode)
+	}
+	if location := response.Header().Get("Location"); location != "/jobs/"+job.Id {
+		t.Errorf("expected location of the job, got %q", location)
+	}
+	return job
+}
+
+func TestJobs(t *testing.T) {
+	service := &testValidationService{network: &validation.Network{Name: "testnet", BackendEndpoint: "http://backend", SecondsPerSlot: 12, SlotsPerEpoch: 32}}
+	server := newTestJobServer(t, service, JobOptions{Directory: t.TempDir()})
+
+	// Summaries are returned as JSON
+	job := submitTestJob(t, server, "reader", `{"kind":"summary","range":{"slots":"10-19"}}`)
+	if job.Status != JobQueued || job.FirstSlot != 10 || job.LastSlot != 19 || job.Progress.Total != 10 {
+		t.Errorf("unexpected job %+v", job)
+	}
+	job = waitForJob(t, server, job.Id, "reader", JobCompleted)
+	if job.Result != "/jobs/"+job.Id+"/result" || job.Progress.Done != 10 || job.Progress.Rows != 5 {
+		t.Errorf("unexpected completed job %+v", job)
+	}
+	response := testRequest(server, "GET", job.Result, "", map[string]string{"Validator-Api-Key": "reader"})
+	summary := &JobSummary{}
+	if errDecode := json.NewDecoder(response.Body).Decode(summary); errDecode != nil || response.Code != 200 {
+		t.Fatalf("expected summary, got %v: %v", response.Code, errDecode)
+	}
+	if *summary != (JobSummary{Blocks: 5, Missed: 5, MEVBlocks: 5, RewardGwei: 210, MEVRewardGwei: 210}) {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	// Exports are served as file
+	exportJob := submitTestJob(t, server, "reader", `{"kind":"export","range":{"slots":"10-19"},"format":"csv"}`)
+	waitForJob(t, server, exportJob.Id, "reader", JobCompleted)
+	response = testRequest(server, "GET", "/jobs/"+exportJob.Id+"/result", "", map[string]string{"Validator-Api-Key": "reader"})
+	if lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n"); response.Code != 200 || len(lines) != 6 || response.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("expected CSV with header and 5 rows, got %v: %q", response.Code, response.Body.String())
+	}
+
+	// Jobs are only visible to their owner and admins
+	if response = testRequest(server, "GET", "/jobs/"+job.Id, "", map[string]string{"Validator-Api-Key": "key"}); response.Code != 200 {
+		t.Errorf("expected admin to see the job, got %v", response.Code)
+	}
+	other := submitTestJob(t, server, "key", `{"kind":"summary","range":{"slots":"1"}}`)
+	if response = testRequest(server, "GET", "/jobs/"+other.Id, "", map[string]string{"Validator-Api-Key": "reader"}); response.Code != 404 {
+		t.Errorf("expected job of another identity to be hidden, got %v", response.Code)
+	}
+
+	// Finished jobs are removed with their result
+	if response = testRequest(server, "DELETE", "/jobs/"+exportJob.Id, "", map[string]string{"Validator-Api-Key": "reader"}); response.Code != 204 {
+		t.Errorf("expected finished job to be removed, got %v", response.Code)
+	}
+	if response = testRequest(server, "GET", "/jobs/"+exportJob.Id, "", map[string]string{"Validator-Api-Key": "reader"}); response.Code != 404 {
+		t.Errorf("expected removed job to be gone, got %v", response.Code)
+	}
+
+	// Invalid jobs are rejected
+	for _, body := range []string{`{"kind":"reindex","range":{"slots":"1"}}`, `{"kind":"export","range":{"slots":"1"},"format":"xml"}`, `{"kind":"summary","range":{}}`, `{`} {
+		if response = testRequest(server, "POST", "/jobs", body, map[string]string{"Validator-Api-Key": "reader"}); response.Code != 400 {
+			t.Errorf("expected %v to be rejected, got %v", body, response.Code)
+		}
+	}
+}
+
+func TestJobsConcurrencyAndCancel(t *testing.T) {
+	service := &testValidationService{network: &validation.Network{Name: "testnet", BackendEndpoint: "http://backend", SecondsPerSlot: 12, SlotsPerEpoch: 32}, slotDelay: 10 * time.Millisecond}
+	server := newTestJobServer(t, service, JobOptions{Directory: t.TempDir(), MaxRunning: 1})
+
+	first := submitTestJob(t, server, "reader", `{"kind":"export","range":{"slots":"0-999"}}`)
+	second := submitTestJob(t, server, "reader", `{"kind":"summary","range":{"slots":"0-3"}}`)
+	waitForJob(t, server, first.Id, "reader", JobRunning)
+	if job := waitForJob(t, server, second.Id, "reader", JobQueued); job.StartedAt != nil {
+		t.Errorf("expected second job to wait for the first, got %+v", job)
+	}
+	response := testRequest(server, "GET", "/jobs/"+first.Id+"/result", "", map[string]string{"Validator-Api-Key": "reader"})
+	if response.Code != 409 {
+		t.Errorf("expected result of running job to be unavailable, got %v", response.Code)
+	}
+
+	response = testRequest(server, "DELETE", "/jobs/"+first.Id, "", map[string]string{"Validator-Api-Key": "reader"})
+	cancelled := &Job{}
+	if errDecode := json.NewDecoder(response.Body).Decode(cancelled); errDecode != nil || response.Code != 200 || cancelled.Status != JobCancelled {
+		t.Fatalf("expected job to be cancelled, got %v: %+v", response.Code, cancelled)
+	}
+	waitForJob(t, server, second.Id, "reader", JobCompleted)
+	if response = testRequest(server, "DELETE", "/jobs/"+second.Id, "", map[string]string{"Validator-Api-Key": "reader"}); response.Code != 204 {
+		t.Errorf("expected completed job to be removed, got %v", response.Code)
+	}
+}
+
+func TestJobsResume(t *testing.T) {
+	directory := t.TempDir()
+	service := &testValidationService{network: &validation.Network{Name: "testnet", BackendEndpoint: "http://backend", SecondsPerSlot: 12, SlotsPerEpoch: 32}}
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	// A summary interrupted after slot 3
+	interrupted := &Job{
+		Id:        uuid.New().String(),
+		Kind:      JobKindSummary,
+		Owner:     "key:reader",
+		Network:   "testnet",
+		FirstSlot: 0,
+		LastSlot:  9,
+		Status:    JobRunning,
+		Progress:  JobProgress{Done: 4, Total: 10, Rows: 2},
+		Summary:   &JobSummary{Blocks: 2, Missed: 2, MEVBlocks: 2, RewardGwei: 84, MEVRewardGwei: 84},
+	}
+	stopped := &jobManager{directory: directory, logger: logger}
+	if errSave := stopped.save(interrupted); errSave != nil {
+		t.Fatal(errSave)
+	}
+
+	manager, errManager := newJobManager(JobOptions{Directory: directory}, service, newServerMetrics(&EthereumValidatorServer{}), logger)
+	if errManager != nil {
+		t.Fatal(errManager)
+	}
+	if job, _ := manager.get(interrupted.Id); job.Status != JobQueued {
+		t.Fatalf("expected interrupted job to be queued, got %+v", job)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer manager.wait()
+	defer cancel()
+	manager.start(ctx)
+	for i := 0; i < 200; i++ {
+		if job, _ := manager.get(interrupted.Id); job.Status == JobCompleted {
+			if *job.Summary != (JobSummary{Blocks: 5, Missed: 5, MEVBlocks: 5, RewardGwei: 210, MEVRewardGwei: 210}) || job.Progress.Done != 10 {
+				t.Errorf("expected job to resume after slot 3, got %+v", job.Summary)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected resumed job to complete")
+}
+
+func TestJobsLimits(t *testing.T) {
+	service := &testValidationService{network: &validation.Network{Name: "testnet", BackendEndpoint: "http://backend", SecondsPerSlot: 12, SlotsPerEpoch: 32}, slotDelay: 10 * time.Millisecond}
+	server := newTestJobServer(t, service, JobOptions{Directory: t.TempDir(), MaxSlots: 100, MaxQueuedPerOwner: 1})
+
+	// Ranges are limited
+	if response := testRequest(server, "POST", "/jobs", `{"kind":"summary","range":{"slots":"0-100"}}`, map[string]string{"Validator-Api-Key": "reader"}); response.Code != 400 {
+		t.Errorf("expected range above the maximum to be rejected, got %v", response.Code)
+	}
+
+	// Unfinished jobs are limited per owner
+	first := submitTestJob(t, server, "reader", `{"kind":"summary","range":{"slots":"0-99"}}`)
+	response := testRequest(server, "POST", "/jobs", `{"kind":"summary","range":{"slots":"0"}}`, map[string]string{"Validator-Api-Key": "reader"})
+	if response.Code != 429 || !strings.Contains(response.Body.String(), TOO_MANY_JOBS) {
+		t.Errorf("expected second unfinished job to be rejected, got %v: %v", response.Code, response.Body.String())
+	}
+	other := submitTestJob(t, server, "key", `{"kind":"summary","range":{"slots":"0"}}`)
+
+	// Finished jobs don't count
+	if response = testRequest(server, "DELETE", "/jobs/"+first.Id, "", map[string]string{"Validator-Api-Key": "reader"}); response.Code != 200 {
+		t.Fatalf("expected job to be cancelled, got %v", response.Code)
+	}
+	submitTestJob(t, server, "reader", `{"kind":"summary","range":{"slots":"0"}}`)
+	waitForJob(t, server, other.Id, "key", JobCompleted)
+}
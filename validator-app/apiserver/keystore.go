@@ -0,0 +1,561 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// API Key Scopes
+	ScopeReadBlockReward = "read:blockreward"
+	ScopeReadSyncDuties  = "read:syncduties"
+	ScopeAdmin           = "admin" // Grants all scopes
+
+	// defaultApiKeyId is the id of the key derived from DEFAULT_API_KEY if no keystore file is configured
+	defaultApiKeyId = "default"
+)
+
+var (
+	// KnownScopes lists all scopes which can be granted to API keys
+	KnownScopes = []string{ScopeReadBlockReward, ScopeReadSyncDuties, ScopeAdmin}
+
+	errInvalidApiKey  = errors.New("invalid api key")
+	errApiKeyDisabled = errors.New("api key disabled")
+	errApiKeyExpired  = errors.New("api key expired")
+	// Keys created before request signing was added have no public signing key; rotating them adds one
+	errNoSigningKey = errors.New("key has no signing key; rotate it")
+
+	errCertificateNotMapped = errors.New("client certificate not mapped to an api key")
+
+	errAddressNotAllowed = errors.New("address not allowed")
+	errAddressDisabled   = errors.New("address disabled")
+	errAddressExpired    = errors.New("address access expired")
+)
+
+// ApiKey is an entry of the keystore. Only the hash of the secret and the public signing key are stored,
+// neither of which allows to authenticate or sign requests.
+type ApiKey struct {
+	Id    string `json:"id"`
+	Label string `json:"label"`
+	Hash  string `json:"hash"`
+	// Hex encoded ed25519 public key derived from the secret, which verifies signed requests
+	SigningKey string     `json:"signing_key,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	Enabled    bool       `json:"enabled"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Limits     *KeyLimits `json:"limits,omitempty"`
+	IPRules    *IPRules   `json:"ip_rules,omitempty"`
+	// Subjects or SANs of client certificates which authenticate as this key
+	CertNames []string `json:"cert_names,omitempty"`
+}
+
+// AddressRule grants scopes to an Ethereum address signing in with Sign-In with Ethereum
+type AddressRule struct {
+	Address   string     `json:"address"`
+	Label     string     `json:"label"`
+	Scopes    []string   `json:"scopes"`
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Keystore holds the API keys and address rules accepted by the server, and the IP rules applying to all sessions
+type Keystore struct {
+	path      string
+	Keys      []*ApiKey      `json:"keys"`
+	Addresses []*AddressRule `json:"addresses,omitempty"`
+	IPRules   *IPRules       `json:"ip_rules,omitempty"`
+	mtx       sync.RWMutex
+}
+
+// HashApiKeySecret returns the hex encoded SHA-256 hash of the secret.
+// Secrets are random tokens with full entropy, so a fast hash is sufficient.
+func HashApiKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// apiKeySigningKey derives the ed25519 key which signs requests from the secret. The seed is hashed with a prefix,
+// so it can't be computed from the stored hash of the secret.
+func apiKeySigningKey(secret string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("ethval-request-signing:" + secret))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// apiKeyVerifyingKey returns the hex encoded public key of the signing key derived from the secret
+func apiKeyVerifyingKey(secret string) string {
+	return hex.EncodeToString(apiKeySigningKey(secret).Public().(ed25519.PublicKey))
+}
+
+// LoadKeystore reads the keystore file at the given path; a missing file results in an empty keystore
+func LoadKeystore(path string) (*Keystore, error) {
+	keystore := &Keystore{
+		path: path,
+		Keys: make([]*ApiKey, 0),
+	}
+	content, errRead := os.ReadFile(path)
+	if errors.Is(errRead, os.ErrNotExist) {
+		return keystore, nil
+	} else if errRead != nil {
+		return nil, fmt.Errorf("unable to read keystore: %v", errRead)
+	}
+	if errDecode := json.Unmarshal(content, keystore); errDecode != nil {
+		return nil, fmt.Errorf("unable to decode keystore: %v", errDecode)
+	}
+	if errRules := keystore.validateIPRules(); errRules != nil {
+		return nil, errRules
+	}
+	return keystore, nil
+}
+
+// Reload replaces the keys and rules with the current content of the keystore file.
+// If the file can't be read or is invalid, the previous state is kept.
+func (k *Keystore) Reload() error {
+	if len(k.path) == 0 {
+		return errors.New("keystore has no file")
+	}
+	loaded, errLoad := LoadKeystore(k.path)
+	if errLoad != nil {
+		return errLoad
+	}
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.Keys = loaded.Keys
+	k.Addresses = loaded.Addresses
+	k.IPRules = loaded.IPRules
+	return nil
+}
+
+// GetPath returns the file the keystore is loaded from; it's empty for the in-memory default keystore
+func (k *Keystore) GetPath() string {
+	return k.path
+}
+
+// NewDefaultKeystore returns an in-memory keystore containing only the given secret with admin scope
+func NewDefaultKeystore(secret string) *Keystore {
+	return &Keystore{
+		Keys: []*ApiKey{{
+			Id:         defaultApiKeyId,
+			Label:      "DEFAULT_API_KEY",
+			Hash:       HashApiKeySecret(secret),
+			SigningKey: apiKeyVerifyingKey(secret),
+			Scopes:     []string{ScopeAdmin},
+			Enabled:    true,
+		}},
+	}
+}
+
+// Save writes the keystore back to its file
+func (k *Keystore) Save() error {
+	if len(k.path) == 0 {
+		return errors.New("keystore has no file")
+	}
+	k.mtx.RLock()
+	content, errEncode := json.MarshalIndent(k, "", "  ")
+	k.mtx.RUnlock()
+	if errEncode != nil {
+		return fmt.Errorf("unable to encode keystore: %v", errEncode)
+	}
+	// Write to a temporary file first so a crash can't leave a truncated keystore behind
+	tmpPath := k.path + ".tmp"
+	if errWrite := os.WriteFile(tmpPath, content, 0600); errWrite != nil {
+		return fmt.Errorf("unable to write keystore: %v", errWrite)
+	}
+	return os.Rename(tmpPath, k.path)
+}
+
+// Authenticate returns the key matching the secret, if it's enabled and not expired.
+// All keys are compared in constant time to avoid leaking information through timing.
+func (k *Keystore) Authenticate(secret string) (*ApiKey, error) {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+
+	hash := []byte(HashApiKeySecret(secret))
+	var match *ApiKey
+	for _, key := range k.Keys {
+		if subtle.ConstantTimeCompare(hash, []byte(key.Hash)) == 1 {
+			match = key
+		}
+	}
+	return checkApiKey(match)
+}
+
+// AuthenticateCertificate returns the key the subject or one of the SANs of the verified client certificate is mapped to
+func (k *Keystore) AuthenticateCertificate(certificate *x509.Certificate) (*ApiKey, error) {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	names := certificateNames(certificate)
+	for _, key := range k.Keys {
+		for _, certName := range key.CertNames {
+			for _, name := range names {
+				if certName == name {
+					return checkApiKey(key)
+				}
+			}
+		}
+	}
+	return nil, errCertificateNotMapped
+}
+
+// GetKey returns the key with the given id, if it's enabled and not expired
+func (k *Keystore) GetKey(id string) (*ApiKey, error) {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	return checkApiKey(k.findKey(id))
+}
+
+// VerifySignature returns the key with the given id if the payload was signed with it and the key is enabled and not expired.
+// Signatures are verified with the public signing key; keys created before request signing have none until they're rotated.
+func (k *Keystore) VerifySignature(id string, payload, signature []byte) (*ApiKey, error) {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	key, errKey := checkApiKey(k.findKey(id))
+	if errKey != nil {
+		return nil, errKey
+	}
+	if !key.HasSigningKey() {
+		return nil, fmt.Errorf("%v: %w", errInvalidSignature, errNoSigningKey)
+	}
+	publicKey, _ := hex.DecodeString(key.SigningKey)
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return nil, errInvalidSignature
+	}
+	return key, nil
+}
+
+// CreateKey adds a new enabled key to the keystore and returns its secret, which isn't stored anywhere
+func (k *Keystore) CreateKey(label string, scopes []string, expiresAt *time.Time) (string, *ApiKey, error) {
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return "", nil, fmt.Errorf("unknown scope: %v", scope)
+		}
+	}
+	secret, errSecret := generateApiKeySecret()
+	if errSecret != nil {
+		return "", nil, errSecret
+	}
+	key := &ApiKey{
+		Id:         uuid.New().String(),
+		Label:      label,
+		Hash:       HashApiKeySecret(secret),
+		SigningKey: apiKeyVerifyingKey(secret),
+		Scopes:     scopes,
+		Enabled:    true,
+		CreatedAt:  time.Now().UTC(),
+		ExpiresAt:  expiresAt,
+	}
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	k.Keys = append(k.Keys, key)
+	return secret, key, nil
+}
+
+// RevokeKey disables the key with the given id; the entry is kept for reference
+func (k *Keystore) RevokeKey(id string) error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	key := k.findKey(id)
+	if key == nil {
+		return fmt.Errorf("api key not found: %v", id)
+	}
+	key.Enabled = false
+	return nil
+}
+
+// RotateKey replaces the secret of the key with the given id and returns the new secret
+func (k *Keystore) RotateKey(id string) (string, error) {
+	secret, errSecret := generateApiKeySecret()
+	if errSecret != nil {
+		return "", errSecret
+	}
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	key := k.findKey(id)
+	if key == nil {
+		return "", fmt.Errorf("api key not found: %v", id)
+	}
+	key.Hash = HashApiKeySecret(secret)
+	key.SigningKey = apiKeyVerifyingKey(secret)
+	return secret, nil
+}
+
+// SetKeyLimits replaces the rate limits and quotas of the key with the given id; nil restores the defaults
+func (k *Keystore) SetKeyLimits(id string, limits *KeyLimits) error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	key := k.findKey(id)
+	if key == nil {
+		return fmt.Errorf("api key not found: %v", id)
+	}
+	key.Limits = limits
+	return nil
+}
+
+// SetIPRules replaces the IP rules of the key with the given id, or the global rules if id is empty; nil removes them
+func (k *Keystore) SetIPRules(id string, rules *IPRules) error {
+	if errRules := rules.prepare(); errRules != nil {
+		return errRules
+	}
+	if rules.IsEmpty() {
+		rules = nil
+	}
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if len(id) == 0 {
+		k.IPRules = rules
+		return nil
+	}
+	key := k.findKey(id)
+	if key == nil {
+		return fmt.Errorf("api key not found: %v", id)
+	}
+	key.IPRules = rules
+	return nil
+}
+
+// SetCertNames replaces the client certificate subjects and SANs which authenticate as the key with the given id
+func (k *Keystore) SetCertNames(id string, names []string) error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	key := k.findKey(id)
+	if key == nil {
+		return fmt.Errorf("api key not found: %v", id)
+	}
+	for _, name := range names {
+		for _, other := range k.Keys {
+			if other != key && hasString(other.CertNames, name) {
+				return fmt.Errorf("certificate name %v is already mapped to api key %v", name, other.Id)
+			}
+		}
+	}
+	key.CertNames = names
+	return nil
+}
+
+// GetIPRules returns the global IP rules
+func (k *Keystore) GetIPRules() *IPRules {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	return k.IPRules
+}
+
+// allowsIP checks the IP against the global rules and the rules of the key, if any.
+// Rules are validated and compiled when they're set or loaded, so invalid entries can only be rejected here.
+func (k *Keystore) allowsIP(ip net.IP, apiKey *ApiKey) bool {
+	k.mtx.RLock()
+	globalRules := k.IPRules
+	k.mtx.RUnlock()
+	for _, rules := range []*IPRules{globalRules, keyIPRules(apiKey)} {
+		compiled, errRules := rules.ruleSet()
+		if errRules != nil || !compiled.allows(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateIPRules compiles the IP rules of a loaded keystore before it's used
+func (k *Keystore) validateIPRules() error {
+	if errRules := k.IPRules.prepare(); errRules != nil {
+		return fmt.Errorf("invalid global ip rules: %v", errRules)
+	}
+	for _, key := range k.Keys {
+		if errRules := key.IPRules.prepare(); errRules != nil {
+			return fmt.Errorf("invalid ip rules of api key %v: %v", key.Id, errRules)
+		}
+	}
+	return nil
+}
+
+func keyIPRules(apiKey *ApiKey) *IPRules {
+	if apiKey == nil {
+		return nil
+	}
+	return apiKey.IPRules
+}
+
+// ListKeys returns a snapshot of all keys
+func (k *Keystore) ListKeys() []ApiKey {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	keys := make([]ApiKey, len(k.Keys))
+	for i, key := range k.Keys {
+		keys[i] = *key
+	}
+	return keys
+}
+
+// GetAddressRule returns the rule of the address, if it's enabled and not expired
+func (k *Keystore) GetAddressRule(address string) (*AddressRule, error) {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	rule := k.findAddressRule(address)
+	if rule == nil {
+		return nil, errAddressNotAllowed
+	}
+	if !rule.Enabled {
+		return nil, errAddressDisabled
+	}
+	if rule.ExpiresAt != nil && time.Now().After(*rule.ExpiresAt) {
+		return nil, errAddressExpired
+	}
+	return rule, nil
+}
+
+// SetAddressRule creates or replaces the rule of the address
+func (k *Keystore) SetAddressRule(address, label string, scopes []string, expiresAt *time.Time) (*AddressRule, error) {
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("invalid address: %v", address)
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("unknown scope: %v", scope)
+		}
+	}
+	rule := &AddressRule{
+		Address:   common.HexToAddress(address).Hex(),
+		Label:     label,
+		Scopes:    scopes,
+		Enabled:   true,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if existing := k.findAddressRule(address); existing != nil {
+		*existing = *rule
+		return existing, nil
+	}
+	k.Addresses = append(k.Addresses, rule)
+	return rule, nil
+}
+
+// RemoveAddressRule deletes the rule of the address
+func (k *Keystore) RemoveAddressRule(address string) error {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	for i, rule := range k.Addresses {
+		if strings.EqualFold(rule.Address, address) {
+			k.Addresses = append(k.Addresses[:i], k.Addresses[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("address rule not found: %v", address)
+}
+
+// ListAddressRules returns a snapshot of all address rules
+func (k *Keystore) ListAddressRules() []AddressRule {
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	rules := make([]AddressRule, len(k.Addresses))
+	for i, rule := range k.Addresses {
+		rules[i] = *rule
+	}
+	return rules
+}
+
+func (k *Keystore) findAddressRule(address string) *AddressRule {
+	for _, rule := range k.Addresses {
+		if strings.EqualFold(rule.Address, address) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (k *Keystore) findKey(id string) *ApiKey {
+	for _, key := range k.Keys {
+		if key.Id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// checkApiKey returns the key if it exists, is enabled and not expired
+func checkApiKey(key *ApiKey) (*ApiKey, error) {
+	if key == nil {
+		return nil, errInvalidApiKey
+	}
+	if !key.Enabled {
+		return nil, errApiKeyDisabled
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, errApiKeyExpired
+	}
+	return key, nil
+}
+
+func generateApiKeySecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, errRandom := rand.Read(secret); errRandom != nil {
+		return "", fmt.Errorf("unable to generate api key: %v", errRandom)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope returns true if the key grants the scope
+func (a *ApiKey) HasScope(scope string) bool {
+	return hasScope(a.Scopes, scope)
+}
+
+// HasSigningKey returns true if the key can sign requests; keys created before request signing need to be rotated first
+func (a *ApiKey) HasSigningKey() bool {
+	publicKey, errDecode := hex.DecodeString(a.SigningKey)
+	return errDecode == nil && len(publicKey) == ed25519.PublicKeySize
+}
+
+// HasScope returns true if the rule grants the scope
+func (a *AddressRule) HasScope(scope string) bool {
+	return hasScope(a.Scopes, scope)
+}
+
+func hasString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
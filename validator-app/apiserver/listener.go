@@ -0,0 +1,192 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Listener auth policies
+const (
+	AuthRequired = "required" // Requests need a session, an API key, a signature or a client certificate
+	AuthNone     = "none"     // Requests are trusted; they act as the configured key or with all scopes if there is none
+)
+
+// Listener is an address the server accepts connections on, with its own auth policy
+type Listener struct {
+	Network string      // tcp, unix or systemd
+	Address string      // Bind address of tcp listeners, path of unix sockets or name of sockets passed by systemd
+	Auth    string      // Auth policy
+	KeyId   string      // Key the requests of a trusted listener act as; empty grants all scopes
+	TLS     bool        // Serve TLS; requires a configured certificate
+	Mode    os.FileMode // Permissions of unix sockets; 0 keeps the default
+}
+
+// String returns the listener in the format it's configured in
+func (l *Listener) String() string {
+	return fmt.Sprintf("%v://%v", l.Network, l.Address)
+}
+
+// parseListeners parses a comma separated list of listener URLs:
+//
+//	tcp://<host>:<port>?auth=required|none&key=<id>&tls=true|false
+//	unix://<path>?auth=required|none&key=<id>&mode=0660
+//	systemd://<FileDescriptorName>?auth=required|none&key=<id>&tls=true|false
+//
+// tcp and systemd listeners serve TLS if a certificate is configured, unix sockets don't unless tls=true is set.
+func parseListeners(value string, tlsEnabled bool) ([]*Listener, error) {
+	listeners := make([]*Listener, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		listenerURL, errParse := url.Parse(entry)
+		if errParse != nil {
+			return nil, fmt.Errorf("invalid listener %v: %v", entry, errParse)
+		}
+		query := listenerURL.Query()
+		listener := &Listener{
+			Network: listenerURL.Scheme,
+			Address: listenerURL.Host + listenerURL.Path,
+			Auth:    query.Get("auth"),
+			KeyId:   query.Get("key"),
+		}
+		switch listener.Network {
+		case "tcp", "systemd":
+			listener.TLS = tlsEnabled
+		case "unix":
+			if mode := query.Get("mode"); len(mode) > 0 {
+				parsedMode, errMode := strconv.ParseUint(mode, 8, 32)
+				if errMode != nil {
+					return nil, fmt.Errorf("invalid mode of listener %v: %v", entry, mode)
+				}
+				listener.Mode = os.FileMode(parsedMode)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported network of listener %v: %v", entry, listener.Network)
+		}
+		if len(listener.Address) == 0 {
+			return nil, fmt.Errorf("listener %v has no address", entry)
+		}
+		if useTLS := query.Get("tls"); len(useTLS) > 0 {
+			var errTLS error
+			if listener.TLS, errTLS = strconv.ParseBool(useTLS); errTLS != nil {
+				return nil, fmt.Errorf("invalid tls option of listener %v: %v", entry, useTLS)
+			}
+		}
+		if listener.TLS && !tlsEnabled {
+			return nil, fmt.Errorf("listener %v requires a TLS certificate", entry)
+		}
+		switch listener.Auth {
+		case "":
+			listener.Auth = AuthRequired
+		case AuthRequired, AuthNone:
+		default:
+			return nil, fmt.Errorf("unknown auth policy of listener %v: %v", entry, listener.Auth)
+		}
+		if len(listener.KeyId) > 0 && listener.Auth != AuthNone {
+			return nil, fmt.Errorf("listener %v can only act as a key with auth=none", entry)
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("no listeners configured")
+	}
+	return listeners, nil
+}
+
+// listen binds the listener or takes the socket passed by systemd; stale unix sockets of a previous process are removed first
+func (l *Listener) listen(tlsCerts *tlsProvider) (net.Listener, error) {
+	if l.Network == "unix" {
+		if info, errStat := os.Stat(l.Address); errStat == nil && info.Mode()&os.ModeSocket != 0 {
+			if errRemove := os.Remove(l.Address); errRemove != nil {
+				return nil, fmt.Errorf("unable to remove stale socket %v: %v", l.Address, errRemove)
+			}
+		}
+	}
+	var netListener net.Listener
+	var errListen error
+	if l.Network == "systemd" {
+		netListener, errListen = takeSystemdListener(l.Address)
+	} else {
+		netListener, errListen = net.Listen(l.Network, l.Address)
+	}
+	if errListen != nil {
+		return nil, fmt.Errorf("failed to listen on %v: %v", l, errListen)
+	}
+	if l.Network == "unix" && l.Mode != 0 {
+		if errChmod := os.Chmod(l.Address, l.Mode); errChmod != nil {
+			netListener.Close()
+			return nil, fmt.Errorf("unable to set mode of socket %v: %v", l.Address, errChmod)
+		}
+	}
+	netListener = &policyListener{Listener: netListener, config: l}
+	if l.TLS {
+		netListener = tls.NewListener(netListener, tlsCerts.config())
+	}
+	return netListener, nil
+}
+
+// policyListener tags its connections with the listener they were accepted on
+type policyListener struct {
+	net.Listener
+	config *Listener
+}
+
+type policyConn struct {
+	net.Conn
+	config *Listener
+}
+
+func (l *policyListener) Accept() (net.Conn, error) {
+	conn, errAccept := l.Listener.Accept()
+	if errAccept != nil {
+		return nil, errAccept
+	}
+	return &policyConn{Conn: conn, config: l.config}, nil
+}
+
+// listenerConnContext stores the listener of the connection in the context of its requests
+func listenerConnContext(ctx context.Context, conn net.Conn) context.Context {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tagged, ok := conn.(*policyConn); ok {
+		return context.WithValue(ctx, listenerContextKey, tagged.config)
+	}
+	return ctx
+}
+
+// getRequestListener returns the listener the request was received on; requests of unknown listeners require auth
+func getRequestListener(r *http.Request) *Listener {
+	if listener, ok := r.Context().Value(listenerContextKey).(*Listener); ok {
+		return listener
+	}
+	return &Listener{Auth: AuthRequired}
+}
+
+// initTrustedSession returns a session for a request of a trusted listener; it's not stored and can't be resumed
+func (e *EthereumValidatorServer) initTrustedSession(listener *Listener) (*EthereumValidatorHTTPSessionHandler, error) {
+	sessionHandler := &EthereumValidatorHTTPSessionHandler{server: e, trustedListener: listener.String()}
+	if len(listener.KeyId) > 0 {
+		apiKey, errKey := e.keystore.GetKey(listener.KeyId)
+		if errKey != nil {
+			e.logger.Errorf("key %v of listener %v is not usable: %v", listener.KeyId, listener, errKey)
+			return nil, errKey
+		}
+		sessionHandler.apiKey = apiKey
+	}
+	return sessionHandler, nil
+}
@@ -0,0 +1,65 @@
+package apiserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseListeners(t *testing.T) {
+	listeners, errParse := parseListeners("tcp://127.0.0.1:8080, unix:///run/ethval.sock?auth=none&mode=0660", false)
+	if errParse != nil {
+		t.Fatal(errParse)
+	}
+	if len(listeners) != 2 || listeners[0].Address != "127.0.0.1:8080" || listeners[0].Auth != AuthRequired {
+		t.Fatalf("unexpected tcp listener %+v", listeners[0])
+	}
+	if listeners[1].Network != "unix" || listeners[1].Address != "/run/ethval.sock" || listeners[1].Auth != AuthNone || listeners[1].Mode != 0660 {
+		t.Fatalf("unexpected unix listener %+v", listeners[1])
+	}
+
+	for _, invalid := range []string{"", "udp://:53", "tcp://:8080?auth=maybe", "tcp://:8080?tls=true", "tcp://:8080?key=abc", "unix://"} {
+		if _, errParse = parseListeners(invalid, false); errParse == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestListenerAuthPolicy(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "ethval.sock")
+	listeners, errParse := parseListeners("tcp://127.0.0.1:0,unix://"+socketPath+"?auth=none", false)
+	if errParse != nil {
+		t.Fatal(errParse)
+	}
+	handler := newTestRequestHandler(NewDefaultKeystore("key"))
+	testServer := handler.server
+	testServer.listeners = listeners
+	testServer.inlineServer = http.Server{Handler: handler, ConnContext: listenerConnContext}
+	if errComms := testServer.OpenComms(); errComms != nil {
+		t.Fatal(errComms)
+	}
+	defer testServer.inlineServer.Close()
+
+	unixClient := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+	}}}
+	response, errRequest := unixClient.Get("http://unix/time/slot/0")
+	if errRequest != nil {
+		t.Fatal(errRequest)
+	}
+	response.Body.Close()
+	if response.StatusCode != 200 {
+		t.Errorf("expected trusted unix socket to skip auth, got %v", response.StatusCode)
+	}
+
+	// Bind errors are returned instead of serving on a nil listener
+	occupied, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer occupied.Close()
+	other := newTestRequestHandler(NewDefaultKeystore("key")).server
+	other.listeners, _ = parseListeners("tcp://"+occupied.Addr().String(), false)
+	if errComms := other.OpenComms(); errComms == nil {
+		t.Error("expected bind error to be reported")
+	}
+}
@@ -0,0 +1,177 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metricsNamespace prefixes the names of all metrics
+const metricsNamespace = "ethval"
+
+// MetricsOptions configure the Prometheus metrics; they're served on /metrics to sessions with admin scope
+type MetricsOptions struct {
+	// Listener additionally serves /metrics without authentication on a separate address, e.g. tcp://127.0.0.1:9100.
+	// It serves no other routes.
+	Listener string
+}
+
+var (
+	// Backend requests are made by the validation package for all servers of the process, so their metrics are shared
+	backendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "backend_request_duration_seconds",
+		Help:      "Latency of backend requests by backend, endpoint and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "endpoint", "method"})
+	backendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "backend_errors_total",
+		Help:      "Failed backend requests by backend, endpoint and method.",
+	}, []string{"backend", "endpoint", "method"})
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups of the validation package by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+	backendObserverOnce sync.Once
+)
+
+// serverMetrics holds the metrics of a server in its own registry, so several servers can run in one process
+type serverMetrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	latestSlot      *prometheus.GaugeVec
+
+	latestSlots map[string]uint64
+	mtx         sync.Mutex
+}
+
+// newServerMetrics registers the metrics of the server; the session count is read on every scrape
+func newServerMetrics(server *EthereumValidatorServer) *serverMetrics {
+	backendObserverOnce.Do(func() {
+		validation.SetBackendObserver(observeBackendCall)
+		validation.SetCacheObserver(observeCacheLookup)
+	})
+	metrics := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Handled requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		latestSlot: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "latest_processed_slot",
+			Help:      "Highest slot whose block reward or sync duties were computed, by network.",
+		}, []string{"network"}),
+		latestSlots: make(map[string]uint64),
+	}
+	activeSessions := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_sessions",
+		Help:      "Sessions which haven't expired or logged out.",
+	}, func() float64 {
+		server.connMtx.RLock()
+		defer server.connMtx.RUnlock()
+		return float64(len(server.activeHTTPSessions))
+	})
+	metrics.registry.MustRegister(
+		metrics.requests,
+		metrics.requestDuration,
+		metrics.latestSlot,
+		activeSessions,
+		backendDuration,
+		backendErrors,
+		cacheLookups,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return metrics
+}
+
+// observeBackendCall records a backend request of the validation package
+func observeBackendCall(call validation.BackendCall) {
+	backendDuration.WithLabelValues(call.Backend, call.Endpoint, call.Method).Observe(call.Duration.Seconds())
+	if call.Err != nil {
+		backendErrors.WithLabelValues(call.Backend, call.Endpoint, call.Method).Inc()
+	}
+}
+
+// observeCacheLookup counts a cache lookup of the validation package
+func observeCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// processedSlot records a computed slot; the gauge only moves forward, since ranges and lookups of old slots are common
+func (m *serverMetrics) processedSlot(network string, slot uint64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if latest, ok := m.latestSlots[network]; ok && latest >= slot {
+		return
+	}
+	m.latestSlots[network] = slot
+	m.latestSlot.WithLabelValues(network).Set(float64(slot))
+}
+
+// handler serves the metrics in the Prometheus exposition format
+func (m *serverMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// MetricsHandler serves the metrics of the server without authentication, for embedders exposing them on their own
+func (e *EthereumValidatorServer) MetricsHandler() http.Handler {
+	return e.metrics.handler()
+}
+
+// observeRequests counts requests and their latency by route pattern, so path parameters don't create new series.
+// Requests rejected before routing, e.g. failed authentications, are counted with the route "unrouted".
+func (e *EthereumValidatorServer) observeRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		// The router fills in the route context it finds in the request
+		routeContext := chi.NewRouteContext()
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+		wrapped := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(wrapped, r)
+
+		route := routeContext.RoutePattern()
+		if len(route) == 0 {
+			route = "unrouted"
+		}
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := []string{route, r.Method, strconv.Itoa(status)}
+		e.metrics.requests.WithLabelValues(labels...).Inc()
+		e.metrics.requestDuration.WithLabelValues(labels...).Observe(time.Since(started).Seconds())
+	})
+}
+
+func metricsGet(w http.ResponseWriter, r *http.Request) {
+	getRequestServer(r).metrics.handler().ServeHTTP(w, r)
+}
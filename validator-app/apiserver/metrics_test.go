@@ -0,0 +1,102 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	service := &testValidationService{network: &validation.Network{Name: "testnet", BackendEndpoint: "http://backend", SecondsPerSlot: 12, SlotsPerEpoch: 32}}
+	server := newTestJobServer(t, service, JobOptions{})
+	// Backend and cache metrics are shared by all servers of the process
+	backendErrors.Reset()
+	cacheLookups.Reset()
+
+	testRequest(server, "GET", "/testnet/blockreward/7", "", map[string]string{"Validator-Api-Key": "reader"})
+	testRequest(server, "GET", "/testnet/blockreward/5", "", map[string]string{"Validator-Api-Key": "reader"})
+	testRequest(server, "GET", "/testnet/blockreward/5", "", map[string]string{"Validator-Api-Key": "wrong"})
+	observeBackendCall(validation.BackendCall{Backend: validation.BackendBeacon, Endpoint: "/eth/v2/beacon/blocks/{id}", Method: "GET", Duration: time.Second, Err: errors.New("timeout")})
+	observeCacheLookup(validation.CacheVerifiedExecutionBlocks, true)
+
+	if response := testRequest(server, "GET", "/metrics", "", map[string]string{"Validator-Api-Key": "reader"}); response.Code != 403 {
+		t.Errorf("expected metrics to require admin scope, got %v", response.Code)
+	}
+	response := testRequest(server, "GET", "/metrics", "", map[string]string{"Validator-Api-Key": "key"})
+	if response.Code != 200 {
+		t.Fatalf("expected metrics, got %v", response.Code)
+	}
+	for _, expected := range []string{
+		`ethval_http_requests_total{method="GET",route="/{network}/blockreward/{slot}",status="200"} 2`,
+		`ethval_http_requests_total{method="GET",route="unrouted",status="400"} 1`,
+		`ethval_http_request_duration_seconds_count{method="GET",route="/{network}/blockreward/{slot}",status="200"} 2`,
+		`ethval_latest_processed_slot{network="testnet"} 7`,
+		// Requests with the same API key from the same IP share a session; one for each of the two keys
+		`ethval_active_sessions 2`,
+		`ethval_backend_errors_total{backend="beacon",endpoint="/eth/v2/beacon/blocks/{id}",method="GET"} 1`,
+		`ethval_cache_lookups_total{cache="verified_execution_blocks",result="hit"} 1`,
+	} {
+		if !strings.Contains(response.Body.String(), expected) {
+			t.Errorf("expected metrics to contain %v, got:\n%v", expected, response.Body.String())
+		}
+	}
+}
+
+func TestMetricsListener(t *testing.T) {
+	addresses := make([]string, 0, 2)
+	for i := 0; i < 2; i++ {
+		free, errListen := net.Listen("tcp", "127.0.0.1:0")
+		if errListen != nil {
+			t.Fatal(errListen)
+		}
+		addresses = append(addresses, free.Addr().String())
+		free.Close()
+	}
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	server, errNew := New(Options{
+		Logger:    logger,
+		Keystore:  NewDefaultKeystore("key"),
+		Listeners: []string{"tcp://" + addresses[0]},
+		Metrics:   MetricsOptions{Listener: "tcp://" + addresses[1]},
+	})
+	if errNew != nil {
+		t.Fatal(errNew)
+	}
+	result := make(chan error, 1)
+	go func() { result <- server.Start(context.Background()) }()
+	for i := 0; i < 100 && !server.isServingRequests.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Metrics don't need authentication on their own listener, which serves nothing else
+	response, errGet := http.Get("http://" + addresses[1] + "/metrics")
+	if errGet != nil {
+		t.Fatal(errGet)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != 200 || !strings.Contains(string(body), "ethval_active_sessions") {
+		t.Errorf("expected metrics, got %v: %s", response.StatusCode, body)
+	}
+	if response, errGet = http.Get("http://" + addresses[1] + "/time/slot/1"); errGet != nil || response.StatusCode != 404 {
+		t.Errorf("expected metrics listener to serve only metrics, got %v (%v)", response.StatusCode, errGet)
+	}
+	if response, errGet = http.Get("http://" + addresses[0] + "/metrics"); errGet != nil || response.StatusCode == 200 {
+		t.Errorf("expected metrics to require authentication on the API listeners, got %v (%v)", response.StatusCode, errGet)
+	}
+
+	if errStop := server.Stop(context.Background()); errStop != nil {
+		t.Fatal(errStop)
+	}
+	if errStart := <-result; errStart != nil {
+		t.Error(errStart)
+	}
+}
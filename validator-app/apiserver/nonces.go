@@ -0,0 +1,64 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"sync"
+	"time"
+)
+
+// nonceStore keeps single use values handed out to clients until they're consumed or expire
+type nonceStore struct {
+	entries map[string]time.Time
+	ttl     time.Duration
+	mtx     sync.Mutex
+}
+
+func newNonceStore(ttl time.Duration) *nonceStore {
+	return &nonceStore{
+		entries: make(map[string]time.Time),
+		ttl:     ttl,
+	}
+}
+
+// add registers the nonce and returns the time it expires
+func (s *nonceStore) add(nonce string) time.Time {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	expiresAt := time.Now().Add(s.ttl)
+	s.entries[nonce] = expiresAt
+	return expiresAt
+}
+
+// consume returns true if the nonce was issued and not used yet
+func (s *nonceStore) consume(nonce string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	expiresAt, ok := s.entries[nonce]
+	delete(s.entries, nonce)
+	return ok && time.Now().Before(expiresAt)
+}
+
+// use registers the nonce and returns false if it's already known
+func (s *nonceStore) use(nonce string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if expiresAt, ok := s.entries[nonce]; ok && time.Now().Before(expiresAt) {
+		return false
+	}
+	s.entries[nonce] = time.Now().Add(s.ttl)
+	return true
+}
+
+func (s *nonceStore) expire() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := time.Now()
+	for nonce, expiresAt := range s.entries {
+		if now.After(expiresAt) {
+			delete(s.entries, nonce)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Options configure a server created with New. Zero values select the defaults noted on the fields.
+type Options struct {
+	// Logger receives the server and request logs; defaults to the standard logrus logger
+	Logger *log.Logger
+	// SecurityLogger receives authentication failures and bans; defaults to Logger
+	SecurityLogger *log.Logger
+	// Validation provides the data of the validation routes; defaults to a service backed by Networks
+	Validation ValidationService
+	// Networks are the networks of the default validation service, see validation.NewNetworks; defaults to the networks
+	// configured by the environment. Configured light clients have to be initialized before the server is created.
+	Networks *validation.Networks
+	// Routes registers additional routes. They require authentication like the built-in ones; RequestSession returns the session.
+	Routes func(router chi.Router)
+
+	// Keystore holds the accepted API keys and address rules; defaults to an empty keystore, which only admits trusted listeners
+	Keystore *Keystore
+	// KeystoreReloadInterval is the interval a keystore file is checked for changes in; defaults to 5s
+	KeystoreReloadInterval time.Duration
+
+	Sessions   SessionOptions
+	RateLimits RateLimitOptions
+	AuthGuard  AuthGuardOptions
+	Siwe       SiweOptions
+	TLS        TLSOptions
+	Jobs       JobOptions
+	Metrics    MetricsOptions
+
+	// SignatureMaxSkew is the clock skew accepted for signed requests and sign-in messages in both directions; defaults to 5m
+	SignatureMaxSkew time.Duration
+	// TrustedProxies are the IPs or CIDRs whose forwarded headers are evaluated
+	TrustedProxies []string
+	// IPRules apply to all requests, in addition to the global and per key rules of the keystore
+	IPRules IPRules
+
+	// Listeners are the listener URLs served by Start, see parseListeners. They aren't needed if the server is only used as http.Handler.
+	Listeners []string
+	// DrainTimeout is the time in-flight requests get to complete on shutdown; defaults to 30s
+	DrainTimeout time.Duration
+	// HandleSignals makes Start stop the server on SIGINT or SIGTERM. Embedders usually handle signals themselves.
+	HandleSignals bool
+}
+
+// SessionOptions configure the sessions created on authentication
+type SessionOptions struct {
+	// TTL is the time a session stays valid without requests; defaults to 15m
+	TTL time.Duration
+	// MaxLifetime limits the sliding expiry of a session; defaults to 24h
+	MaxLifetime time.Duration
+	// DisableSlidingExpiry keeps the expiry of a session fixed instead of extending it on every request
+	DisableSlidingExpiry bool
+	// DisableIdentityCheck allows sessions to be resumed from other IPs than the one they were created from
+	DisableIdentityCheck bool
+	// MaxPerIdentity limits the sessions of an API key, address or validator; creating another one ends the
+	// oldest. Defaults to 16.
+	MaxPerIdentity int
+	// Secret signs the session tokens; instances sharing it accept each other's sessions, which also survive a
+	// restart. A logout only ends the session on the instance handling it. Defaults to a random secret per process.
+	Secret string
+}
+
+// RateLimitOptions configure the default limits; API keys may override them
+type RateLimitOptions struct {
+	// Key limits every identity; defaults to 10 requests per second with a burst of 20
+	Key RateLimit
+	// IP limits every client IP; defaults to 20 requests per second with a burst of 40
+	IP RateLimit
+	// Routes override the identity limit per route; routes without an entry use Key
+	Routes map[string]RateLimit
+	// DailyQuota and MonthlyQuota limit the requests of an identity; 0 is unlimited
+	DailyQuota   int64
+	MonthlyQuota int64
+	// QuotaFile keeps the quota counters across restarts; they're saved every minute and on shutdown.
+	// Without a file they're kept in memory only.
+	QuotaFile string
+}
+
+// AuthGuardOptions configure the lockout of IPs after failed authentications
+type AuthGuardOptions struct {
+	// MaxFailures within FailureWindow ban the IP; defaults to 5 failures within 10m
+	MaxFailures   int
+	FailureWindow time.Duration
+	// BanDuration doubles with every ban up to MaxBanDuration; defaults to 1m and 24h
+	BanDuration    time.Duration
+	MaxBanDuration time.Duration
+}
+
+// SiweOptions configure sign-in with ethereum
+type SiweOptions struct {
+	// Domain the messages must be issued for, e.g. api.example.com; sign-in with ethereum is disabled without it.
+	// It's never taken from the request, since the client controls the Host header.
+	Domain string
+	// Scheme of the origin the messages must be issued for; defaults to https
+	Scheme string
+	// DefaultScopes are granted to addresses without a rule; without default scopes they're rejected
+	DefaultScopes []string
+}
+
+// TLSOptions configure the certificate of TLS listeners; without CertFile the server serves plain HTTP
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// ClientAuth is ClientAuthNone, ClientAuthOptional or ClientAuthRequire; defaults to optional if ClientCAFile is set
+	ClientAuth string
+	// ReloadInterval is the interval the files are checked for changes in; defaults to 5s
+	ReloadInterval time.Duration
+}
+
+// ValidationService provides the data of the validation routes
+type ValidationService interface {
+	GetNetwork(name string) (*validation.Network, error)
+	GetDefaultNetwork() (*validation.Network, error)
+	GetNetworks() []*validation.Network
+	ResolveBlockID(network *validation.Network, blockID string) (uint64, error)
+	GetBlockRewardSlot(network *validation.Network, slot uint64) (*validation.BlockRewardSlot, error)
+	GetSyncDuties(network *validation.Network, slot uint64) (*validation.SyncDutiesResponse, error)
+	GetValidatorStatuses(network *validation.Network, ids []string) ([]validation.ValidatorStatus, error)
+	VerifyValidatorProof(network *validation.Network, pubkey, signature string, challenge [32]byte) error
+	ForEachBlockReward(ctx context.Context, network *validation.Network, from, to uint64, workers int, fn func(slot uint64, reward *validation.BlockRewardSlot) error) error
+}
+
+// DefaultValidationService returns the service backed by the networks configured by the environment
+func DefaultValidationService() ValidationService {
+	return NewValidationService(validation.EnvNetworks())
+}
+
+// NewValidationService returns the service backed by the given networks of the validation package
+func NewValidationService(networks *validation.Networks) ValidationService {
+	return defaultValidationService{networks: networks}
+}
+
+type defaultValidationService struct {
+	networks *validation.Networks
+}
+
+func (s defaultValidationService) GetNetwork(name string) (*validation.Network, error) {
+	return s.networks.Get(name)
+}
+
+func (s defaultValidationService) GetDefaultNetwork() (*validation.Network, error) {
+	return s.networks.Default()
+}
+
+func (s defaultValidationService) GetNetworks() []*validation.Network {
+	return s.networks.All()
+}
+
+func (defaultValidationService) ResolveBlockID(network *validation.Network, blockID string) (uint64, error) {
+	return validation.ResolveBlockID(network, blockID)
+}
+
+func (defaultValidationService) GetBlockRewardSlot(network *validation.Network, slot uint64) (*validation.BlockRewardSlot, error) {
+	return validation.GetBlockRewardSlot(network, slot)
+}
+
+func (defaultValidationService) GetSyncDuties(network *validation.Network, slot uint64) (*validation.SyncDutiesResponse, error) {
+	return validation.GetSyncDuties(network, slot)
+}
+
+func (defaultValidationService) GetValidatorStatuses(network *validation.Network, ids []string) ([]validation.ValidatorStatus, error) {
+	return validation.GetValidatorStatuses(network, ids)
+}
+
+func (defaultValidationService) VerifyValidatorProof(network *validation.Network, pubkey, signature string, challenge [32]byte) error {
+	return validation.VerifyValidatorProof(network, pubkey, signature, challenge)
+}
+
+func (defaultValidationService) ForEachBlockReward(ctx context.Context, network *validation.Network, from, to uint64, workers int, fn func(slot uint64, reward *validation.BlockRewardSlot) error) error {
+	return validation.ForEachBlockReward(ctx, network, from, to, workers, fn)
+}
@@ -0,0 +1,170 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testValidationService serves fixed data for a network without backend requests
+type testValidationService struct {
+	ValidationService
+	network *validation.Network
+	// slotDelay slows down ranges
+	slotDelay time.Duration
+	// blockIDs resolves named block identifiers like head
+	blockIDs map[string]uint64
+}
+
+func (s *testValidationService) GetNetwork(name string) (*validation.Network, error) {
+	if name != s.network.Name {
+		return nil, errors.New(validation.ErrUnknownNetwork)
+	}
+	return s.network, nil
+}
+
+func (s *testValidationService) GetDefaultNetwork() (*validation.Network, error) {
+	return s.network, nil
+}
+
+func (s *testValidationService) GetNetworks() []*validation.Network {
+	return []*validation.Network{s.network}
+}
+
+func (s *testValidationService) ResolveBlockID(network *validation.Network, blockID string) (uint64, error) {
+	if slot, ok := s.blockIDs[blockID]; ok {
+		return slot, nil
+	}
+	return strconv.ParseUint(blockID, 10, 64)
+}
+
+func (s *testValidationService) GetBlockRewardSlot(network *validation.Network, slot uint64) (*validation.BlockRewardSlot, error) {
+	return &validation.BlockRewardSlot{Slot: slot, Status: "vanilla", Reward: 42}, nil
+}
+
+func TestNew(t *testing.T) {
+	logOutput := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(logOutput)
+
+	keystore := NewDefaultKeystore("key")
+	server, errNew := New(Options{
+		Logger:     logger,
+		Validation: &testValidationService{network: &validation.Network{Name: "testnet", BackendEndpoint: "http://backend", SecondsPerSlot: 12, SlotsPerEpoch: 32}},
+		Keystore:   keystore,
+		Routes: func(router chi.Router) {
+			router.Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(RequestSession(r).GetIdentity()))
+			})
+		},
+	})
+	if errNew != nil {
+		t.Fatal(errNew)
+	}
+
+	response := testRequest(server, "GET", "/testnet/blockreward/7", "", map[string]string{"Validator-Api-Key": "key"})
+	slot := &validation.BlockRewardSlot{}
+	if errDecode := json.NewDecoder(response.Body).Decode(slot); response.Code != 200 || errDecode != nil || slot.Slot != 7 || slot.Reward != 42 {
+		t.Fatalf("expected slot of the validation service, got %v: %+v (%v)", response.Code, slot, errDecode)
+	}
+	response = testRequest(server, "GET", "/whoami", "", map[string]string{"Validator-Api-Key": "key"})
+	if response.Code != 200 || !strings.HasPrefix(response.Body.String(), "key:") {
+		t.Errorf("expected extra route with session, got %v: %v", response.Code, response.Body.String())
+	}
+	if response = testRequest(server, "GET", "/whoami", "", nil); response.Code == 200 {
+		t.Errorf("expected extra route to require authentication, got %v", response.Code)
+	}
+	if !strings.Contains(logOutput.String(), "/testnet/blockreward/7") {
+		t.Errorf("expected requests to be logged to the server logger, got %q", logOutput.String())
+	}
+
+	// Options are validated instead of exiting the process
+	if _, errNew = New(Options{TrustedProxies: []string{"bad"}}); errNew == nil {
+		t.Error("expected invalid trusted proxies to be rejected")
+	}
+	if _, errNew = New(Options{Listeners: []string{"udp://:53"}}); errNew == nil {
+		t.Error("expected invalid listener to be rejected")
+	}
+	if errStart := server.Start(context.Background()); !errors.Is(errStart, ErrStartFailed) {
+		t.Errorf("expected Start to fail without listeners, got %v", errStart)
+	}
+}
+
+func TestBlockIDSlotEcho(t *testing.T) {
+	const blockRoot = "0x1111111111111111111111111111111111111111111111111111111111111111"
+	service := &testValidationService{
+		network:  &validation.Network{Name: "testnet", BackendEndpoint: "http://backend", SecondsPerSlot: 12, SlotsPerEpoch: 32},
+		blockIDs: map[string]uint64{"head": 130, blockRoot: 100},
+	}
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	server, errNew := New(Options{Logger: logger, Validation: service, Keystore: NewDefaultKeystore("key")})
+	if errNew != nil {
+		t.Fatal(errNew)
+	}
+
+	// Responses contain the slot the block identifier resolved to
+	for blockID, expected := range map[string]uint64{"head": 130, blockRoot: 100, "7": 7} {
+		response := testRequest(server, "GET", "/testnet/blockreward/"+blockID, "", map[string]string{"Validator-Api-Key": "key"})
+		slot := &validation.BlockRewardSlot{}
+		if errDecode := json.NewDecoder(response.Body).Decode(slot); response.Code != 200 || errDecode != nil || slot.Slot != expected {
+			t.Errorf("expected %v to resolve to slot %v, got %v: %+v (%v)", blockID, expected, response.Code, slot, errDecode)
+		}
+	}
+}
+
+func TestNewNetworks(t *testing.T) {
+	networks, errNetworks := validation.NewNetworks(validation.Config{
+		DefaultNetwork: "holesky",
+		Networks:       map[string]validation.NetworkConfig{"holesky": {BackendEndpoint: "http://holesky-backend"}},
+	})
+	if errNetworks != nil {
+		t.Fatal(errNetworks)
+	}
+	server, errNew := New(Options{Networks: networks})
+	if errNew != nil {
+		t.Fatal(errNew)
+	}
+	if network, errNetwork := server.validation.GetDefaultNetwork(); errNetwork != nil || network.BackendEndpoint != "http://holesky-backend" {
+		t.Errorf("expected configured default network, got %+v (%v)", network, errNetwork)
+	}
+	if _, errNetworks = validation.NewNetworks(validation.Config{Networks: map[string]validation.NetworkConfig{"testnet": {}}}); errNetworks == nil {
+		t.Error("expected unknown network to be rejected")
+	}
+
+	// Finality verification can't silently be skipped
+	networks, _ = validation.NewNetworks(validation.Config{Networks: map[string]validation.NetworkConfig{
+		"mainnet": {BackendEndpoint: "http://backend", LightClient: validation.LightClientConfig{Checkpoint: "0x" + strings.Repeat("11", 32)}},
+	}})
+	if _, errNew = New(Options{Networks: networks}); errNew == nil {
+		t.Error("expected light client which isn't initialized to be rejected")
+	}
+}
+
+func TestTimeSlotBounds(t *testing.T) {
+	handler := newTestRequestHandler(NewDefaultKeystore("key"))
+	network, _ := validation.GetDefaultNetwork()
+	maxSlot := strconv.FormatUint(network.MaxSlot(), 10)
+	for path, expected := range map[string]int{
+		"/time/slot/" + maxSlot: 200,
+		"/time/slot/" + strconv.FormatUint(network.MaxSlot()+1, 10): 400,
+		"/time/slot/18446744073709551615":                           400,
+		"/time/slot/18446744073709551616":                           400,
+		"/time/slot/-1":                                             400,
+		"/time/slot/" + strings.Repeat("9", 30):                     400,
+	} {
+		if response := testRequest(handler, "GET", path, "", map[string]string{"Validator-Api-Key": "key"}); response.Code != expected {
+			t.Errorf("expected %v for %v, got %v: %v", expected, path, response.Code, response.Body.String())
+		}
+	}
+}
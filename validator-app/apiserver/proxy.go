@@ -0,0 +1,106 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDRList parses a comma separated list of CIDRs or single IPs
+func parseCIDRList(value string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		cidr := entry
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, errParse := net.ParseCIDR(cidr)
+		if errParse != nil {
+			return nil, fmt.Errorf("invalid CIDR: %v", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// containsIP returns true if one of the networks contains the IP
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveClientIP returns the IP of the client. Forwarded headers are only evaluated if the peer is a trusted proxy;
+// the chain is then walked from the right, and the first address which isn't a trusted proxy is the client.
+func resolveClientIP(req *http.Request, proxies []*net.IPNet) net.IP {
+	peer, _, errHostPort := net.SplitHostPort(req.RemoteAddr)
+	if errHostPort != nil {
+		peer = req.RemoteAddr
+	}
+	ip := net.ParseIP(peer)
+	if ip == nil || len(proxies) == 0 {
+		return ip
+	}
+
+	chain := forwardedChain(req)
+	for i := len(chain) - 1; i >= 0 && containsIP(proxies, ip); i-- {
+		hop := net.ParseIP(chain[i])
+		if hop == nil {
+			// Obfuscated or malformed entries end the chain
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+// forwardedChain returns the addresses of the forwarding chain, from the client to the last proxy.
+// The standard Forwarded header takes precedence over X-Forwarded-For and X-Real-IP.
+func forwardedChain(req *http.Request) []string {
+	chain := make([]string, 0)
+	if forwarded := req.Header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					chain = append(chain, stripPort(strings.Trim(value, "\"")))
+				}
+			}
+		}
+		return chain
+	}
+	if forwardedFor := req.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		for _, hop := range strings.Split(strings.Join(forwardedFor, ","), ",") {
+			chain = append(chain, stripPort(strings.TrimSpace(hop)))
+		}
+		return chain
+	}
+	if realIP := req.Header.Get("X-Real-IP"); len(realIP) > 0 {
+		chain = append(chain, stripPort(strings.TrimSpace(realIP)))
+	}
+	return chain
+}
+
+// stripPort removes the port and the brackets of IPv6 addresses
+func stripPort(address string) string {
+	if host, _, errHostPort := net.SplitHostPort(address); errHostPort == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
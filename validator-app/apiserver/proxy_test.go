@@ -0,0 +1,37 @@
+package apiserver
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	proxies, errProxies := parseCIDRList("10.0.0.0/8, 192.0.2.10, 2001:db8::1")
+	if errProxies != nil {
+		t.Fatal(errProxies)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"untrusted peer", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.5"},
+		{"x-forwarded-for", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"spoofed left entry", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"x-real-ip", "192.0.2.10:1234", map[string]string{"X-Real-IP": "198.51.100.2"}, "198.51.100.2"},
+		{"forwarded", "[2001:db8::1]:443", map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.3`, "X-Forwarded-For": "1.1.1.1"}, "2001:db8:cafe::17"},
+		{"obfuscated", "10.0.0.1:1234", map[string]string{"Forwarded": "for=_hidden"}, "10.0.0.1"},
+		{"no headers", "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		for name, value := range test.headers {
+			req.Header.Set(name, value)
+		}
+		if ip := resolveClientIP(req, proxies); ip == nil || ip.String() != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, ip)
+		}
+	}
+}
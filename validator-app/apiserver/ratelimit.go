@@ -0,0 +1,297 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Route names used for per route rate limits
+const (
+	RouteAuth        = "auth"
+	RouteBlockReward = "blockreward"
+	RouteSyncDuties  = "syncduties"
+	RouteValidator   = "validator"
+	RouteTime        = "time"
+	RouteJobs        = "jobs"
+)
+
+// rateLimitedRoutes are the routes with separate buckets; their limits can be configured per route
+var rateLimitedRoutes = []string{RouteAuth, RouteBlockReward, RouteSyncDuties, RouteValidator, RouteTime, RouteJobs}
+
+// RateLimit configures a token bucket; a request takes one token, tokens are refilled at RequestsPerSecond up to Burst
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+}
+
+// KeyLimits overrides the default limits of an API key. Zero values keep the defaults.
+type KeyLimits struct {
+	RateLimit
+	DailyQuota   int64                `json:"daily_quota,omitempty"`
+	MonthlyQuota int64                `json:"monthly_quota,omitempty"`
+	Routes       map[string]RateLimit `json:"routes,omitempty"`
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type quotaCounter struct {
+	Day        string `json:"day"`
+	DayCount   int64  `json:"day_count"`
+	Month      string `json:"month"`
+	MonthCount int64  `json:"month_count"`
+}
+
+// rateLimitResult describes the bucket which is reported in the RateLimit headers
+type rateLimitResult struct {
+	allowed    bool
+	quota      bool // true if a quota, not a bucket, rejected the request
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// rateLimiter limits requests per identity and per IP, with separate buckets per route
+type rateLimiter struct {
+	keyLimit     RateLimit
+	ipLimit      RateLimit
+	routeLimits  map[string]RateLimit
+	dailyQuota   int64
+	monthlyQuota int64
+
+	buckets map[string]*tokenBucket
+	quotas  map[string]*quotaCounter
+	mtx     sync.Mutex
+	// Quota counters are saved to the file, if any, so they survive a restart
+	quotaFile     string
+	quotasChanged bool
+}
+
+// newRateLimiter applies the defaults to unset limits; routes without a limit use the per identity limit.
+// The quota counters of the quota file are loaded if it exists.
+func newRateLimiter(opts RateLimitOptions) (*rateLimiter, error) {
+	limiter := &rateLimiter{
+		keyLimit:     withDefaultRateLimit(opts.Key, RateLimit{RequestsPerSecond: 10, Burst: 20}),
+		ipLimit:      withDefaultRateLimit(opts.IP, RateLimit{RequestsPerSecond: 20, Burst: 40}),
+		routeLimits:  make(map[string]RateLimit),
+		dailyQuota:   opts.DailyQuota,
+		monthlyQuota: opts.MonthlyQuota,
+		buckets:      make(map[string]*tokenBucket),
+		quotas:       make(map[string]*quotaCounter),
+		quotaFile:    opts.QuotaFile,
+	}
+	for _, route := range rateLimitedRoutes {
+		limiter.routeLimits[route] = withDefaultRateLimit(opts.Routes[route], limiter.keyLimit)
+	}
+	if len(limiter.quotaFile) > 0 {
+		content, errRead := os.ReadFile(limiter.quotaFile)
+		if errRead != nil && !errors.Is(errRead, os.ErrNotExist) {
+			return nil, fmt.Errorf("unable to read quota file: %v", errRead)
+		}
+		if errRead == nil {
+			if errDecode := json.Unmarshal(content, &limiter.quotas); errDecode != nil {
+				return nil, fmt.Errorf("unable to decode quota file %v: %v", limiter.quotaFile, errDecode)
+			}
+		}
+	}
+	return limiter, nil
+}
+
+func withDefaultRateLimit(limit RateLimit, fallback RateLimit) RateLimit {
+	if limit.RequestsPerSecond <= 0 {
+		limit.RequestsPerSecond = fallback.RequestsPerSecond
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = fallback.Burst
+	}
+	return limit
+}
+
+// allow takes a token from the IP bucket and, for authenticated requests, from the identity bucket and quota
+func (l *rateLimiter) allow(identity string, keyLimits *KeyLimits, ip, route string) rateLimitResult {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+
+	result := l.take("ip:"+ip+":"+route, l.ipLimit, now)
+	if !result.allowed || len(identity) == 0 {
+		return result
+	}
+
+	// Key specific limits take precedence over the route defaults
+	limit, ok := l.routeLimits[route]
+	if !ok {
+		limit = l.keyLimit
+	}
+	dailyQuota, monthlyQuota := l.dailyQuota, l.monthlyQuota
+	if keyLimits != nil {
+		if routeLimit, ok := keyLimits.Routes[route]; ok {
+			limit = mergeRateLimit(routeLimit, limit)
+		} else {
+			limit = mergeRateLimit(keyLimits.RateLimit, limit)
+		}
+		if keyLimits.DailyQuota > 0 {
+			dailyQuota = keyLimits.DailyQuota
+		}
+		if keyLimits.MonthlyQuota > 0 {
+			monthlyQuota = keyLimits.MonthlyQuota
+		}
+	}
+	result = l.take("id:"+identity+":"+route, limit, now)
+	if !result.allowed {
+		return result
+	}
+	if retryAfter, ok := l.countQuota(identity, dailyQuota, monthlyQuota, now); !ok {
+		return rateLimitResult{quota: true, limit: result.limit, reset: retryAfter, retryAfter: retryAfter}
+	}
+	return result
+}
+
+func (l *rateLimiter) take(name string, limit RateLimit, now time.Time) rateLimitResult {
+	bucket, ok := l.buckets[name]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), lastSeen: now}
+		l.buckets[name] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*limit.RequestsPerSecond)
+	bucket.lastSeen = now
+
+	result := rateLimitResult{limit: limit.Burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = time.Duration((1 - bucket.tokens) / limit.RequestsPerSecond * float64(time.Second))
+	}
+	result.remaining = int(bucket.tokens)
+	result.reset = time.Duration((float64(limit.Burst) - bucket.tokens) / limit.RequestsPerSecond * float64(time.Second))
+	return result
+}
+
+// countQuota counts the request against the daily and monthly quota; it returns the time until the exceeded quota resets
+func (l *rateLimiter) countQuota(identity string, dailyQuota, monthlyQuota int64, now time.Time) (time.Duration, bool) {
+	now = now.UTC()
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	counter, ok := l.quotas[identity]
+	if !ok {
+		counter = &quotaCounter{}
+		l.quotas[identity] = counter
+	}
+	if counter.Day != day {
+		counter.Day, counter.DayCount = day, 0
+	}
+	if counter.Month != month {
+		counter.Month, counter.MonthCount = month, 0
+	}
+
+	if monthlyQuota > 0 && counter.MonthCount >= monthlyQuota {
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC).Sub(now), false
+	}
+	if dailyQuota > 0 && counter.DayCount >= dailyQuota {
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Sub(now), false
+	}
+	counter.DayCount++
+	counter.MonthCount++
+	l.quotasChanged = true
+	return 0, true
+}
+
+// expire removes idle buckets and quota counters of past months
+func (l *rateLimiter) expire() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	for name, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > 10*time.Minute {
+			delete(l.buckets, name)
+		}
+	}
+	month := now.UTC().Format("2006-01")
+	for identity, counter := range l.quotas {
+		if counter.Month != month {
+			delete(l.quotas, identity)
+		}
+	}
+}
+
+// saveQuotas writes the quota counters to the quota file if they changed since the last save
+func (l *rateLimiter) saveQuotas() error {
+	l.mtx.Lock()
+	if len(l.quotaFile) == 0 || !l.quotasChanged {
+		l.mtx.Unlock()
+		return nil
+	}
+	content, errEncode := json.Marshal(l.quotas)
+	l.quotasChanged = false
+	l.mtx.Unlock()
+	if errEncode != nil {
+		return fmt.Errorf("unable to encode quotas: %v", errEncode)
+	}
+	// Write to a temporary file first so a crash can't leave truncated counters behind
+	tmpPath := l.quotaFile + ".tmp"
+	if errWrite := os.WriteFile(tmpPath, content, 0600); errWrite != nil {
+		return fmt.Errorf("unable to write quota file: %v", errWrite)
+	}
+	return os.Rename(tmpPath, l.quotaFile)
+}
+
+func mergeRateLimit(limit, fallback RateLimit) RateLimit {
+	if limit.RequestsPerSecond <= 0 {
+		limit.RequestsPerSecond = fallback.RequestsPerSecond
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = fallback.Burst
+	}
+	return limit
+}
+
+// rateLimit applies the rate limits of the route; requests without a session, like sign-in requests, are only limited per IP
+func rateLimit(route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := getRequestServer(r).rateLimiter
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var identity string
+			var keyLimits *KeyLimits
+			if session, ok := r.Context().Value(sessionContextKey).(*EthereumValidatorHTTPSessionHandler); ok {
+				identity = session.GetIdentity()
+				if session.GetApiKey() != nil {
+					keyLimits = session.GetApiKey().Limits
+				}
+			}
+
+			result := limiter.allow(identity, keyLimits, clientIP(r), route)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.reset.Seconds()))))
+			if !result.allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.retryAfter.Seconds()))))
+				w.WriteHeader(429)
+				if result.quota {
+					errorHTTPResponse(w, QUOTA_EXCEEDED, "")
+				} else {
+					errorHTTPResponse(w, RATE_LIMITED, fmt.Sprintf("rate limit of route %v exceeded", route))
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package apiserver
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBucket(t *testing.T) {
+	limiter := &rateLimiter{
+		keyLimit:    RateLimit{RequestsPerSecond: 1, Burst: 2},
+		ipLimit:     RateLimit{RequestsPerSecond: 100, Burst: 100},
+		routeLimits: map[string]RateLimit{RouteBlockReward: {RequestsPerSecond: 1, Burst: 2}},
+		buckets:     make(map[string]*tokenBucket),
+		quotas:      make(map[string]*quotaCounter),
+	}
+	for i := 0; i < 2; i++ {
+		if result := limiter.allow("key:a", nil, "192.0.2.1", RouteBlockReward); !result.allowed {
+			t.Fatalf("request %v: expected to be allowed", i)
+		}
+	}
+	result := limiter.allow("key:a", nil, "192.0.2.1", RouteBlockReward)
+	if result.allowed || result.retryAfter <= 0 || result.retryAfter > time.Second {
+		t.Errorf("expected request to be limited, got %+v", result)
+	}
+
+	// Buckets are separate per identity and per route
+	if result = limiter.allow("key:b", nil, "192.0.2.1", RouteBlockReward); !result.allowed {
+		t.Error("expected other key to be allowed")
+	}
+	if result = limiter.allow("key:a", nil, "192.0.2.1", RouteSyncDuties); !result.allowed {
+		t.Error("expected other route to be allowed")
+	}
+	// Key specific limits override the defaults
+	keyLimits := &KeyLimits{Routes: map[string]RateLimit{RouteBlockReward: {RequestsPerSecond: 1, Burst: 10}}}
+	if result = limiter.allow("key:c", keyLimits, "192.0.2.1", RouteBlockReward); !result.allowed || result.limit != 10 {
+		t.Errorf("expected key limit, got %+v", result)
+	}
+}
+
+func TestRateLimiterQuota(t *testing.T) {
+	limiter := &rateLimiter{
+		keyLimit:    RateLimit{RequestsPerSecond: 100, Burst: 100},
+		ipLimit:     RateLimit{RequestsPerSecond: 100, Burst: 100},
+		routeLimits: map[string]RateLimit{},
+		dailyQuota:  3,
+		buckets:     make(map[string]*tokenBucket),
+		quotas:      make(map[string]*quotaCounter),
+	}
+	for i := 0; i < 3; i++ {
+		if result := limiter.allow("key:a", nil, "192.0.2.1", RouteTime); !result.allowed {
+			t.Fatalf("request %v: expected to be allowed", i)
+		}
+	}
+	result := limiter.allow("key:a", nil, "192.0.2.1", RouteTime)
+	if result.allowed || !result.quota || result.retryAfter > 24*time.Hour {
+		t.Errorf("expected quota to be exceeded, got %+v", result)
+	}
+}
+
+func TestRateLimiterQuotaFile(t *testing.T) {
+	opts := RateLimitOptions{DailyQuota: 3, QuotaFile: filepath.Join(t.TempDir(), "quotas.json")}
+	limiter, errLimiter := newRateLimiter(opts)
+	if errLimiter != nil {
+		t.Fatal(errLimiter)
+	}
+	for i := 0; i < 3; i++ {
+		if result := limiter.allow("key:a", nil, "192.0.2.1", RouteTime); !result.allowed {
+			t.Fatalf("request %v: expected to be allowed", i)
+		}
+	}
+	if errSave := limiter.saveQuotas(); errSave != nil {
+		t.Fatal(errSave)
+	}
+
+	// A restarted limiter continues with the saved counters
+	restarted, errRestarted := newRateLimiter(opts)
+	if errRestarted != nil {
+		t.Fatal(errRestarted)
+	}
+	if result := restarted.allow("key:a", nil, "192.0.2.1", RouteTime); result.allowed || !result.quota {
+		t.Errorf("expected quota to survive the restart, got %+v", result)
+	}
+	if result := restarted.allow("key:b", nil, "192.0.2.1", RouteTime); !result.allowed {
+		t.Error("expected other key to be allowed")
+	}
+}
+
+func TestRateLimiterRouteLimits(t *testing.T) {
+	limiter, errLimiter := newRateLimiter(RateLimitOptions{
+		Key:    RateLimit{RequestsPerSecond: 100, Burst: 100},
+		Routes: map[string]RateLimit{RouteJobs: {RequestsPerSecond: 1, Burst: 1}},
+	})
+	if errLimiter != nil {
+		t.Fatal(errLimiter)
+	}
+	// Every route has a configurable limit, including the job API
+	for _, route := range rateLimitedRoutes {
+		if _, ok := limiter.routeLimits[route]; !ok {
+			t.Errorf("expected limit for route %v", route)
+		}
+	}
+	if result := limiter.allow("key:a", nil, "192.0.2.1", RouteJobs); !result.allowed {
+		t.Fatal("expected first job request to be allowed")
+	}
+	if result := limiter.allow("key:a", nil, "192.0.2.1", RouteJobs); result.allowed || result.limit != 1 {
+		t.Errorf("expected job route limit to apply, got %+v", result)
+	}
+	if result := limiter.allow("key:a", nil, "192.0.2.1", RouteTime); !result.allowed || result.limit != 100 {
+		t.Errorf("expected other routes to keep the key limit, got %+v", result)
+	}
+}
@@ -5,7 +5,9 @@ Copyright © 2024 RuntimeRacer
 package apiserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/runtimeracer/ethereum-validator-go/validation"
 	log "github.com/sirupsen/logrus"
@@ -19,13 +21,24 @@ import (
 	"github.com/go-chi/render"
 )
 
-func GetApiRouter() *chi.Mux {
+type contextKey string
+
+const (
+	networkContextKey  contextKey = "network"
+	sessionContextKey  contextKey = "session"
+	serverContextKey   contextKey = "server"
+	listenerContextKey contextKey = "listener"
+)
+
+// GetApiRouter returns a router with the basic middleware stack; requests are logged to the logger
+func GetApiRouter(logger *log.Logger) *chi.Mux {
 	router := chi.NewRouter()
 
 	// Define basic Middleware stack
 	router.Use(middleware.RequestID)
 	// router.Use(middleware.RealIP) -> Flawed: https://github.com/go-chi/chi/issues/453
-	router.Use(middleware.Logger)
+	// The client IP is derived from the forwarded headers of trusted proxies only, before requests reach the router
+	router.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: logger, NoColor: true}))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.Timeout(60 * time.Second))
 
@@ -41,8 +54,8 @@ func AddCors(router *chi.Mux) *chi.Mux {
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Api-Key", "X-CSRF-Token", "X-Forwarded-For", "X-Real-IP"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Api-Key", "X-CSRF-Token", "X-Forwarded-For", "X-Real-IP", "Validator-Api-Key", "Validator-Session-Id", HeaderKeyId, HeaderTimestamp, HeaderNonce, HeaderSignature},
+		ExposedHeaders:   []string{"Link", "Validator-Session-Id", "Validator-Session-Expires"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -51,13 +64,52 @@ func AddCors(router *chi.Mux) *chi.Mux {
 }
 
 func AddRoutes(router *chi.Mux) {
-	// Blockreward Endpoint
-	router.Route("/blockreward", func(r chi.Router) {
-		r.Get("/{slot}", blockRewardGetSlot)
+	// Session Endpoints
+	router.Route("/auth", func(r chi.Router) {
+		r.Use(rateLimit(RouteAuth))
+		r.With(requireSiwe).Get("/nonce", authNonce)
+		r.With(requireSiwe).Post("/verify", authVerify)
+		r.Post("/logout", authLogout)
+		// Validator ownership proofs; the network is selected by the ?network= query parameter
+		r.Route("/validator", func(r chi.Router) {
+			r.Use(networkContext)
+			r.Use(requireNetworkBackend)
+			r.Get("/challenge", authValidatorChallenge)
+			r.Post("/verify", authValidatorVerify)
+		})
 	})
-	// Syncduties Endpoint
-	router.Route("/syncduties", func(r chi.Router) {
-		r.Get("/{slot}", syncDutiesGetSlot)
+
+	// Admin Endpoints
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(requireScope(ScopeAdmin))
+		r.Get("/bans", adminGetBans)
+		r.Delete("/bans", adminClearBans)
+		r.Delete("/bans/{ip}", adminClearBan)
+	})
+
+	// Metrics Endpoint; it can also be served without authentication on a separate listener
+	router.With(requireScope(ScopeAdmin)).Get("/metrics", metricsGet)
+
+	// Job Endpoints; jobs of other identities are only visible to admins
+	router.Route("/jobs", func(r chi.Router) {
+		r.Use(requireJobs)
+		r.Use(requireScope(ScopeReadBlockReward))
+		r.Use(rateLimit(RouteJobs))
+		// The network is selected by the ?network= query parameter
+		r.With(networkContext, requireNetworkBackend).Post("/", jobSubmit)
+		r.Get("/{id}", jobGet)
+		r.Get("/{id}/result", jobGetResult)
+		r.Delete("/{id}", jobDelete)
+	})
+
+	// Validation Endpoints; the network is selected by the ?network= query parameter or the /{network} route prefix
+	router.Group(func(r chi.Router) {
+		r.Use(networkContext)
+		addValidationRoutes(r)
+	})
+	router.Route("/{network}", func(r chi.Router) {
+		r.Use(networkContext)
+		addValidationRoutes(r)
 	})
 
 	// Error 400 if Route is not found
@@ -72,55 +124,258 @@ func AddRoutes(router *chi.Mux) {
 	})
 }
 
+func addValidationRoutes(router chi.Router) {
+	// Blockreward Endpoint
+	router.Route("/blockreward", func(r chi.Router) {
+		r.Use(requireScope(ScopeReadBlockReward))
+		r.Use(rateLimit(RouteBlockReward))
+		r.Use(requireNetworkBackend)
+		r.Get("/{slot}", blockRewardGetSlot)
+	})
+	// Syncduties Endpoint
+	router.Route("/syncduties", func(r chi.Router) {
+		r.Use(requireScope(ScopeReadSyncDuties))
+		r.Use(rateLimit(RouteSyncDuties))
+		r.Use(requireNetworkBackend)
+		r.Get("/{slot}", syncDutiesGetSlot)
+	})
+	// Validator Endpoint; per-validator data requires a proof of ownership
+	router.Route("/validator", func(r chi.Router) {
+		r.Use(rateLimit(RouteValidator))
+		r.Use(requireNetworkBackend)
+		r.With(requireValidatorAccess).Get("/{id}", validatorGetStatus)
+	})
+	// Time Endpoint; conversions only rely on the network profile
+	router.Route("/time", func(r chi.Router) {
+		r.Use(rateLimit(RouteTime))
+		r.Get("/slot/{slot}", timeGetSlot)
+		r.Get("/at/{unix}", timeGetAt)
+	})
+}
+
+// networkContext resolves the network profile of the request and stores it in the request context
+func networkContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "network")
+		fromPrefix := len(name) > 0
+		if !fromPrefix {
+			name = r.URL.Query().Get("network")
+		}
+
+		var network *validation.Network
+		var errNetwork error
+		if len(name) == 0 {
+			network, errNetwork = getRequestServer(r).validation.GetDefaultNetwork()
+		} else {
+			network, errNetwork = getRequestServer(r).validation.GetNetwork(name)
+		}
+		if errNetwork != nil && fromPrefix {
+			// Unknown prefixes are treated like any other undefined route
+			w.WriteHeader(400)
+			errorHTTPResponse(w, INVALID_ROUTE, "")
+			return
+		} else if errNetwork != nil {
+			w.WriteHeader(404)
+			errorHTTPResponse(w, UNKNOWN_NETWORK, errNetwork.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), networkContextKey, network)))
+	})
+}
+
+// requireNetworkBackend rejects requests for networks without a configured backend
+func requireNetworkBackend(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if network := getRequestNetwork(r); !network.IsConfigured() {
+			w.WriteHeader(404)
+			errorHTTPResponse(w, UNKNOWN_NETWORK, fmt.Sprintf("no backend configured for network %v", network.Name))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope rejects requests whose API key doesn't grant the scope
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, ok := r.Context().Value(sessionContextKey).(*EthereumValidatorHTTPSessionHandler)
+			if !ok || !session.HasScope(scope) {
+				w.WriteHeader(403)
+				errorHTTPResponse(w, INSUFFICIENT_SCOPE, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getRequestServer returns the server handling the request
+func getRequestServer(r *http.Request) *EthereumValidatorServer {
+	return r.Context().Value(serverContextKey).(*EthereumValidatorServer)
+}
+
+// RequestSession returns the session of a request to a route registered with Options.Routes
+func RequestSession(r *http.Request) *EthereumValidatorHTTPSessionHandler {
+	return getRequestSession(r)
+}
+
+// getRequestSession returns the session of the request; it's nil on public routes
+func getRequestSession(r *http.Request) *EthereumValidatorHTTPSessionHandler {
+	session, _ := r.Context().Value(sessionContextKey).(*EthereumValidatorHTTPSessionHandler)
+	return session
+}
+
+// getRequestNetwork returns the network resolved by networkContext
+func getRequestNetwork(r *http.Request) *validation.Network {
+	return r.Context().Value(networkContextKey).(*validation.Network)
+}
+
+// parseSlotParam resolves a slot path parameter, which is either an RFC 3339 timestamp or a beacon API block identifier:
+// a slot number, head, finalized, justified, genesis or a 0x prefixed block root.
+func (e *EthereumValidatorServer) parseSlotParam(network *validation.Network, value string) (uint64, error) {
+	if timestamp, errTime := time.Parse(time.RFC3339, value); errTime == nil {
+		return network.SlotAtTimestamp(timestamp.Unix())
+	}
+	return e.validation.ResolveBlockID(network, value)
+}
+
+func authLogout(w http.ResponseWriter, r *http.Request) {
+	session, ok := r.Context().Value(sessionContextKey).(*EthereumValidatorHTTPSessionHandler)
+	if !ok {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, INVALID_SESSION, "")
+		return
+	}
+	session.finalize()
+	// The token returned by the session middleware is no longer valid
+	w.Header().Del("Validator-Session-Id")
+	w.Header().Del("Validator-Session-Expires")
+	// 204 No Content
+	w.WriteHeader(204)
+}
+
 func blockRewardGetSlot(w http.ResponseWriter, r *http.Request) {
-	slot := chi.URLParam(r, "slot")
-	slotNumber, errParseSlotNumber := strconv.ParseUint(slot, 10, 64)
+	server := getRequestServer(r)
+	network := getRequestNetwork(r)
+	slotNumber, errParseSlotNumber := server.parseSlotParam(network, chi.URLParam(r, "slot"))
 	if errParseSlotNumber != nil {
-		w.WriteHeader(404)
-		errorHTTPResponse(w, NOT_FOUND, validation.ErrSlotDoesNotExist)
+		server.logger.Debugf("failed to resolve slot: %v", errParseSlotNumber)
+		validationErrorHTTPResponse(w, errParseSlotNumber)
 		return
 	}
 
-	slotDetails, errSlot := validation.GetBlockRewardSlot(slotNumber)
+	slotDetails, errSlot := server.validation.GetBlockRewardSlot(network, slotNumber)
 	if errSlot != nil {
 		// Log error
-		log.Errorf("failed to get slot reward details: %v", errSlot)
-		//
-		// return 500 to caller with generic info to avoid leaking backend data
-		w.WriteHeader(500)
-		errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
+		server.logger.Errorf("failed to get slot reward details: %v", errSlot)
+		validationErrorHTTPResponse(w, errSlot)
 		return
 	}
+	server.metrics.processedSlot(network.Name, slotNumber)
 	// 200 OK
 	w.WriteHeader(200)
 	// Return the slot details
 	if errEncode := json.NewEncoder(w).Encode(slotDetails); errEncode != nil {
-		log.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+		server.logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
 	}
 }
 
 func syncDutiesGetSlot(w http.ResponseWriter, r *http.Request) {
-	slot := chi.URLParam(r, "slot")
-	slotNumber, errParseSlotNumber := strconv.ParseUint(slot, 10, 64)
+	server := getRequestServer(r)
+	network := getRequestNetwork(r)
+	slotNumber, errParseSlotNumber := server.parseSlotParam(network, chi.URLParam(r, "slot"))
 	if errParseSlotNumber != nil {
-		w.WriteHeader(404)
-		errorHTTPResponse(w, NOT_FOUND, validation.ErrSlotDoesNotExist)
+		server.logger.Debugf("failed to resolve slot: %v", errParseSlotNumber)
+		validationErrorHTTPResponse(w, errParseSlotNumber)
 		return
 	}
 
-	syncDuties, errSlot := validation.GetSyncDuties(slotNumber)
+	syncDuties, errSlot := server.validation.GetSyncDuties(network, slotNumber)
 	if errSlot != nil {
 		// Log error
-		log.Errorf("failed to get slot syncduties details: %v", errSlot)
-		// return 500 to caller with generic info to avoid leaking backend data
-		w.WriteHeader(500)
-		errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
+		server.logger.Errorf("failed to get slot syncduties details: %v", errSlot)
+		validationErrorHTTPResponse(w, errSlot)
 		return
 	}
+	server.metrics.processedSlot(network.Name, slotNumber)
 	// 200 OK
 	w.WriteHeader(200)
 	// Return the slot details
 	if errEncode := json.NewEncoder(w).Encode(syncDuties); errEncode != nil {
-		log.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+		server.logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func timeGetSlot(w http.ResponseWriter, r *http.Request) {
+	slotNumber, errParseSlotNumber := strconv.ParseUint(chi.URLParam(r, "slot"), 10, 64)
+	if errParseSlotNumber != nil {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, "invalid slot")
+		return
+	}
+
+	slotTime, errSlot := validation.GetSlotTime(getRequestNetwork(r), slotNumber)
+	if errSlot != nil {
+		validationErrorHTTPResponse(w, errSlot)
+		return
+	}
+	// 200 OK
+	w.WriteHeader(200)
+	// Return the slot time details
+	if errEncode := json.NewEncoder(w).Encode(slotTime); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func timeGetAt(w http.ResponseWriter, r *http.Request) {
+	timestamp, errParseTimestamp := strconv.ParseInt(chi.URLParam(r, "unix"), 10, 64)
+	if errParseTimestamp != nil {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, "invalid unix timestamp")
+		return
+	}
+
+	slotTime, errSlot := validation.GetSlotAtTime(getRequestNetwork(r), timestamp)
+	if errSlot != nil {
+		validationErrorHTTPResponse(w, errSlot)
+		return
+	}
+	// 200 OK
+	w.WriteHeader(200)
+	// Return the slot time details
+	if errEncode := json.NewEncoder(w).Encode(slotTime); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+// validationErrorHTTPResponse maps errors of the validation package to an error response
+func validationErrorHTTPResponse(w http.ResponseWriter, err error) {
+	var integrityError *validation.IntegrityError
+	switch {
+	case validation.IsSlotDoesNotExist(err):
+		w.WriteHeader(404)
+		errorHTTPResponse(w, NOT_FOUND, validation.ErrSlotDoesNotExist)
+	case validation.IsSlotInFuture(err):
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, validation.ErrSlotInFuture)
+	case validation.IsTimeBeforeGenesis(err):
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, validation.ErrTimeBeforeGenesis)
+	case validation.IsSlotOutOfRange(err):
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, validation.ErrSlotOutOfRange)
+	case errors.As(err, &integrityError):
+		// The backend returned data which doesn't match the beacon block; only the failed check is exposed
+		w.WriteHeader(502)
+		errorHTTPResponse(w, INTEGRITY_CHECK_FAILED, integrityError.Check)
+	case validation.IsRelaysUnavailable(err):
+		// The MEV status can't be determined while a relay is down; the client may retry
+		w.WriteHeader(503)
+		errorHTTPResponse(w, BACKEND_UNAVAILABLE, validation.ErrRelaysUnavailable)
+	default:
+		// return 500 to caller with generic info to avoid leaking backend data
+		w.WriteHeader(500)
+		errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
 	}
 }
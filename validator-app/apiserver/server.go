@@ -6,10 +6,12 @@ package apiserver
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/runtimeracer/ethereum-validator-go/constants"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"io"
@@ -17,19 +19,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 var (
-	// Program flow
-	exitSignalReceived = make(chan bool)
-	shutdownComplete   = make(chan bool)
-
-	// Program instance
-	server *EthereumValidatorServer
+	// ErrStartFailed and ErrShutdownFailed are returned by Start; see ExitCode
+	ErrStartFailed    = errors.New("start failed")
+	ErrShutdownFailed = errors.New("shutdown failed")
 )
 
 type ConnectionHandler interface {
@@ -39,17 +39,62 @@ type ConnectionHandler interface {
 
 type EthereumValidatorServer struct {
 	// Application Flow
-	isServingRequests bool
+	isServingRequests atomic.Bool
+	stopRequested     chan struct{} // Closed by Stop or a signal to end Start
+	stopOnce          sync.Once
+	stopped           chan struct{} // Closed once Start completed the shutdown
+	draining          chan struct{} // Closed when the shutdown starts; later responses close their connection
+	drainOnce         sync.Once
+	drainTimeout      time.Duration
+	handleSignals     bool
+	inFlight          sync.WaitGroup
+	inFlightCount     atomic.Int64
 	// Params
-	port         string
+	listeners    []*Listener
 	inlineServer http.Server
+	keystore     *Keystore
+	logger       *log.Logger
+	securityLog  *log.Logger
+	validation   ValidationService
+	// Sessions
+	sessionSecret         []byte
+	sessionTTL            time.Duration
+	sessionMaxLifetime    time.Duration
+	sessionSlidingExpiry  bool
+	verifySessionIdentity bool
+	siweNonces            *nonceStore
+	validatorChallenges   *nonceStore
+	signatureNonces       *nonceStore
+	signatureMaxSkew      time.Duration
+	siweDomain            string
+	siweScheme            string
+	siweDefaultScopes     []string
+	rateLimiter           *rateLimiter
+	authGuard             *authGuard
+	trustedProxies        []*net.IPNet
+	ipRules               *ipRuleSet
+	keystoreReload        time.Duration
+	// Range jobs; nil if the job API is disabled
+	jobs *jobManager
+	// Metrics; the listener is nil unless they're served on a separate address
+	metrics         *serverMetrics
+	metricsListener *Listener
+	metricsServer   http.Server
+	// TLS; nil if the server serves plain HTTP
+	tlsCerts  *tlsProvider
+	tlsReload time.Duration
 	// Connections
 	activeHTTPSessions map[string]*EthereumValidatorHTTPSessionHandler
-	connMtx            sync.RWMutex
+	// Logged out or replaced sessions by the end of their maximum lifetime; their tokens aren't restored
+	endedHTTPSessions map[string]time.Time
+	// Sessions by identity, oldest first
+	identitySessions      map[string][]*EthereumValidatorHTTPSessionHandler
+	sessionMaxPerIdentity int
+	connMtx               sync.RWMutex
 }
 
-// Init Command executed
-func Init(args []string) *EthereumValidatorServer {
+// Init Command executed; it sets up the process logs and creates the server from the config and environment
+func Init(args []string) (*EthereumValidatorServer, error) {
 	log.SetLevel(log.DebugLevel)
 	log.SetFormatter(&log.TextFormatter{
 		DisableColors:   true,
@@ -73,160 +118,631 @@ func Init(args []string) *EthereumValidatorServer {
 	multiWriter := io.MultiWriter(writers...)
 	log.SetOutput(multiWriter)
 
-	// init EthereumValidatorServer
-	var err error
-	server, err = initEthereumValidatorServer()
-	if err != nil {
-		log.Fatalf(constants.ErrInitFailed, err.Error())
+	// Authentication failures are written to a dedicated security log
+	securityLog := log.New()
+	securityLog.SetFormatter(&log.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.999Z07:00"})
+	securityLog.SetOutput(multiWriter)
+	if securityLogFile := viper.GetString("SECURITY_LOG_FILE"); len(securityLogFile) > 0 {
+		file, errLogFile := os.OpenFile(securityLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if errLogFile != nil {
+			log.Warnf("Unable to write to security log file '%v'; please check disk space and folder permissions", securityLogFile)
+		} else {
+			securityLog.SetOutput(file)
+		}
 	}
 
-	return server
+	opts, errOptions := OptionsFromConfig()
+	if errOptions != nil {
+		return nil, fmt.Errorf(constants.ErrInitFailed, errOptions.Error())
+	}
+	opts.Logger = log.StandardLogger()
+	opts.SecurityLogger = securityLog
+
+	// Init light client; it verifies finalized headers if a trusted checkpoint is configured and follows updates
+	// until the server stopped
+	lightClientCtx, stopLightClient := context.WithCancel(context.Background())
+	if errLightClient := opts.Networks.InitLightClient(lightClientCtx); errLightClient != nil {
+		stopLightClient()
+		return nil, fmt.Errorf(constants.ErrInitFailed, errLightClient.Error())
+	}
+
+	eventServer, errServer := New(opts)
+	if errServer != nil {
+		stopLightClient()
+		return nil, fmt.Errorf(constants.ErrInitFailed, errServer.Error())
+	}
+	go func() {
+		<-eventServer.stopped
+		stopLightClient()
+	}()
+	return eventServer, nil
 }
 
-func initEthereumValidatorServer() (*EthereumValidatorServer, error) {
-	// Parse mandatory env vars
-	servicePort := viper.GetInt("PORT")
-	if servicePort < 1024 {
-		return nil, fmt.Errorf(constants.ErrConfigValue, "Port")
+// New creates a server from explicit options. It doesn't read the config or environment unless Networks is unset,
+// so several servers can run in one process. The server is an http.Handler; Start serves it on the configured listeners instead.
+func New(opts Options) (*EthereumValidatorServer, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.StandardLogger()
+	}
+	securityLog := opts.SecurityLogger
+	if securityLog == nil {
+		securityLog = logger
+	}
+	validationService := opts.Validation
+	if validationService == nil {
+		networks := opts.Networks
+		if networks == nil {
+			networks = validation.EnvNetworks()
+		}
+		validationService = NewValidationService(networks)
+	}
+	// Finality is only verified by an initialized light client; serving unverified rewards instead would go unnoticed
+	for _, network := range validationService.GetNetworks() {
+		if network.LightClientEnabled() && !network.HasLightClient() {
+			return nil, fmt.Errorf("light client of network %v is configured but not initialized", network.Name)
+		}
+	}
+	keystore := opts.Keystore
+	if keystore == nil {
+		keystore = &Keystore{Keys: make([]*ApiKey, 0)}
+	}
+	for _, key := range keystore.ListKeys() {
+		if key.Enabled && !key.HasSigningKey() {
+			logger.Warnf("API key '%v' has no signing key; rotate it to sign requests", key.Id)
+		}
 	}
 
+	// Forwarded headers are only evaluated for requests from trusted proxies
+	trustedProxies, errProxies := parseCIDRList(strings.Join(opts.TrustedProxies, ","))
+	if errProxies != nil {
+		return nil, errProxies
+	}
+
+	// Static IP rules apply in addition to the global and per key rules of the keystore, which are reloaded on change
+	ipRules, errIPRules := opts.IPRules.compile()
+	if errIPRules != nil {
+		return nil, errIPRules
+	}
+
+	// Serve TLS if a certificate is configured; the certificate, key and client CAs are reloaded on change
+	tlsCerts, errTLS := newTLSProvider(opts.TLS, logger)
+	if errTLS != nil {
+		return nil, errTLS
+	}
+
+	// Listeners are only required by Start
+	var listeners []*Listener
+	if len(opts.Listeners) > 0 {
+		var errListeners error
+		if listeners, errListeners = parseListeners(strings.Join(opts.Listeners, ","), tlsCerts != nil); errListeners != nil {
+			return nil, errListeners
+		}
+	}
+
+	// Metrics may be served on a separate address without authentication
+	var metricsListener *Listener
+	if len(opts.Metrics.Listener) > 0 {
+		metricsListeners, errMetricsListener := parseListeners(opts.Metrics.Listener, tlsCerts != nil)
+		if errMetricsListener != nil {
+			return nil, errMetricsListener
+		}
+		if len(metricsListeners) > 1 {
+			return nil, errors.New("metrics can only be served on one separate listener")
+		}
+		metricsListener = metricsListeners[0]
+	}
+
+	// Session tokens carry the identity of the session, so with a configured secret they're restored after a restart
+	// or by other instances; without one, a random secret limits them to this process
+	sessionSecret := []byte(opts.Sessions.Secret)
+	if len(sessionSecret) == 0 {
+		sessionSecret = make([]byte, 32)
+		if _, errRandom := rand.Read(sessionSecret); errRandom != nil {
+			return nil, fmt.Errorf("unable to generate session secret: %v", errRandom)
+		}
+	}
+	// Quotas of the quota file continue where the previous process stopped
+	rateLimiter, errRateLimiter := newRateLimiter(opts.RateLimits)
+	if errRateLimiter != nil {
+		return nil, errRateLimiter
+	}
+	// Signed requests are accepted within the clock skew in both directions
+	signatureMaxSkew := withDefaultDuration(opts.SignatureMaxSkew, 5*time.Minute)
+
 	// Initialize EthereumValidatorServer
 	eventServer := &EthereumValidatorServer{
-		port:               strconv.Itoa(servicePort),
-		inlineServer:       http.Server{},
-		activeHTTPSessions: make(map[string]*EthereumValidatorHTTPSessionHandler),
-		connMtx:            sync.RWMutex{},
+		stopRequested:         make(chan struct{}),
+		stopped:               make(chan struct{}),
+		draining:              make(chan struct{}),
+		drainTimeout:          withDefaultDuration(opts.DrainTimeout, 30*time.Second),
+		handleSignals:         opts.HandleSignals,
+		listeners:             listeners,
+		inlineServer:          http.Server{ConnContext: listenerConnContext},
+		metricsListener:       metricsListener,
+		keystore:              keystore,
+		logger:                logger,
+		securityLog:           securityLog,
+		validation:            validationService,
+		sessionSecret:         sessionSecret,
+		sessionTTL:            withDefaultDuration(opts.Sessions.TTL, 15*time.Minute),
+		sessionMaxLifetime:    withDefaultDuration(opts.Sessions.MaxLifetime, 24*time.Hour),
+		sessionSlidingExpiry:  !opts.Sessions.DisableSlidingExpiry,
+		verifySessionIdentity: !opts.Sessions.DisableIdentityCheck,
+		siweNonces:            newNonceStore(siweNonceTTL),
+		validatorChallenges:   newNonceStore(validatorChallengeTTL),
+		signatureNonces:       newNonceStore(2 * signatureMaxSkew),
+		signatureMaxSkew:      signatureMaxSkew,
+		siweDomain:            opts.Siwe.Domain,
+		siweScheme:            opts.Siwe.Scheme,
+		siweDefaultScopes:     opts.Siwe.DefaultScopes,
+		rateLimiter:           rateLimiter,
+		authGuard:             newAuthGuard(opts.AuthGuard, securityLog),
+		trustedProxies:        trustedProxies,
+		ipRules:               ipRules,
+		keystoreReload:        withDefaultDuration(opts.KeystoreReloadInterval, 5*time.Second),
+		tlsCerts:              tlsCerts,
+		tlsReload:             withDefaultDuration(opts.TLS.ReloadInterval, 5*time.Second),
+		activeHTTPSessions:    make(map[string]*EthereumValidatorHTTPSessionHandler),
+		endedHTTPSessions:     make(map[string]time.Time),
+		identitySessions:      make(map[string][]*EthereumValidatorHTTPSessionHandler),
+		sessionMaxPerIdentity: opts.Sessions.MaxPerIdentity,
+		connMtx:               sync.RWMutex{},
+	}
+	if eventServer.sessionMaxPerIdentity <= 0 {
+		eventServer.sessionMaxPerIdentity = 16
 	}
+	if len(eventServer.siweScheme) == 0 {
+		eventServer.siweScheme = "https"
+	}
+
+	eventServer.metrics = newServerMetrics(eventServer)
+	// Jobs are kept in their directory and resume after a restart
+	jobs, errJobs := newJobManager(opts.Jobs, validationService, eventServer.metrics, logger)
+	if errJobs != nil {
+		return nil, errJobs
+	}
+	eventServer.jobs = jobs
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", eventServer.metrics.handler())
+	eventServer.metricsServer.Handler = metricsMux
 
 	// Init Router
-	router := GetApiRouter()
+	router := GetApiRouter(logger)
 	AddCors(router)
 	AddRoutes(router)
+	if opts.Routes != nil {
+		router.Group(opts.Routes)
+	}
 
 	// Init request handler & register with event bus
 	requestHandler := &validatorServerRequestHandler{
 		server: eventServer,
 		router: router,
 	}
-	eventServer.inlineServer.Handler = requestHandler
+	eventServer.inlineServer.Handler = eventServer.trackRequests(eventServer.observeRequests(requestHandler))
 
 	// Add shutdown handler for inline server
-	eventServer.inlineServer.RegisterOnShutdown(server.OnShutdown)
+	eventServer.inlineServer.RegisterOnShutdown(eventServer.OnShutdown)
 
 	return eventServer, nil
 }
 
-func (e *EthereumValidatorServer) Start(ctx context.Context) {
+// ServeHTTP handles a request like the listeners of Start do; requests of embedders always require authentication
+func (e *EthereumValidatorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.inlineServer.Handler.ServeHTTP(w, r)
+}
+
+// RunMaintenance expires sessions, nonces and rate limit state, applies changes of the keystore and TLS files and runs
+// the queued jobs, until the context is done. Start runs it; embedders serving the server as http.Handler need to run it themselves.
+func (e *EthereumValidatorServer) RunMaintenance(ctx context.Context) {
+	// Apply changes of the keystore file, e.g. by the keys command, without a restart
+	if keystorePath := e.keystore.GetPath(); len(keystorePath) > 0 {
+		go watchFile(ctx, keystorePath, e.keystoreReload, e.logger, e.reloadKeystore)
+	}
+	if e.tlsCerts != nil {
+		e.tlsCerts.watch(ctx, e.tlsReload)
+	}
+	if e.jobs != nil {
+		e.jobs.start(ctx)
+	}
+	// Remove sessions which expired without a logout and unused sign-in nonces and challenges
+	e.expireHTTPSessions(ctx)
+}
+
+// Start serves requests until Stop is called, the context is done or, if signals are handled, the process receives SIGINT or SIGTERM.
+// It returns an error wrapping ErrStartFailed if the listeners can't be opened and one wrapping ErrShutdownFailed
+// if in-flight requests didn't complete within the drain timeout.
+func (e *EthereumValidatorServer) Start(ctx context.Context) error {
+	defer close(e.stopped)
+	// Background tasks end with Start
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Init shutdown Hook for Ctrl+C / Interrupt shutdown
-	go shutdownHook()
+	if e.handleSignals {
+		go e.shutdownHook(ctx)
+	}
+	go e.RunMaintenance(ctx)
 
 	// Start Request Handling
-	if errComms := server.OpenComms(); errComms != nil {
-		log.Fatalf(constants.ErrApiServerStart, errComms.Error())
+	if errComms := e.OpenComms(); errComms != nil {
+		return fmt.Errorf("%w: %v", ErrStartFailed, fmt.Sprintf(constants.ErrApiServerStart, errComms.Error()))
 	}
+	// Report readiness and liveness to systemd if running as a notify service
+	go e.notifyReady(ctx)
+	go e.runWatchdog(ctx)
+
+	// Run till stopped or cancelled
+	select {
+	case <-e.stopRequested:
+	case <-ctx.Done():
+	}
+	if errShutdown := e.shutdown(); errShutdown != nil {
+		return fmt.Errorf("%w: %v", ErrShutdownFailed, errShutdown)
+	}
+	return nil
+}
 
-	// Run till cancelled
-	for {
-		select {
-		case <-exitSignalReceived:
-			if server != nil {
-				err := server.shutdown()
-				if err != nil {
-					log.Warnf(constants.ErrShutdownFailed, err)
-				}
-
-			}
-			return
-		}
+// Stop ends Start and waits until the shutdown completed or the context is done
+func (e *EthereumValidatorServer) Stop(ctx context.Context) error {
+	e.requestStop()
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func (e *EthereumValidatorServer) Stop(ctx context.Context) {
-	// Create channel to wait for shutdown
-	shutdownComplete = make(chan bool)
-	// Push to shutdown channel
-	exitSignalReceived <- true
-	// Wait for shutdown to complete before returning
-	<-shutdownComplete
+func (e *EthereumValidatorServer) requestStop() {
+	e.stopOnce.Do(func() { close(e.stopRequested) })
+}
+
+// ExitCode returns the process exit code for the result of Start
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return constants.ExitCodeOK
+	case errors.Is(err, ErrShutdownFailed):
+		return constants.ExitCodeShutdownFailed
+	default:
+		return constants.ExitCodeStartFailed
+	}
 }
 
 func (e *EthereumValidatorServer) OpenComms() error {
-	if e.isServingRequests {
+	if e.isServingRequests.Load() {
 		return errors.New("api server already active")
 	}
+	if len(e.listeners) == 0 {
+		return errors.New("no listeners configured")
+	}
 
-	go func(k *EthereumValidatorServer) {
-		// Open Port
-		listener, err := net.Listen("tcp", fmt.Sprintf(":%v", k.port))
-		if err != nil {
-			log.Error(fmt.Errorf("failed to listen: %v", err))
+	// Bind all listeners before serving, so a failing one stops the server instead of leaving it half reachable
+	netListeners := make([]net.Listener, 0, len(e.listeners))
+	for _, listener := range e.listeners {
+		netListener, errListen := listener.listen(e.tlsCerts)
+		if errListen != nil {
+			for _, opened := range netListeners {
+				opened.Close()
+			}
+			return errListen
 		}
-
-		// Start serving with the API server
-		log.Infof("Starting API server on %v", listener.Addr())
-		if err = k.inlineServer.Serve(listener); err != nil {
-			log.Error(fmt.Errorf("failed to serve: %v", err))
+		netListeners = append(netListeners, netListener)
+	}
+	var metricsNetListener net.Listener
+	if e.metricsListener != nil {
+		var errListen error
+		if metricsNetListener, errListen = e.metricsListener.listen(e.tlsCerts); errListen != nil {
+			for _, opened := range netListeners {
+				opened.Close()
+			}
+			return errListen
 		}
-		k.isServingRequests = true
-	}(e)
+	}
+	e.isServingRequests.Store(true)
+
+	for i, netListener := range netListeners {
+		go func(listener *Listener, netListener net.Listener) {
+			// Start serving with the API server
+			e.logger.Infof("Starting API server on %v (auth: %v, tls: %v)", listener, listener.Auth, listener.TLS)
+			if errServe := e.inlineServer.Serve(netListener); errServe != nil && !errors.Is(errServe, http.ErrServerClosed) {
+				e.logger.Error(fmt.Errorf("failed to serve on %v: %v", listener, errServe))
+			}
+		}(e.listeners[i], netListener)
+	}
+	if metricsNetListener != nil {
+		go func() {
+			e.logger.Infof("Serving metrics on %v (tls: %v)", e.metricsListener, e.metricsListener.TLS)
+			if errServe := e.metricsServer.Serve(metricsNetListener); errServe != nil && !errors.Is(errServe, http.ErrServerClosed) {
+				e.logger.Error(fmt.Errorf("failed to serve metrics on %v: %v", e.metricsListener, errServe))
+			}
+		}()
+	}
 
 	return nil
 }
 
+// AddHTTPHandler stores a new session; if its identity reached the maximum number of sessions, the oldest one ends
 func (e *EthereumValidatorServer) AddHTTPHandler(h *EthereumValidatorHTTPSessionHandler) {
 	defer e.connMtx.Unlock()
 	e.connMtx.Lock()
 	h.handlerId = uuid.New().String()
+	e.addHTTPHandler(h)
+}
+
+// addHTTPHandler stores the session under its id; the caller holds connMtx
+func (e *EthereumValidatorServer) addHTTPHandler(h *EthereumValidatorHTTPSessionHandler) {
 	e.activeHTTPSessions[h.handlerId] = h
-	log.Infof("Added new http session handler '%v'", h.handlerId)
+	identity := h.GetIdentity()
+	sessions := append(e.identitySessions[identity], h)
+	for len(sessions) > e.sessionMaxPerIdentity {
+		delete(e.activeHTTPSessions, sessions[0].handlerId)
+		e.endedHTTPSessions[sessions[0].handlerId] = sessions[0].createdAt.Add(e.sessionMaxLifetime)
+		e.logger.Infof("Removed http session handler '%v'; %v has %v sessions", sessions[0].handlerId, identity, e.sessionMaxPerIdentity)
+		sessions = sessions[1:]
+	}
+	e.identitySessions[identity] = sessions
+	e.logger.Infof("Added new http session handler '%v'", h.handlerId)
 }
 
 func (e *EthereumValidatorServer) RemoveHTTPHandler(handlerId string) {
 	defer e.connMtx.Unlock()
 	e.connMtx.Lock()
-	if _, ok := e.activeHTTPSessions[handlerId]; !ok {
-		log.Warnf("Unable to remove http session handler '%v'. Handler not found.", handlerId)
+	handler, ok := e.activeHTTPSessions[handlerId]
+	if !ok {
+		e.logger.Warnf("Unable to remove http session handler '%v'. Handler not found.", handlerId)
 		return
 	}
 	delete(e.activeHTTPSessions, handlerId)
-	log.Infof("Removed http session handler '%v'", handlerId)
+	e.endedHTTPSessions[handlerId] = handler.createdAt.Add(e.sessionMaxLifetime)
+	identity := handler.GetIdentity()
+	sessions := make([]*EthereumValidatorHTTPSessionHandler, 0, len(e.identitySessions[identity]))
+	for _, session := range e.identitySessions[identity] {
+		if session != handler {
+			sessions = append(sessions, session)
+		}
+	}
+	if len(sessions) == 0 {
+		delete(e.identitySessions, identity)
+	} else {
+		e.identitySessions[identity] = sessions
+	}
+	e.logger.Infof("Removed http session handler '%v'", handlerId)
 }
 
-func (e *EthereumValidatorServer) OnShutdown() {
-	log.Warnf("Gracefully shutting down %v...", constants.AppName)
-	// Close all active connections
-	defer time.Sleep(time.Second * 5)
-	defer fmt.Println("... done! Stopping process in 5 seconds...")
+// findApiKeySession returns an unexpired session of the API key created from the IP, so clients authenticating
+// every request with their key don't create a session per request
+func (e *EthereumValidatorServer) findApiKeySession(apiKey *ApiKey, originIP string) *EthereumValidatorHTTPSessionHandler {
+	e.connMtx.RLock()
+	defer e.connMtx.RUnlock()
+	sessions := e.identitySessions["key:"+apiKey.Id]
+	for i := len(sessions) - 1; i >= 0; i-- {
+		if sessions[i].originIP == originIP && !sessions[i].isExpired() {
+			return sessions[i]
+		}
+	}
+	return nil
+}
+
+// GetHTTPSession returns the session referenced by a signed session token; sessions unknown to this process are
+// restored from the token unless they ended here
+func (e *EthereumValidatorServer) GetHTTPSession(token string) (*EthereumValidatorHTTPSessionHandler, error) {
+	payload, errToken := parseSessionToken(e.sessionSecret, token)
+	if errToken != nil {
+		return nil, errToken
+	}
+	e.connMtx.RLock()
+	handler, ok := e.activeHTTPSessions[payload.SessionId]
+	_, ended := e.endedHTTPSessions[payload.SessionId]
+	e.connMtx.RUnlock()
+	if ok && handler != nil {
+		return handler, nil
+	}
+	if ended {
+		// Logged out or replaced by a newer session
+		return nil, errInvalidSessionToken
+	}
+
+	restored, errRestore := e.restoreSession(payload)
+	if errRestore != nil {
+		return nil, errInvalidSessionToken
+	}
+	e.connMtx.Lock()
 	defer e.connMtx.Unlock()
+	// Another request may have restored or ended the session meanwhile
+	if handler, ok = e.activeHTTPSessions[payload.SessionId]; ok {
+		return handler, nil
+	}
+	if _, ended = e.endedHTTPSessions[payload.SessionId]; ended {
+		return nil, errInvalidSessionToken
+	}
+	e.addHTTPHandler(restored)
+	e.logger.Infof("Restored http session handler '%v' from its token", restored.handlerId)
+	return restored, nil
+}
+
+func (e *EthereumValidatorServer) expireHTTPSessions(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.saveQuotas()
+			return
+		case <-ticker.C:
+		}
+		expired := make([]string, 0)
+		e.connMtx.RLock()
+		for handlerId, handler := range e.activeHTTPSessions {
+			if handler != nil && handler.isExpired() {
+				expired = append(expired, handlerId)
+			}
+		}
+		e.connMtx.RUnlock()
+		for _, handlerId := range expired {
+			e.RemoveHTTPHandler(handlerId)
+		}
+		e.expireEndedHTTPSessions()
+		e.siweNonces.expire()
+		e.validatorChallenges.expire()
+		e.signatureNonces.expire()
+		e.rateLimiter.expire()
+		e.authGuard.expire()
+		e.saveQuotas()
+	}
+}
+
+func (e *EthereumValidatorServer) saveQuotas() {
+	if e.rateLimiter == nil {
+		return
+	}
+	if errSave := e.rateLimiter.saveQuotas(); errSave != nil {
+		e.logger.Errorf("failed to save quotas: %v", errSave)
+	}
+}
+
+// expireEndedHTTPSessions forgets ended sessions whose tokens can no longer be valid
+func (e *EthereumValidatorServer) expireEndedHTTPSessions() {
 	e.connMtx.Lock()
-	for name, _ := range e.activeHTTPSessions {
-		e.activeHTTPSessions[name] = nil
+	defer e.connMtx.Unlock()
+	now := time.Now()
+	for handlerId, endsAt := range e.endedHTTPSessions {
+		if now.After(endsAt) {
+			delete(e.endedHTTPSessions, handlerId)
+		}
+	}
+}
+
+func (e *EthereumValidatorServer) reloadKeystore() {
+	if errReload := e.keystore.Reload(); errReload != nil {
+		e.logger.Errorf("failed to reload keystore, keeping previous keys and rules: %v", errReload)
+		return
+	}
+	e.logger.Infof("Reloaded keystore '%v'", e.keystore.GetPath())
+}
+
+// OnShutdown is called by the HTTP server when the shutdown starts; requests handled from then on close their connection
+func (e *EthereumValidatorServer) OnShutdown() {
+	e.logger.Warnf("Gracefully shutting down %v...", constants.AppName)
+	e.drainOnce.Do(func() { close(e.draining) })
+}
+
+// trackRequests counts in-flight requests, so the shutdown can report what it's waiting for.
+// Requests arriving while the server drains are answered with Connection: close.
+func (e *EthereumValidatorServer) trackRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.inFlight.Add(1)
+		e.inFlightCount.Add(1)
+		defer func() {
+			e.inFlightCount.Add(-1)
+			e.inFlight.Done()
+		}()
+		if e.isDraining() {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (e *EthereumValidatorServer) isDraining() bool {
+	select {
+	case <-e.draining:
+		return true
+	default:
+		return false
 	}
 }
 
-func shutdownHook() {
+// withDefaultDuration returns fallback for unset durations
+func withDefaultDuration(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
 
+// waitInFlight waits until all tracked requests completed or the context is done
+func (e *EthereumValidatorServer) waitInFlight(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdownHook stops the server on SIGINT or SIGTERM; a second signal exits immediately
+func (e *EthereumValidatorServer) shutdownHook(ctx context.Context) {
 	// Initially define termination signal channel
-	shutdownSignalOS := make(chan os.Signal)
+	shutdownSignalOS := make(chan os.Signal, 1)
 	signal.Notify(shutdownSignalOS, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(shutdownSignalOS)
 
-	signalReceived := <-shutdownSignalOS
-	log.Debugf("Caught signal: %+v", signalReceived)
+	select {
+	case signalReceived := <-shutdownSignalOS:
+		e.logger.Debugf("Caught signal: %+v", signalReceived)
+		e.requestStop()
+	case <-ctx.Done():
+		return
+	}
 
-	// Push to shutdown channel
-	exitSignalReceived <- true
+	select {
+	case signalReceived := <-shutdownSignalOS:
+		e.logger.Warnf("Caught signal %+v during shutdown; exiting immediately", signalReceived)
+		os.Exit(constants.ExitCodeShutdownFailed)
+	case <-ctx.Done():
+	}
 }
 
+// shutdown stops accepting connections and waits up to the drain timeout for in-flight requests.
+// Connections still active after the timeout are closed and an error is returned.
 func (e *EthereumValidatorServer) shutdown() error {
-	log.Info("Shutting down API server...")
+	e.logger.Info("Shutting down API server...")
+	if errNotify := sdNotify("STOPPING=1"); errNotify != nil {
+		e.logger.Warn(errNotify)
+	}
+	if !e.isServingRequests.Load() {
+		e.logger.Info("Shutdown complete.")
+		return nil
+	}
 
-	if e.isServingRequests {
-		// Stop the API server
-		errShutdown := e.inlineServer.Shutdown(context.Background())
+	drainCtx, cancel := context.WithTimeout(context.Background(), e.drainTimeout)
+	defer cancel()
+	// Count the requests of the drained connections as well
+	defer e.saveQuotas()
+	e.logger.Infof("Draining %v in-flight requests for up to %v", e.inFlightCount.Load(), e.drainTimeout)
+	errShutdown := e.inlineServer.Shutdown(drainCtx)
+	e.isServingRequests.Store(false)
+	// Scrapes are short; they don't need to be drained
+	if errMetrics := e.metricsServer.Close(); errMetrics != nil {
+		e.logger.Warnf("failed to close metrics listener: %v", errMetrics)
+	}
+	if errShutdown != nil {
+		e.logger.Warnf("%v requests still in flight after the drain timeout; closing their connections", e.inFlightCount.Load())
+		if errClose := e.inlineServer.Close(); errClose != nil {
+			e.logger.Warnf("failed to close connections: %v", errClose)
+		}
 		return fmt.Errorf(constants.ErrApiServerStop, errShutdown.Error())
 	}
+	// Handlers of hijacked connections aren't covered by Shutdown; they get what's left of the drain timeout
+	if errWait := e.waitInFlight(drainCtx); errWait != nil {
+		e.logger.Warnf("%v requests still in flight after the drain timeout", e.inFlightCount.Load())
+		return fmt.Errorf(constants.ErrApiServerStop, errWait.Error())
+	}
 
-	log.Info("Shutdown complete.")
+	// Sessions end with the process; with a configured secret their tokens restore them on the next start
+	e.connMtx.Lock()
+	e.activeHTTPSessions = make(map[string]*EthereumValidatorHTTPSessionHandler)
+	e.identitySessions = make(map[string][]*EthereumValidatorHTTPSessionHandler)
+	e.connMtx.Unlock()
 
+	e.logger.Info("Shutdown complete.")
 	return nil
 }
@@ -0,0 +1,119 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"github.com/runtimeracer/ethereum-validator-go/constants"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startTestServer serves the handler on a free local port and returns its URL and the result of Start
+func startTestServer(t *testing.T, testServer *EthereumValidatorServer, handler http.Handler) (string, chan error) {
+	free, errListen := net.Listen("tcp", "127.0.0.1:0")
+	if errListen != nil {
+		t.Fatal(errListen)
+	}
+	address := free.Addr().String()
+	free.Close()
+	testServer.listeners, _ = parseListeners("tcp://"+address, false)
+	testServer.inlineServer = http.Server{Handler: testServer.trackRequests(handler)}
+	testServer.inlineServer.RegisterOnShutdown(testServer.OnShutdown)
+
+	result := make(chan error, 1)
+	go func() { result <- testServer.Start(context.Background()) }()
+	for i := 0; i < 100 && !testServer.isServingRequests.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "http://" + address, result
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	testServer := newTestRequestHandler(NewDefaultKeystore("key")).server
+	requestStarted := make(chan struct{})
+	url, result := startTestServer(t, testServer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requestStarted)
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(200)
+	}))
+
+	// The in-flight request completes although the shutdown starts while it's handled
+	responseCode := make(chan int, 1)
+	go func() {
+		response, errRequest := http.Get(url)
+		if errRequest != nil {
+			responseCode <- 0
+			return
+		}
+		response.Body.Close()
+		responseCode <- response.StatusCode
+	}()
+	<-requestStarted
+	if errStop := testServer.Stop(context.Background()); errStop != nil {
+		t.Fatal(errStop)
+	}
+	if code := <-responseCode; code != 200 {
+		t.Errorf("expected in-flight request to complete, got %v", code)
+	}
+	if errStart := <-result; errStart != nil || ExitCode(errStart) != constants.ExitCodeOK {
+		t.Errorf("expected clean shutdown, got %v", errStart)
+	}
+	// Stopping again returns immediately
+	if errStop := testServer.Stop(context.Background()); errStop != nil {
+		t.Error(errStop)
+	}
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	testServer := newTestRequestHandler(NewDefaultKeystore("key")).server
+	testServer.drainTimeout = 50 * time.Millisecond
+	requestStarted := make(chan struct{})
+	url, result := startTestServer(t, testServer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requestStarted)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+
+	go http.Get(url)
+	<-requestStarted
+	testServer.requestStop()
+	errStart := <-result
+	if !errors.Is(errStart, ErrShutdownFailed) || ExitCode(errStart) != constants.ExitCodeShutdownFailed {
+		t.Errorf("expected drain timeout, got %v", errStart)
+	}
+}
+
+func TestShutdownHijackedConnectionTimeout(t *testing.T) {
+	testServer := newTestRequestHandler(NewDefaultKeystore("key")).server
+	testServer.drainTimeout = 50 * time.Millisecond
+	requestStarted := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	url, result := startTestServer(t, testServer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, errHijack := w.(http.Hijacker).Hijack()
+		if errHijack != nil {
+			t.Error(errHijack)
+			return
+		}
+		defer conn.Close()
+		close(requestStarted)
+		// Shutdown doesn't track hijacked connections, so only the drain timeout ends the wait for the handler
+		<-release
+	}))
+
+	go http.Get(url)
+	<-requestStarted
+	testServer.requestStop()
+	select {
+	case errStart := <-result:
+		if !errors.Is(errStart, ErrShutdownFailed) || ExitCode(errStart) != constants.ExitCodeShutdownFailed {
+			t.Errorf("expected drain timeout, got %v", errStart)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected shutdown to end after the drain timeout")
+	}
+}
@@ -5,12 +5,23 @@ Copyright © 2024 RuntimeRacer
 package apiserver
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/spf13/viper"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errInvalidSessionToken = errors.New("invalid session token")
+	errSessionExpired      = errors.New("session expired")
 )
 
 type EthereumValidatorHTTPSessionHandler struct {
@@ -19,9 +30,40 @@ type EthereumValidatorHTTPSessionHandler struct {
 	server    *EthereumValidatorServer
 	// Request Metadata
 	originIP string
+	// Identity; sessions are authenticated either with an API key or by signing in with an address
+	apiKey  *ApiKey
+	address *AddressRule
+	// Validators the session proved ownership of; such sessions have no scopes apart from these validators
+	validators       []validation.ValidatorStatus
+	validatorNetwork string
+	// Listener with auth=none the request was received on; such sessions only exist for a single request
+	trustedListener string
+	// Lifetime
+	createdAt time.Time
+	expiresAt time.Time
+	mtx       sync.RWMutex
+}
+
+// sessionToken is the payload of the signed token returned in the Validator-Session-Id header.
+// It carries the identity of the session, so a session unknown to this process is restored from its token.
+type sessionToken struct {
+	SessionId        string                  `json:"sid"`
+	ExpiresAt        int64                   `json:"exp"`
+	CreatedAt        int64                   `json:"iat"`
+	OriginIP         string                  `json:"ip"`
+	KeyId            string                  `json:"key,omitempty"`
+	Address          string                  `json:"addr,omitempty"`
+	ValidatorNetwork string                  `json:"net,omitempty"`
+	Validators       []sessionTokenValidator `json:"val,omitempty"`
 }
 
-func (h *EthereumValidatorHTTPSessionHandler) init(server *EthereumValidatorServer, requestOrigin string) error {
+// sessionTokenValidator is a validator the session proved ownership of
+type sessionTokenValidator struct {
+	Index  uint64 `json:"i"`
+	Pubkey string `json:"p"`
+}
+
+func (h *EthereumValidatorHTTPSessionHandler) init(server *EthereumValidatorServer, requestOrigin string, apiKey *ApiKey) error {
 	// Parse Request Origin
 	originIP, _, err := net.SplitHostPort(requestOrigin)
 	if err != nil {
@@ -31,8 +73,13 @@ func (h *EthereumValidatorHTTPSessionHandler) init(server *EthereumValidatorServ
 	// Store initial Origin IP
 	h.originIP = originIP
 
-	// Store server pointer
+	// Store server pointer and the key the session was authenticated with
 	h.server = server
+	h.apiKey = apiKey
+
+	// Sessions start with a full TTL
+	h.createdAt = time.Now()
+	h.expiresAt = h.createdAt.Add(server.sessionTTL)
 	return nil
 }
 
@@ -41,16 +88,27 @@ func (h *EthereumValidatorHTTPSessionHandler) GetId() string {
 }
 
 func (h *EthereumValidatorHTTPSessionHandler) ValidateRequest(request *http.Request) error {
-	// Get Required Headers and request info
-	// We check for a Remote IP and the API key
-	apiKey := request.Header.Get("Validator-Api-Key")
-	if len(request.RemoteAddr) == 0 || len(apiKey) == 0 {
-		return errors.New("session init headers invalid")
+	if h.isExpired() {
+		return errSessionExpired
 	}
-	requestAPIKey := viper.GetString("DEFAULT_API_KEY")
-	if requestAPIKey != apiKey {
-		return errors.New("invalid api key")
+	// The key or address rule may have been revoked or may have expired since the session was created;
+	// a reloaded keystore also replaces the scopes, limits and IP rules of the key
+	if apiKey := h.GetApiKey(); apiKey != nil {
+		currentKey, errKey := h.server.keystore.GetKey(apiKey.Id)
+		if errKey != nil {
+			return errKey
+		}
+		h.mtx.Lock()
+		h.apiKey = currentKey
+		h.mtx.Unlock()
+	} else if h.address != nil {
+		if _, errRule := h.server.resolveAddressRule(h.address.Address); errRule != nil {
+			return errRule
+		}
+	} else if len(h.validators) == 0 {
+		return errors.New("session has no identity")
 	}
+
 	// Get origin IP; ensure port is being stripped
 	requestOriginIP := request.RemoteAddr
 	if strings.Contains(requestOriginIP, ":") {
@@ -65,12 +123,187 @@ func (h *EthereumValidatorHTTPSessionHandler) ValidateRequest(request *http.Requ
 	if ipAddress == nil {
 		return fmt.Errorf("invalid request origin: %v", request.RemoteAddr)
 	}
-	if h.originIP != requestOriginIP {
+	// IP rules are checked on every request, so changed rules apply to existing sessions as well
+	if errIP := h.server.checkIPRules(ipAddress, h.GetApiKey()); errIP != nil {
+		return errIP
+	}
+	if h.server.verifySessionIdentity && h.originIP != requestOriginIP {
 		return errors.New("origin IP and request IP mismatch")
 	}
 	return nil
 }
 
+// touch extends the session by its TTL if sliding expiry is enabled, but never beyond the maximum lifetime
+func (h *EthereumValidatorHTTPSessionHandler) touch() {
+	if !h.server.sessionSlidingExpiry {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	expiresAt := time.Now().Add(h.server.sessionTTL)
+	if maxExpiresAt := h.createdAt.Add(h.server.sessionMaxLifetime); expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+	h.expiresAt = expiresAt
+}
+
+func (h *EthereumValidatorHTTPSessionHandler) isExpired() bool {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return time.Now().After(h.expiresAt)
+}
+
+// GetExpiresAt returns the time the session expires unless it's extended
+func (h *EthereumValidatorHTTPSessionHandler) GetExpiresAt() time.Time {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.expiresAt
+}
+
+// GetToken returns the signed session token to be presented by the client on later requests
+func (h *EthereumValidatorHTTPSessionHandler) GetToken() string {
+	token := sessionToken{
+		SessionId:        h.handlerId,
+		ExpiresAt:        h.GetExpiresAt().Unix(),
+		CreatedAt:        h.createdAt.Unix(),
+		OriginIP:         h.originIP,
+		ValidatorNetwork: h.validatorNetwork,
+	}
+	if apiKey := h.GetApiKey(); apiKey != nil {
+		token.KeyId = apiKey.Id
+	}
+	if h.address != nil {
+		token.Address = h.address.Address
+	}
+	for _, validator := range h.validators {
+		token.Validators = append(token.Validators, sessionTokenValidator{Index: validator.Index, Pubkey: validator.Pubkey})
+	}
+	return signSessionToken(h.server.sessionSecret, token)
+}
+
+// restoreSession recreates the session of a token issued before a restart or by another instance.
+// The key or address rule is resolved again, so revoked identities can't be restored.
+func (e *EthereumValidatorServer) restoreSession(token *sessionToken) (*EthereumValidatorHTTPSessionHandler, error) {
+	h := &EthereumValidatorHTTPSessionHandler{
+		handlerId:        token.SessionId,
+		server:           e,
+		originIP:         token.OriginIP,
+		validatorNetwork: token.ValidatorNetwork,
+		createdAt:        time.Unix(token.CreatedAt, 0),
+		expiresAt:        time.Unix(token.ExpiresAt, 0),
+	}
+	switch {
+	case len(token.KeyId) > 0:
+		apiKey, errKey := e.keystore.GetKey(token.KeyId)
+		if errKey != nil {
+			return nil, errKey
+		}
+		h.apiKey = apiKey
+	case len(token.Address) > 0:
+		rule, errRule := e.resolveAddressRule(token.Address)
+		if errRule != nil {
+			return nil, errRule
+		}
+		h.address = rule
+	case len(token.Validators) > 0:
+		for _, validator := range token.Validators {
+			h.validators = append(h.validators, validation.ValidatorStatus{Index: validator.Index, Pubkey: validator.Pubkey})
+		}
+	default:
+		return nil, errInvalidSessionToken
+	}
+	return h, nil
+}
+
 func (h *EthereumValidatorHTTPSessionHandler) finalize() {
 	h.server.RemoveHTTPHandler(h.handlerId)
 }
+
+func (h *EthereumValidatorHTTPSessionHandler) GetApiKey() *ApiKey {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.apiKey
+}
+
+func (h *EthereumValidatorHTTPSessionHandler) GetAddress() *AddressRule {
+	return h.address
+}
+
+// GetIdentity returns the name rate limits and quotas of the session are counted under
+func (h *EthereumValidatorHTTPSessionHandler) GetIdentity() string {
+	apiKey := h.GetApiKey()
+	switch {
+	case apiKey != nil:
+		return "key:" + apiKey.Id
+	case h.address != nil:
+		return "address:" + h.address.Address
+	case len(h.trustedListener) > 0:
+		return "listener:" + h.trustedListener
+	default:
+		return "validators:" + h.handlerId
+	}
+}
+
+// HasScope returns true if the identity of the session grants the scope
+func (h *EthereumValidatorHTTPSessionHandler) HasScope(scope string) bool {
+	if apiKey := h.GetApiKey(); apiKey != nil {
+		return apiKey.HasScope(scope)
+	}
+	if h.address != nil {
+		return h.address.HasScope(scope)
+	}
+	// Trusted listeners without a key grant all scopes
+	return len(h.trustedListener) > 0
+}
+
+// HasValidator returns true if the session proved ownership of the validator with the given pubkey or index
+func (h *EthereumValidatorHTTPSessionHandler) HasValidator(network, id string) bool {
+	if network != h.validatorNetwork {
+		return false
+	}
+	for _, validator := range h.validators {
+		if validator.Matches(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// signSessionToken encodes the token as base64url(payload).base64url(HMAC-SHA256(payload))
+func signSessionToken(secret []byte, token sessionToken) string {
+	payload, _ := json.Marshal(token)
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encodedPayload))
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseSessionToken verifies the signature and expiry of a session token
+func parseSessionToken(secret []byte, value string) (*sessionToken, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, errInvalidSessionToken
+	}
+	signature, errSignature := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if errSignature != nil {
+		return nil, errInvalidSessionToken
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encodedPayload))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errInvalidSessionToken
+	}
+
+	payload, errPayload := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if errPayload != nil {
+		return nil, errInvalidSessionToken
+	}
+	token := &sessionToken{}
+	if errDecode := json.Unmarshal(payload, token); errDecode != nil {
+		return nil, errInvalidSessionToken
+	}
+	if time.Now().Unix() > token.ExpiresAt {
+		return nil, errSessionExpired
+	}
+	return token, nil
+}
@@ -0,0 +1,204 @@
+package apiserver
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionToken(t *testing.T) {
+	secret := []byte("secret")
+	token := signSessionToken(secret, sessionToken{SessionId: "abc", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+
+	payload, errParse := parseSessionToken(secret, token)
+	if errParse != nil || payload.SessionId != "abc" {
+		t.Fatalf("expected valid token, got %+v (%v)", payload, errParse)
+	}
+	if _, errParse = parseSessionToken([]byte("other"), token); errParse != errInvalidSessionToken {
+		t.Errorf("expected invalid token for wrong secret, got %v", errParse)
+	}
+	if _, errParse = parseSessionToken(secret, strings.Replace(token, ".", "x.", 1)); errParse != errInvalidSessionToken {
+		t.Errorf("expected invalid token for modified payload, got %v", errParse)
+	}
+
+	expired := signSessionToken(secret, sessionToken{SessionId: "abc", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if _, errParse = parseSessionToken(secret, expired); errParse != errSessionExpired {
+		t.Errorf("expected expired token, got %v", errParse)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	handler := newTestRequestHandler(NewDefaultKeystore("key"))
+
+	request := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		return testRequest(handler, method, path, "", headers)
+	}
+
+	// Authenticate with the API key; the session token is returned
+	response := request("GET", "/time/slot/0", map[string]string{"Validator-Api-Key": "key"})
+	token := response.Header().Get("Validator-Session-Id")
+	if response.Code != 200 || len(token) == 0 {
+		t.Fatalf("expected session token, got %v %q", response.Code, token)
+	}
+
+	// The token alone is sufficient for later requests
+	response = request("GET", "/time/slot/0", map[string]string{"Validator-Session-Id": token})
+	if response.Code != 200 {
+		t.Fatalf("expected session to be resumed, got %v", response.Code)
+	}
+
+	// Logout invalidates the token
+	response = request("POST", "/auth/logout", map[string]string{"Validator-Session-Id": token})
+	if response.Code != 204 {
+		t.Fatalf("expected logout, got %v", response.Code)
+	}
+	response = request("GET", "/time/slot/0", map[string]string{"Validator-Session-Id": token})
+	if response.Code != 401 {
+		t.Errorf("expected logged out session to be rejected, got %v", response.Code)
+	}
+}
+
+func TestApiKeySessions(t *testing.T) {
+	handler := newTestRequestHandler(NewDefaultKeystore("key"))
+	handler.server.sessionMaxPerIdentity = 2
+
+	// authenticate sends a request with the API key and returns the session token
+	authenticate := func(remoteAddr string) (string, string) {
+		req := httptest.NewRequest("GET", "/time/slot/0", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Validator-Api-Key", "key")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		token := recorder.Header().Get("Validator-Session-Id")
+		payload, errToken := parseSessionToken(handler.server.sessionSecret, token)
+		if recorder.Code != 200 || errToken != nil {
+			t.Fatalf("expected session token, got %v (%v)", recorder.Code, errToken)
+		}
+		return payload.SessionId, token
+	}
+	activeSessions := func() int {
+		handler.server.connMtx.RLock()
+		defer handler.server.connMtx.RUnlock()
+		return len(handler.server.activeHTTPSessions)
+	}
+
+	// Requests authenticated with the key share a session instead of creating one each
+	first, firstToken := authenticate("192.0.2.1:1234")
+	for i := 0; i < 3; i++ {
+		if sessionId, _ := authenticate("192.0.2.1:1234"); sessionId != first {
+			t.Errorf("expected session %v to be reused, got %v", first, sessionId)
+		}
+	}
+	if count := activeSessions(); count != 1 {
+		t.Errorf("expected 1 session, got %v", count)
+	}
+
+	// Other IPs get their own session, up to the maximum per identity; the oldest session ends
+	second, _ := authenticate("192.0.2.2:1234")
+	third, _ := authenticate("192.0.2.3:1234")
+	if second == first || third == first || third == second {
+		t.Error("expected new sessions for other IPs")
+	}
+	if count := activeSessions(); count != 2 {
+		t.Errorf("expected sessions to be limited to 2, got %v", count)
+	}
+	if response := testRequest(handler, "GET", "/time/slot/0", "", map[string]string{"Validator-Session-Id": firstToken}); response.Code != 401 {
+		t.Errorf("expected oldest session to end, got %v", response.Code)
+	}
+	if sessionId, _ := authenticate("192.0.2.3:1234"); sessionId != third {
+		t.Errorf("expected session %v to be reused, got %v", third, sessionId)
+	}
+}
+
+func TestSessionRestoredFromToken(t *testing.T) {
+	keystore := NewDefaultKeystore("key")
+	first := newTestRequestHandler(keystore)
+	response := testRequest(first, "GET", "/time/slot/0", "", map[string]string{"Validator-Api-Key": "key"})
+	token := response.Header().Get("Validator-Session-Id")
+	if response.Code != 200 || len(token) == 0 {
+		t.Fatalf("expected session token, got %v", response.Code)
+	}
+
+	// Another instance or a restarted one with the same secret accepts the token without the key
+	second := newTestRequestHandler(keystore)
+	session := map[string]string{"Validator-Session-Id": token}
+	if response = testRequest(second, "GET", "/time/slot/0", "", session); response.Code != 200 {
+		t.Fatalf("expected session to be restored, got %v: %v", response.Code, response.Body.String())
+	}
+	restored, errSession := second.server.GetHTTPSession(token)
+	if errSession != nil || restored.GetIdentity() != "key:"+defaultApiKeyId {
+		t.Errorf("expected restored session of the default key, got %v", errSession)
+	}
+
+	// Other secrets don't accept the token
+	other := newTestRequestHandler(keystore)
+	other.server.sessionSecret = []byte("other")
+	if response = testRequest(other, "GET", "/time/slot/0", "", session); response.Code != 401 {
+		t.Errorf("expected token of another secret to be rejected, got %v", response.Code)
+	}
+
+	// Tokens of logged out sessions aren't restored again
+	if response = testRequest(second, "POST", "/auth/logout", "", session); response.Code != 204 {
+		t.Fatalf("expected logout, got %v", response.Code)
+	}
+	if response = testRequest(second, "GET", "/time/slot/0", "", session); response.Code != 401 {
+		t.Errorf("expected logged out session to be rejected, got %v", response.Code)
+	}
+
+	// Revoked keys aren't restored
+	if errRevoke := keystore.RevokeKey(defaultApiKeyId); errRevoke != nil {
+		t.Fatal(errRevoke)
+	}
+	if response = testRequest(newTestRequestHandler(keystore), "GET", "/time/slot/0", "", session); response.Code != 401 {
+		t.Errorf("expected session of revoked key to be rejected, got %v", response.Code)
+	}
+}
+
+func newTestRequestHandler(keystore *Keystore) *validatorServerRequestHandler {
+	testServer := &EthereumValidatorServer{
+		keystore:              keystore,
+		sessionSecret:         []byte("secret"),
+		sessionTTL:            time.Minute,
+		sessionMaxLifetime:    time.Hour,
+		sessionSlidingExpiry:  true,
+		verifySessionIdentity: true,
+		siweNonces:            newNonceStore(siweNonceTTL),
+		validatorChallenges:   newNonceStore(validatorChallengeTTL),
+		signatureNonces:       newNonceStore(10 * time.Minute),
+		signatureMaxSkew:      5 * time.Minute,
+		siweDomain:            "example.com",
+		siweScheme:            "https",
+		logger:                log.StandardLogger(),
+		securityLog:           log.StandardLogger(),
+		validation:            DefaultValidationService(),
+		authGuard:             newAuthGuard(AuthGuardOptions{}, log.StandardLogger()),
+		activeHTTPSessions:    make(map[string]*EthereumValidatorHTTPSessionHandler),
+		endedHTTPSessions:     make(map[string]time.Time),
+		identitySessions:      make(map[string][]*EthereumValidatorHTTPSessionHandler),
+		sessionMaxPerIdentity: 16,
+		connMtx:               sync.RWMutex{},
+		stopRequested:         make(chan struct{}),
+		stopped:               make(chan struct{}),
+		draining:              make(chan struct{}),
+		drainTimeout:          time.Second,
+	}
+	testServer.metrics = newServerMetrics(testServer)
+	router := GetApiRouter(log.StandardLogger())
+	AddRoutes(router)
+	return &validatorServerRequestHandler{server: testServer, router: router}
+}
+
+func testRequest(handler http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
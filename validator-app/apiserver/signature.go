@@ -0,0 +1,118 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Request signing headers; a signed request replaces the Validator-Api-Key header
+	HeaderKeyId     = "Validator-Key-Id"
+	HeaderTimestamp = "Validator-Timestamp"
+	HeaderNonce     = "Validator-Nonce"
+	HeaderSignature = "Validator-Signature"
+
+	// maxSignedBodySize limits the body which is read to compute the body hash
+	maxSignedBodySize = 1 << 20
+)
+
+var errInvalidSignature = errors.New("invalid request signature")
+
+// RequestSigningPayload returns the canonical payload of a signed request:
+// method, request URI, hex SHA-256 of the body, unix timestamp and nonce, separated by newlines
+func RequestSigningPayload(method, requestURI string, body []byte, timestamp int64, nonce string) []byte {
+	bodyHash := sha256.Sum256(body)
+	return []byte(fmt.Sprintf("%v\n%v\n%v\n%v\n%v", method, requestURI, hex.EncodeToString(bodyHash[:]), timestamp, nonce))
+}
+
+// SignRequest adds the signature headers to the request. The payload is signed with an ed25519 key derived from the secret;
+// the server only stores the public key, so the keystore contents can't sign requests.
+func SignRequest(req *http.Request, keyId, secret string) error {
+	body := make([]byte, 0)
+	if req.Body != nil {
+		var errRead error
+		if body, errRead = io.ReadAll(req.Body); errRead != nil {
+			return errRead
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	nonceBytes := make([]byte, 16)
+	if _, errRandom := rand.Read(nonceBytes); errRandom != nil {
+		return errRandom
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := time.Now().Unix()
+
+	signature := ed25519.Sign(apiKeySigningKey(secret), RequestSigningPayload(req.Method, req.URL.RequestURI(), body, timestamp, nonce))
+	req.Header.Set(HeaderKeyId, keyId)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, hex.EncodeToString(signature))
+	return nil
+}
+
+// isSignedRequest returns true if the request uses the signature scheme
+func isSignedRequest(req *http.Request) bool {
+	return len(req.Header.Get(HeaderSignature)) > 0
+}
+
+// verifyRequestSignature authenticates a signed request. Requests outside the allowed clock skew are rejected,
+// and each nonce is accepted only once while its timestamp is within the window.
+func (e *EthereumValidatorServer) verifyRequestSignature(req *http.Request) (*ApiKey, error) {
+	timestamp, errTimestamp := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if errTimestamp != nil {
+		return nil, fmt.Errorf("%v: invalid timestamp", errInvalidSignature)
+	}
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > e.signatureMaxSkew {
+		return nil, fmt.Errorf("%v: timestamp outside allowed clock skew", errInvalidSignature)
+	}
+	nonce := req.Header.Get(HeaderNonce)
+	if len(nonce) < 16 || len(nonce) > 64 {
+		return nil, fmt.Errorf("%v: nonce must have 16 to 64 characters", errInvalidSignature)
+	}
+	signature, errSignature := hex.DecodeString(req.Header.Get(HeaderSignature))
+	if errSignature != nil {
+		return nil, errInvalidSignature
+	}
+
+	// Read the body and restore it for the route handlers
+	body := make([]byte, 0)
+	if req.Body != nil {
+		var errRead error
+		if body, errRead = io.ReadAll(io.LimitReader(req.Body, maxSignedBodySize+1)); errRead != nil {
+			return nil, fmt.Errorf("%v: unable to read body", errInvalidSignature)
+		}
+		if len(body) > maxSignedBodySize {
+			return nil, fmt.Errorf("%v: body too large", errInvalidSignature)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	payload := RequestSigningPayload(req.Method, req.URL.RequestURI(), body, timestamp, nonce)
+	key, errVerify := e.keystore.VerifySignature(req.Header.Get(HeaderKeyId), payload, signature)
+	if errVerify != nil {
+		return nil, errVerify
+	}
+	// Nonces are remembered per key for the whole window a timestamp can be accepted in
+	if !e.signatureNonces.use(key.Id + ":" + nonce) {
+		return nil, fmt.Errorf("%v: nonce already used", errInvalidSignature)
+	}
+	return key, nil
+}
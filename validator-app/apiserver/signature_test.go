@@ -0,0 +1,95 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignedRequest(t *testing.T) {
+	handler := newTestRequestHandler(NewDefaultKeystore("key"))
+	signedRequest := func(keyId, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/time/slot/0", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if errSign := SignRequest(req, keyId, secret); errSign != nil {
+			t.Fatal(errSign)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if response := signedRequest(defaultApiKeyId, "key"); response.Code != 200 {
+		t.Fatalf("expected signed request to be accepted, got %v: %v", response.Code, response.Body.String())
+	}
+	if response := signedRequest(defaultApiKeyId, "wrong"); response.Code == 200 {
+		t.Error("expected request signed with the wrong secret to be rejected")
+	}
+
+	// Replayed nonce
+	req := httptest.NewRequest("GET", "/time/slot/0", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if errSign := SignRequest(req, defaultApiKeyId, "key"); errSign != nil {
+		t.Fatal(errSign)
+	}
+	for i, expected := range []int{200, 400} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != expected {
+			t.Errorf("attempt %v: expected %v, got %v", i, expected, recorder.Code)
+		}
+	}
+
+	// Timestamp outside of the allowed skew; the signature covers the timestamp, so it's rejected either way
+	req = httptest.NewRequest("GET", "/time/slot/0", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if errSign := SignRequest(req, defaultApiKeyId, "key"); errSign != nil {
+		t.Fatal(errSign)
+	}
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	if _, errVerify := handler.server.verifyRequestSignature(req); errVerify == nil {
+		t.Error("expected stale request to be rejected")
+	}
+}
+
+func TestSignatureNotForgeableFromKeystore(t *testing.T) {
+	keystore := NewDefaultKeystore("key")
+	handler := newTestRequestHandler(keystore)
+	key, _ := keystore.GetKey(defaultApiKeyId)
+
+	// Everything the keystore file holds can't be used as secret to sign requests
+	for _, stored := range []string{key.Hash, key.SigningKey, key.Id} {
+		req := httptest.NewRequest("GET", "/time/slot/0", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if errSign := SignRequest(req, defaultApiKeyId, stored); errSign != nil {
+			t.Fatal(errSign)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code == 200 {
+			t.Errorf("expected request signed with stored value %q to be rejected", stored)
+		}
+	}
+
+	// Keys without a signing key can't sign until they're rotated
+	legacy := &ApiKey{Id: "legacy", Hash: HashApiKeySecret("legacy"), Scopes: []string{ScopeAdmin}, Enabled: true}
+	keystore.Keys = append(keystore.Keys, legacy)
+	payload := RequestSigningPayload("GET", "/time/slot/0", nil, time.Now().Unix(), "nonce")
+	if _, errVerify := keystore.VerifySignature("legacy", payload, make([]byte, 64)); !errors.Is(errVerify, errNoSigningKey) {
+		t.Errorf("expected key without signing key to be rejected, got %v", errVerify)
+	}
+	secret, errRotate := keystore.RotateKey("legacy")
+	if errRotate != nil {
+		t.Fatal(errRotate)
+	}
+	req := httptest.NewRequest("GET", "/time/slot/0", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if errSign := SignRequest(req, "legacy", secret); errSign != nil {
+		t.Fatal(errSign)
+	}
+	if _, errVerify := handler.server.verifyRequestSignature(req); errVerify != nil {
+		t.Errorf("expected rotated key to sign requests, got %v", errVerify)
+	}
+}
@@ -0,0 +1,349 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// siweNonceTTL is the time a client has to sign and submit a message after requesting a nonce
+	siweNonceTTL = 5 * time.Minute
+
+	siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+)
+
+var errInvalidSiweMessage = errors.New("invalid sign-in message")
+
+// siweMessage is an EIP-4361 Sign-In with Ethereum message
+type siweMessage struct {
+	Scheme         string
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainId        uint64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestId      string
+	Resources      []string
+}
+
+// siweVerifyRequest is the body of POST /auth/verify
+type siweVerifyRequest struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// siweVerifyResponse is returned after a successful sign-in; the session token is returned in the response header
+type siweVerifyResponse struct {
+	Address   string   `json:"address"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at"`
+}
+
+// parseSiweMessage parses the EIP-4361 message format
+func parseSiweMessage(message string) (*siweMessage, error) {
+	lines := strings.Split(message, "\n")
+	if len(lines) < 8 || !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return nil, errInvalidSiweMessage
+	}
+	parsed := &siweMessage{Domain: strings.TrimSuffix(lines[0], siweHeaderSuffix)}
+	if scheme, domain, found := strings.Cut(parsed.Domain, "://"); found {
+		parsed.Scheme, parsed.Domain = scheme, domain
+	}
+	parsed.Address = lines[1]
+	if !common.IsHexAddress(parsed.Address) || lines[2] != "" {
+		return nil, errInvalidSiweMessage
+	}
+
+	// The statement is optional and followed by an empty line
+	index := 3
+	if !strings.HasPrefix(lines[index], "URI: ") {
+		if index+1 >= len(lines) || lines[index+1] != "" {
+			return nil, errInvalidSiweMessage
+		}
+		parsed.Statement = lines[index]
+		index += 2
+	}
+
+	// Fields have a fixed order; optional fields may be omitted
+	field := func(prefix string, required bool) (string, error) {
+		if index < len(lines) && strings.HasPrefix(lines[index], prefix) {
+			index++
+			return strings.TrimPrefix(lines[index-1], prefix), nil
+		}
+		if required {
+			return "", fmt.Errorf("%v: missing %v", errInvalidSiweMessage, strings.TrimSuffix(prefix, ": "))
+		}
+		return "", nil
+	}
+	parseTime := func(value string) (*time.Time, error) {
+		if len(value) == 0 {
+			return nil, nil
+		}
+		parsedTime, errTime := time.Parse(time.RFC3339, value)
+		if errTime != nil {
+			return nil, fmt.Errorf("%v: invalid time %v", errInvalidSiweMessage, value)
+		}
+		return &parsedTime, nil
+	}
+
+	var errField error
+	var value string
+	if parsed.URI, errField = field("URI: ", true); errField != nil {
+		return nil, errField
+	}
+	if parsed.Version, errField = field("Version: ", true); errField != nil {
+		return nil, errField
+	}
+	if value, errField = field("Chain ID: ", true); errField != nil {
+		return nil, errField
+	}
+	if parsed.ChainId, errField = strconv.ParseUint(value, 10, 64); errField != nil {
+		return nil, fmt.Errorf("%v: invalid chain id", errInvalidSiweMessage)
+	}
+	if parsed.Nonce, errField = field("Nonce: ", true); errField != nil {
+		return nil, errField
+	}
+	if value, errField = field("Issued At: ", true); errField != nil {
+		return nil, errField
+	}
+	issuedAt, errTime := parseTime(value)
+	if errTime != nil {
+		return nil, errTime
+	}
+	if issuedAt == nil {
+		return nil, fmt.Errorf("%v: missing Issued At", errInvalidSiweMessage)
+	}
+	parsed.IssuedAt = *issuedAt
+	if value, errField = field("Expiration Time: ", false); errField != nil {
+		return nil, errField
+	}
+	if parsed.ExpirationTime, errTime = parseTime(value); errTime != nil {
+		return nil, errTime
+	}
+	if value, errField = field("Not Before: ", false); errField != nil {
+		return nil, errField
+	}
+	if parsed.NotBefore, errTime = parseTime(value); errTime != nil {
+		return nil, errTime
+	}
+	if parsed.RequestId, errField = field("Request ID: ", false); errField != nil {
+		return nil, errField
+	}
+	if index < len(lines) && lines[index] == "Resources:" {
+		for index++; index < len(lines) && strings.HasPrefix(lines[index], "- "); index++ {
+			parsed.Resources = append(parsed.Resources, strings.TrimPrefix(lines[index], "- "))
+		}
+	}
+	if index != len(lines) {
+		return nil, fmt.Errorf("%v: unexpected line %v", errInvalidSiweMessage, lines[index])
+	}
+	return parsed, nil
+}
+
+// recoverPersonalSignAddress returns the address which signed the message with personal_sign
+func recoverPersonalSignAddress(message, signature string) (common.Address, error) {
+	signatureBytes, errDecode := hexutil.Decode(signature)
+	if errDecode != nil || len(signatureBytes) != crypto.SignatureLength {
+		return common.Address{}, errors.New("invalid signature")
+	}
+	// Wallets return v as 27 or 28
+	if signatureBytes[crypto.RecoveryIDOffset] >= 27 {
+		signatureBytes[crypto.RecoveryIDOffset] -= 27
+	}
+	hash := crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	publicKey, errRecover := crypto.SigToPub(hash, signatureBytes)
+	if errRecover != nil {
+		return common.Address{}, errors.New("invalid signature")
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// validate checks the message was issued for this server and is currently valid. Messages have to be issued within
+// the nonce TTL; maxSkew allows for the clock of the client in both directions.
+func (m *siweMessage) validate(domain, scheme string, networks []*validation.Network, maxSkew time.Duration) error {
+	if m.Domain != domain {
+		return fmt.Errorf("domain mismatch: %v", m.Domain)
+	}
+	// Messages without scheme are issued for https origins
+	messageScheme := m.Scheme
+	if len(messageScheme) == 0 {
+		messageScheme = "https"
+	}
+	if messageScheme != scheme {
+		return fmt.Errorf("scheme mismatch: %v", messageScheme)
+	}
+	// The URI is the resource the client signs in to; it has to be on this server as well
+	if uri, errURI := url.Parse(m.URI); errURI != nil || uri.Scheme != scheme || uri.Host != domain {
+		return fmt.Errorf("uri mismatch: %v", m.URI)
+	}
+	if m.Version != "1" {
+		return fmt.Errorf("unsupported version: %v", m.Version)
+	}
+	knownChain := false
+	for _, network := range networks {
+		knownChain = knownChain || network.ChainId == m.ChainId
+	}
+	if !knownChain {
+		return fmt.Errorf("unsupported chain id: %v", m.ChainId)
+	}
+	now := time.Now()
+	if m.IssuedAt.After(now.Add(maxSkew)) {
+		return errors.New("message issued in the future")
+	}
+	if m.IssuedAt.Before(now.Add(-siweNonceTTL - maxSkew)) {
+		return errors.New("message issued before the nonce expired")
+	}
+	if m.ExpirationTime != nil && now.After(*m.ExpirationTime) {
+		return errors.New("message expired")
+	}
+	if m.NotBefore != nil && now.Before(*m.NotBefore) {
+		return errors.New("message not yet valid")
+	}
+	return nil
+}
+
+// IssueSiweNonce returns a new single use nonce for a sign-in message
+func (e *EthereumValidatorServer) IssueSiweNonce() (string, error) {
+	nonceBytes := make([]byte, 16)
+	if _, errRandom := rand.Read(nonceBytes); errRandom != nil {
+		return "", fmt.Errorf("unable to generate nonce: %v", errRandom)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	e.siweNonces.add(nonce)
+	return nonce, nil
+}
+
+// resolveAddressRule returns the access rule of the address; addresses without a rule
+// get the default scopes, or are rejected if there are none
+func (e *EthereumValidatorServer) resolveAddressRule(address string) (*AddressRule, error) {
+	rule, errRule := e.keystore.GetAddressRule(address)
+	if errRule == nil {
+		return rule, nil
+	}
+	// Disabled or expired rules are never replaced by the defaults
+	if errRule != errAddressNotAllowed || len(e.siweDefaultScopes) == 0 {
+		return nil, errRule
+	}
+	return &AddressRule{Address: address, Scopes: e.siweDefaultScopes, Enabled: true}, nil
+}
+
+func splitScopes(value string) []string {
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); len(scope) > 0 {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// requireSiwe rejects sign-in requests if no domain is configured the messages could be bound to
+func requireSiwe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(getRequestServer(r).siweDomain) == 0 {
+			w.WriteHeader(400)
+			errorHTTPResponse(w, INVALID_ROUTE, "sign-in with ethereum is not configured")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func authNonce(w http.ResponseWriter, r *http.Request) {
+	nonce, errNonce := getRequestServer(r).IssueSiweNonce()
+	if errNonce != nil {
+		getRequestServer(r).logger.Error(errNonce)
+		w.WriteHeader(500)
+		errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
+		return
+	}
+	// 200 OK
+	w.WriteHeader(200)
+	if errEncode := json.NewEncoder(w).Encode(map[string]string{"nonce": nonce}); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func authVerify(w http.ResponseWriter, r *http.Request) {
+	server := getRequestServer(r)
+	request := &siweVerifyRequest{}
+	if errDecode := json.NewDecoder(r.Body).Decode(request); errDecode != nil {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, "invalid request body")
+		return
+	}
+
+	message, errParse := parseSiweMessage(request.Message)
+	if errParse != nil {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, errParse.Error())
+		return
+	}
+	// Messages are bound to this server
+	errAuth := message.validate(server.siweDomain, server.siweScheme, server.validation.GetNetworks(), server.signatureMaxSkew)
+	if errAuth == nil && !server.siweNonces.consume(message.Nonce) {
+		errAuth = errors.New("unknown or expired nonce")
+	}
+	var address common.Address
+	if errAuth == nil {
+		address, errAuth = recoverPersonalSignAddress(request.Message, request.Signature)
+	}
+	if errAuth == nil && address != common.HexToAddress(message.Address) {
+		errAuth = errors.New("signature doesn't match address")
+	}
+	var rule *AddressRule
+	if errAuth == nil {
+		rule, errAuth = server.resolveAddressRule(address.Hex())
+	}
+	if errAuth != nil {
+		server.logger.Warnf("sign-in with ethereum failed for %v: %v", message.Address, errAuth)
+		server.authGuard.recordFailure(clientIP(r), fmt.Sprintf("sign-in with ethereum failed for %v: %v", message.Address, errAuth))
+		w.WriteHeader(401)
+		errorHTTPResponse(w, AUTH_FAILED, errAuth.Error())
+		return
+	}
+
+	server.authGuard.recordSuccess(clientIP(r))
+
+	// Create the session of the address
+	sessionHandler := &EthereumValidatorHTTPSessionHandler{}
+	if errInit := sessionHandler.init(server, r.RemoteAddr, nil); errInit != nil {
+		server.logger.Errorf("failed to initialize session handler: %v", errInit.Error())
+	}
+	sessionHandler.address = rule
+	server.AddHTTPHandler(sessionHandler)
+
+	w.Header().Set("Validator-Session-Id", sessionHandler.GetToken())
+	w.Header().Set("Validator-Session-Expires", sessionHandler.GetExpiresAt().UTC().Format(time.RFC3339))
+	// 200 OK
+	w.WriteHeader(200)
+	response := &siweVerifyResponse{
+		Address:   address.Hex(),
+		Scopes:    rule.Scopes,
+		ExpiresAt: sessionHandler.GetExpiresAt().UTC().Format(time.RFC3339),
+	}
+	if errEncode := json.NewEncoder(w).Encode(response); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
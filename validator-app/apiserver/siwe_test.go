@@ -0,0 +1,132 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSiweMessage(t *testing.T) {
+	message := "https://example.com wants you to sign in with your Ethereum account:\n" +
+		"0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2\n\n" +
+		"Sign in to the validator API\n\n" +
+		"URI: https://example.com/login\n" +
+		"Version: 1\n" +
+		"Chain ID: 1\n" +
+		"Nonce: 32891756\n" +
+		"Issued At: 2024-03-13T13:55:35Z\n" +
+		"Expiration Time: 2024-03-13T14:55:35Z\n" +
+		"Resources:\n" +
+		"- https://example.com/terms"
+	parsed, errParse := parseSiweMessage(message)
+	if errParse != nil {
+		t.Fatal(errParse)
+	}
+	if parsed.Scheme != "https" || parsed.Domain != "example.com" || parsed.Statement != "Sign in to the validator API" ||
+		parsed.ChainId != 1 || parsed.Nonce != "32891756" || parsed.ExpirationTime == nil || len(parsed.Resources) != 1 {
+		t.Errorf("unexpected message: %+v", parsed)
+	}
+	if errValidate := parsed.validate("example.com", "https", validation.GetNetworks(), time.Minute); errValidate == nil {
+		t.Error("expected expired message to be rejected")
+	}
+
+	// Fields must appear in the specified order
+	if _, errParse = parseSiweMessage(message + "\nNonce: 1"); errParse == nil {
+		t.Error("expected trailing field to be rejected")
+	}
+	// Issued At is required and must have a value
+	for _, issuedAt := range []string{"Issued At: \n", "Issued At: 2024-03-13\n", ""} {
+		invalid := strings.Replace(message, "Issued At: 2024-03-13T13:55:35Z\n", issuedAt, 1)
+		if _, errParse = parseSiweMessage(invalid); errParse == nil || !strings.HasPrefix(errParse.Error(), errInvalidSiweMessage.Error()) {
+			t.Errorf("expected message with %q to be invalid, got %v", issuedAt, errParse)
+		}
+	}
+}
+
+func TestValidateSiweMessage(t *testing.T) {
+	tests := []struct {
+		header string
+		uri    string
+		issued time.Duration // Issued At relative to now
+		valid  bool
+	}{
+		{"example.com", "https://example.com", 0, true},
+		{"https://example.com", "https://example.com/login", 0, true},
+		{"example.com", "https://other.com", 0, false},
+		{"example.com", "http://example.com", 0, false},
+		{"example.com", "/login", 0, false},
+		{"http://example.com", "https://example.com", 0, false},
+		{"other.com", "https://example.com", 0, false},
+		// Issued At has to be within the nonce TTL, allowing for the clock skew
+		{"example.com", "https://example.com", 30 * time.Second, true},
+		{"example.com", "https://example.com", 2 * time.Minute, false},
+		{"example.com", "https://example.com", -siweNonceTTL, true},
+		{"example.com", "https://example.com", -siweNonceTTL - 2*time.Minute, false},
+	}
+	for _, test := range tests {
+		message := fmt.Sprintf("%v wants you to sign in with your Ethereum account:\n0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2\n\nURI: %v\nVersion: 1\nChain ID: 1\nNonce: 32891756\nIssued At: %v",
+			test.header, test.uri, time.Now().Add(test.issued).UTC().Format(time.RFC3339))
+		parsed, errParse := parseSiweMessage(message)
+		if errParse != nil {
+			t.Fatal(errParse)
+		}
+		if errValidate := parsed.validate("example.com", "https", validation.GetNetworks(), time.Minute); (errValidate == nil) != test.valid {
+			t.Errorf("expected %v with URI %v issued %v from now to be valid: %v, got %v", test.header, test.uri, test.issued, test.valid, errValidate)
+		}
+	}
+}
+
+func TestSiweSignIn(t *testing.T) {
+	privateKey, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	keystore := NewDefaultKeystore("key")
+	if _, errRule := keystore.SetAddressRule(address.Hex(), "test", []string{ScopeReadSyncDuties}, nil); errRule != nil {
+		t.Fatal(errRule)
+	}
+	handler := newTestRequestHandler(keystore)
+
+	response := testRequest(handler, "GET", "/auth/nonce", "", nil)
+	nonce := map[string]string{}
+	if errDecode := json.NewDecoder(response.Body).Decode(&nonce); errDecode != nil || response.Code != 200 {
+		t.Fatalf("expected nonce, got %v (%v)", response.Code, errDecode)
+	}
+
+	message := fmt.Sprintf("example.com wants you to sign in with your Ethereum account:\n%v\n\nURI: https://example.com\nVersion: 1\nChain ID: 1\nNonce: %v\nIssued At: %v",
+		address.Hex(), nonce["nonce"], time.Now().UTC().Format(time.RFC3339))
+	hash := crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	signature, _ := crypto.Sign(hash, privateKey)
+	signature[crypto.RecoveryIDOffset] += 27
+	body, _ := json.Marshal(siweVerifyRequest{Message: message, Signature: hexutil.Encode(signature)})
+
+	response = testRequest(handler, "POST", "/auth/verify", string(body), nil)
+	token := response.Header().Get("Validator-Session-Id")
+	if response.Code != 200 || len(token) == 0 {
+		t.Fatalf("expected session, got %v: %v", response.Code, response.Body.String())
+	}
+
+	// The nonce can't be used twice
+	response = testRequest(handler, "POST", "/auth/verify", string(body), nil)
+	if response.Code != 401 {
+		t.Errorf("expected replayed message to be rejected, got %v", response.Code)
+	}
+
+	// The session only has the scopes of the address rule
+	response = testRequest(handler, "GET", "/blockreward/1", "", map[string]string{"Validator-Session-Id": token})
+	if response.Code != 403 {
+		t.Errorf("expected insufficient scope, got %v", response.Code)
+	}
+
+	// Without a configured domain, sign-in is disabled rather than bound to the Host header of the request
+	handler.server.siweDomain = ""
+	if response = testRequest(handler, "GET", "/auth/nonce", "", nil); response.Code != 400 {
+		t.Errorf("expected sign-in to be disabled, got %v", response.Code)
+	}
+	if response = testRequest(handler, "POST", "/auth/verify", string(body), nil); response.Code != 400 {
+		t.Errorf("expected sign-in to be disabled, got %v", response.Code)
+	}
+}
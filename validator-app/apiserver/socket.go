@@ -5,14 +5,18 @@ Copyright © 2024 RuntimeRacer
 package apiserver
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -25,6 +29,20 @@ const (
 	INTERNAL_SERVER_ERROR   = "INTERNAL_SERVER_ERROR"
 	NOT_FOUND               = "NOT_FOUND"
 	BAD_REQUEST             = "BAD_REQUEST"
+	INTEGRITY_CHECK_FAILED  = "INTEGRITY_CHECK_FAILED"  // Default result if backend data doesn't match what the beacon block committed to
+	BACKEND_UNAVAILABLE     = "BACKEND_UNAVAILABLE"     // Default result if a backend needed for a complete answer, like a MEV relay, couldn't be queried
+	UNKNOWN_NETWORK         = "UNKNOWN_NETWORK"         // Default result if the requested network is not supported or not configured
+	INSUFFICIENT_SCOPE      = "INSUFFICIENT_SCOPE"      // Default result if the API key doesn't grant the scope required by the route
+	INVALID_SESSION         = "INVALID_SESSION"         // Default result if the session token is invalid, expired or logged out
+	AUTH_FAILED             = "AUTH_FAILED"             // Default result if a sign-in message or its signature is rejected
+	VALIDATOR_ACCESS_DENIED = "VALIDATOR_ACCESS_DENIED" // Default result if the session didn't prove ownership of the validator
+	RATE_LIMITED            = "RATE_LIMITED"            // Default result if the client exceeded the rate limit of the route
+	QUOTA_EXCEEDED          = "QUOTA_EXCEEDED"          // Default result if the daily or monthly quota of the client is used up
+	AUTH_LOCKED             = "AUTH_LOCKED"             // Default result if the client IP is banned after repeated authentication failures
+	IP_NOT_ALLOWED          = "IP_NOT_ALLOWED"          // Default result if the client IP is denied or not allowed by the global or API key IP rules
+	JOB_NOT_COMPLETED       = "JOB_NOT_COMPLETED"       // Default result if the result of a job is requested before it completed
+	JOB_FINISHED            = "JOB_FINISHED"            // Default result if a job is cancelled after it finished
+	TOO_MANY_JOBS           = "TOO_MANY_JOBS"           // Default result if a job is submitted while the client has the maximum of unfinished jobs
 )
 
 type ValidatorHttpError struct {
@@ -32,6 +50,15 @@ type ValidatorHttpError struct {
 	Params json.RawMessage `json:"params,omitempty"`
 }
 
+// publicRoutes are reachable without a session; they are used to create one
+var publicRoutes = map[string]bool{
+	"/auth/nonce":  true,
+	"/auth/verify": true,
+
+	"/auth/validator/challenge": true,
+	"/auth/validator/verify":    true,
+}
+
 type validatorServerRequestHandler struct {
 	// Server reference
 	server *EthereumValidatorServer
@@ -39,31 +66,67 @@ type validatorServerRequestHandler struct {
 }
 
 func (h *validatorServerRequestHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Derive the client IP from the forwarded headers of trusted proxies; sessions, rate limits and logs rely on it
+	if ip := resolveClientIP(req, h.server.trustedProxies); ip != nil && ip.String() != clientIP(req) {
+		req.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+	}
+
 	if strings.ToLower(req.Header.Get("Upgrade")) == "websocket" &&
 		strings.ToLower(req.Header.Get("Connection")) == "upgrade" {
 		// Upgrade the HTTP connection to a WebSocket connection -> Can be added later if needed
 		// v.UpgradeToWebSocket(w, req)
 		errorMessage := fmt.Sprintf("websocket is currently not supported")
-		log.Warning(errorMessage)
+		h.server.logger.Warning(errorMessage)
 		// Bad Request
 		w.WriteHeader(400)
 		errorHTTPResponse(w, WEBSOCKET_NOT_SUPPORTED, errorMessage)
 		return
+	} else if bannedFor := h.server.authGuard.bannedFor(clientIP(req)); bannedFor > 0 {
+		// Locked out after repeated authentication failures
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(bannedFor.Seconds()))))
+		w.WriteHeader(429)
+		errorHTTPResponse(w, AUTH_LOCKED, "")
+		return
+	} else if listener := getRequestListener(req); listener.Auth == AuthNone {
+		// Requests of trusted listeners, like a local unix socket, skip authentication
+		handler, errSession := h.server.initTrustedSession(listener)
+		if errSession != nil {
+			w.WriteHeader(500)
+			errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
+			return
+		}
+		ctx := context.WithValue(req.Context(), serverContextKey, h.server)
+		h.router.ServeHTTP(w, req.WithContext(context.WithValue(ctx, sessionContextKey, handler)))
+	} else if publicRoutes[req.URL.Path] {
+		h.router.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), serverContextKey, h.server)))
 	} else {
 		// Handle normal HTTP Request
 		var handler *EthereumValidatorHTTPSessionHandler
 
-		// Check for session; create a new one if it doesn't exist
-		// TODO: Super simple, do that better at a later point
-		var okSession bool
-		handler, okSession = server.activeHTTPSessions[req.Header.Get("Validator-Session-Id")]
-		if !okSession {
+		// Resume the session of a signed session token; create a new one from the API key otherwise
+		sessionToken := req.Header.Get("Validator-Session-Id")
+		if len(sessionToken) > 0 {
+			var errSession error
+			handler, errSession = h.server.GetHTTPSession(sessionToken)
+			if errSession != nil && !hasCredentials(req) {
+				// Clients keep sending tokens of sessions which expired or ended; only failed credentials count
+				// towards the lockout
+				errorMessage := fmt.Sprintf("failed to resume session: %v", errSession.Error())
+				h.server.logger.Warning(errorMessage)
+				// Unauthorized; the client needs to authenticate with its API key again
+				w.WriteHeader(401)
+				errorHTTPResponse(w, INVALID_SESSION, errorMessage)
+				return
+			}
+		}
+		if handler == nil {
 			// Create new Validator Session
 			var errSession error
 			handler, errSession = h.InitializeHTTPSession(req)
 			if errSession != nil {
 				errorMessage := fmt.Sprintf("failed to initialize session: %v", errSession.Error())
-				log.Warning(errorMessage)
+				h.server.logger.Warning(errorMessage)
+				h.server.authGuard.recordFailure(clientIP(req), errorMessage)
 				// Bad Request
 				w.WriteHeader(400)
 				errorHTTPResponse(w, INIT_SESSION_FAILED, errorMessage)
@@ -71,28 +134,31 @@ func (h *validatorServerRequestHandler) ServeHTTP(w http.ResponseWriter, req *ht
 			}
 		}
 
-		// FIXME: This ensures the session is being cleaned up after the request has been processed.
-		// FIXME: Remove this line of code if you want to keep track of sessions and/or storing session data across requests.
-		defer handler.finalize()
-
-		// TODO: This is part of a potential future session verification mechanism;
-		// TODO: but for this prototype implementation it only gets called on the same request as the session is created.
-		// Validate Request against Session Info - Very rudimentary IP check; should be done more safely
+		// Validate Request against Session Info; checks expiry, the API key, the IP rules and the origin IP if the session is bound to it
 		if errValidate := handler.ValidateRequest(req); errValidate != nil {
 			errorMessage := fmt.Sprintf("failed to validate request for session %v: %v", handler.handlerId, errValidate.Error())
-			log.Warning(errorMessage)
+			h.server.logger.Warning(errorMessage)
+			if errors.Is(errValidate, errIPNotAllowed) {
+				h.server.securityLog.WithFields(log.Fields{"ip": clientIP(req), "identity": handler.GetIdentity()}).Warn("ip not allowed")
+				// Forbidden
+				w.WriteHeader(403)
+				errorHTTPResponse(w, IP_NOT_ALLOWED, clientIP(req))
+				return
+			}
 			// Unauthorized
 			w.WriteHeader(401)
 			errorHTTPResponse(w, HANDLE_REQUEST_FAILED, errorMessage)
 			return
 		}
 
-		// Return Validator Session ID as part of the response header
-		// TODO: This is commented out because we're not keeping track of sessions in the prototype
-		// w.Header().Add("Validator-Session-Id", handler.GetId())
+		// Return a refreshed session token as part of the response header
+		handler.touch()
+		w.Header().Set("Validator-Session-Id", handler.GetToken())
+		w.Header().Set("Validator-Session-Expires", handler.GetExpiresAt().UTC().Format(time.RFC3339))
 
-		// Handle the requests based on Path and Method
-		h.router.ServeHTTP(w, req)
+		// Handle the requests based on Path and Method; routes check the scopes of the session's key
+		ctx := context.WithValue(req.Context(), serverContextKey, h.server)
+		h.router.ServeHTTP(w, req.WithContext(context.WithValue(ctx, sessionContextKey, handler)))
 	}
 }
 
@@ -100,20 +166,34 @@ func (h *validatorServerRequestHandler) InitializeHTTPSession(req *http.Request)
 	// Get Required Headers
 	requestOrigin := req.RemoteAddr
 	apiKey := req.Header.Get("Validator-Api-Key")
-	if len(requestOrigin) == 0 || len(apiKey) == 0 {
+	if len(requestOrigin) == 0 || !hasCredentials(req) {
 		return nil, errors.New("request headers invalid")
 	}
 
-	// Verify API Key
-	requestAPIKey := viper.GetString("DEFAULT_API_KEY")
-	if requestAPIKey != apiKey {
-		return nil, errors.New("invalid api key")
+	// Verify the request signature, the API Key or the client certificate; explicit credentials take precedence
+	var requestAPIKey *ApiKey
+	var errAuthenticate error
+	if isSignedRequest(req) {
+		requestAPIKey, errAuthenticate = h.server.verifyRequestSignature(req)
+	} else if len(apiKey) > 0 {
+		requestAPIKey, errAuthenticate = h.server.keystore.Authenticate(apiKey)
+	} else {
+		requestAPIKey, errAuthenticate = h.server.keystore.AuthenticateCertificate(verifiedClientCertificate(req))
+	}
+	if errAuthenticate != nil {
+		return nil, errAuthenticate
+	}
+	h.server.authGuard.recordSuccess(clientIP(req))
+
+	// Continue the session of the key if the client already has one
+	if sessionHandler := h.server.findApiKeySession(requestAPIKey, clientIP(req)); sessionHandler != nil {
+		return sessionHandler, nil
 	}
 
 	// Init Session handler
 	sessionHandler := &EthereumValidatorHTTPSessionHandler{}
-	if errInit := sessionHandler.init(h.server, req.RemoteAddr); errInit != nil {
-		log.Errorf("failed to initialize session handler: %v", errInit.Error())
+	if errInit := sessionHandler.init(h.server, req.RemoteAddr, requestAPIKey); errInit != nil {
+		h.server.logger.Errorf("failed to initialize session handler: %v", errInit.Error())
 	}
 
 	// Add to list of handlers
@@ -121,6 +201,20 @@ func (h *validatorServerRequestHandler) InitializeHTTPSession(req *http.Request)
 	return sessionHandler, nil
 }
 
+// hasCredentials returns true if the request can create a session: it's signed, has an API key or a verified client certificate
+func hasCredentials(req *http.Request) bool {
+	return len(req.Header.Get("Validator-Api-Key")) > 0 || isSignedRequest(req) || verifiedClientCertificate(req) != nil
+}
+
+// clientIP returns the IP address of the client
+func clientIP(req *http.Request) string {
+	host, _, errHostPort := net.SplitHostPort(req.RemoteAddr)
+	if errHostPort != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
 func buildErrorHTTPResponse(errorType, errorMessage string) *ValidatorHttpError {
 	messageJSON, errEncode := json.Marshal(errorMessage)
 	if errEncode != nil {
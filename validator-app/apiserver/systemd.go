@@ -0,0 +1,180 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// systemdListenFdsStart is the first file descriptor passed by socket activation
+	systemdListenFdsStart = 3
+
+	// backendReadyRetry is the interval the backends are checked in until READY=1 is sent
+	backendReadyRetry = 5 * time.Second
+)
+
+// systemdSocket is a listening socket passed by systemd socket activation
+type systemdSocket struct {
+	name     string
+	listener net.Listener
+	used     bool
+}
+
+var (
+	systemdSockets     []*systemdSocket
+	systemdSocketsOnce sync.Once
+	systemdSocketsMtx  sync.Mutex
+)
+
+// loadSystemdSockets reads the sockets passed with LISTEN_FDS, if they're meant for this process.
+// The variables are unset afterwards so child processes don't pick up the sockets.
+func loadSystemdSockets() []*systemdSocket {
+	systemdSocketsOnce.Do(func() {
+		defer os.Unsetenv("LISTEN_PID")
+		defer os.Unsetenv("LISTEN_FDS")
+		defer os.Unsetenv("LISTEN_FDNAMES")
+
+		if pid, errPid := strconv.Atoi(os.Getenv("LISTEN_PID")); errPid != nil || pid != os.Getpid() {
+			return
+		}
+		count, errCount := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if errCount != nil || count <= 0 {
+			return
+		}
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < count; i++ {
+			fd := systemdListenFdsStart + i
+			syscall.CloseOnExec(fd)
+			name := "unknown"
+			if i < len(names) && len(names[i]) > 0 {
+				name = names[i]
+			}
+			file := os.NewFile(uintptr(fd), name)
+			listener, errListener := net.FileListener(file)
+			file.Close()
+			if errListener != nil {
+				log.Warnf("Ignoring socket %v (%v) passed by systemd: %v", fd, name, errListener)
+				continue
+			}
+			systemdSockets = append(systemdSockets, &systemdSocket{name: name, listener: listener})
+		}
+	})
+	return systemdSockets
+}
+
+// takeSystemdListener returns the next unused activated socket with the given name
+func takeSystemdListener(name string) (net.Listener, error) {
+	sockets := loadSystemdSockets()
+	systemdSocketsMtx.Lock()
+	defer systemdSocketsMtx.Unlock()
+	for _, socket := range sockets {
+		if socket.name == name && !socket.used {
+			socket.used = true
+			return socket.listener, nil
+		}
+	}
+	return nil, fmt.Errorf("no socket named %v passed by systemd", name)
+}
+
+// systemdListenerConfig returns a listener config covering all activated sockets; it's empty without socket activation.
+// Activated unix sockets don't serve TLS, the same as configured ones.
+func systemdListenerConfig(tlsEnabled bool) string {
+	entries := make([]string, 0)
+	for _, socket := range loadSystemdSockets() {
+		entry := "systemd://" + socket.name
+		if tlsEnabled && socket.listener.Addr().Network() != "tcp" {
+			entry += "?tls=false"
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ",")
+}
+
+// sdNotify sends a state to the service manager; it's a no-op if the process doesn't run under systemd with Type=notify
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if len(socketPath) == 0 {
+		return nil
+	}
+	// Abstract sockets are announced with a leading @
+	if strings.HasPrefix(socketPath, "@") {
+		socketPath = "\x00" + socketPath[1:]
+	}
+	conn, errDial := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if errDial != nil {
+		return fmt.Errorf("unable to connect to notify socket: %v", errDial)
+	}
+	defer conn.Close()
+	if _, errWrite := conn.Write([]byte(state)); errWrite != nil {
+		return fmt.Errorf("unable to notify service manager: %v", errWrite)
+	}
+	return nil
+}
+
+// notifyReady sends READY=1 once every network with a configured backend returns its head slot
+func (e *EthereumValidatorServer) notifyReady(ctx context.Context) {
+	if len(os.Getenv("NOTIFY_SOCKET")) == 0 {
+		return
+	}
+	for _, network := range e.validation.GetNetworks() {
+		if !network.IsConfigured() {
+			continue
+		}
+		for {
+			_, errHead := e.validation.ResolveBlockID(network, "head")
+			if errHead == nil {
+				break
+			}
+			e.logger.Warnf("Waiting for backend of network %v: %v", network.Name, errHead)
+			if errNotify := sdNotify(fmt.Sprintf("STATUS=Waiting for backend of network %v", network.Name)); errNotify != nil {
+				e.logger.Warn(errNotify)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backendReadyRetry):
+			}
+		}
+	}
+	if errNotify := sdNotify("READY=1\nSTATUS=Serving requests"); errNotify != nil {
+		e.logger.Warn(errNotify)
+	}
+}
+
+// runWatchdog sends WATCHDOG=1 at half the interval requested by the service manager while the server is serving requests
+func (e *EthereumValidatorServer) runWatchdog(ctx context.Context) {
+	usec, errUsec := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if errUsec != nil || usec <= 0 {
+		return
+	}
+	if pid, errPid := strconv.Atoi(os.Getenv("WATCHDOG_PID")); errPid == nil && pid != os.Getpid() {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !e.isServingRequests.Load() {
+				continue
+			}
+			if errNotify := sdNotify("WATCHDOG=1"); errNotify != nil {
+				e.logger.Warn(errNotify)
+			}
+		}
+	}
+}
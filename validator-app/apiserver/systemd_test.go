@@ -0,0 +1,58 @@
+package apiserver
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestSdNotify(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	conn, errListen := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if errListen != nil {
+		t.Fatal(errListen)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+	if errNotify := sdNotify("READY=1"); errNotify != nil {
+		t.Fatal(errNotify)
+	}
+	buffer := make([]byte, 64)
+	n, _, errRead := conn.ReadFromUnix(buffer)
+	if errRead != nil || string(buffer[:n]) != "READY=1" {
+		t.Errorf("expected READY=1, got %q (%v)", buffer[:n], errRead)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if errNotify := sdNotify("READY=1"); errNotify != nil {
+		t.Errorf("expected no-op without notify socket, got %v", errNotify)
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	// Simulate the sockets passed by systemd
+	tcpListener, _ := net.Listen("tcp", "127.0.0.1:0")
+	unixListener, _ := net.Listen("unix", filepath.Join(t.TempDir(), "ethval.sock"))
+	defer tcpListener.Close()
+	defer unixListener.Close()
+	systemdSocketsOnce.Do(func() {})
+	systemdSockets = []*systemdSocket{{name: "http", listener: tcpListener}, {name: "local", listener: unixListener}}
+	defer func() { systemdSockets = nil }()
+
+	config := systemdListenerConfig(true)
+	if config != "systemd://http,systemd://local?tls=false" {
+		t.Fatalf("unexpected config %v", config)
+	}
+	listeners, errParse := parseListeners(config, true)
+	if errParse != nil || !listeners[0].TLS || listeners[1].TLS {
+		t.Fatalf("unexpected listeners %+v (%v)", listeners, errParse)
+	}
+
+	if listener, errTake := takeSystemdListener("local"); errTake != nil || listener != unixListener {
+		t.Errorf("expected activated unix socket, got %v (%v)", listener, errTake)
+	}
+	if _, errTake := takeSystemdListener("local"); errTake == nil {
+		t.Error("expected socket to be taken only once")
+	}
+}
@@ -0,0 +1,169 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLS client authentication modes
+const (
+	ClientAuthNone     = "none"     // Client certificates are not requested
+	ClientAuthOptional = "optional" // Client certificates are verified if presented; clients may still authenticate with API keys
+	ClientAuthRequire  = "require"  // Every connection needs a valid client certificate
+)
+
+// tlsProvider serves the certificate and client CAs of the server; both are reloaded when their files change
+type tlsProvider struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+	logger       *log.Logger
+
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	mtx         sync.RWMutex
+}
+
+// newTLSProvider loads the configured certificate; it returns nil if there's none and the server should serve plain HTTP
+func newTLSProvider(opts TLSOptions, logger *log.Logger) (*tlsProvider, error) {
+	provider := &tlsProvider{
+		certFile:     opts.CertFile,
+		keyFile:      opts.KeyFile,
+		clientCAFile: opts.ClientCAFile,
+		logger:       logger,
+	}
+	if len(provider.certFile) == 0 {
+		return nil, nil
+	}
+	if len(provider.keyFile) == 0 {
+		return nil, errors.New("a TLS key file is required with the certificate file")
+	}
+
+	clientAuth := strings.ToLower(opts.ClientAuth)
+	if len(clientAuth) == 0 {
+		clientAuth = ClientAuthNone
+		if len(provider.clientCAFile) > 0 {
+			clientAuth = ClientAuthOptional
+		}
+	}
+	switch clientAuth {
+	case ClientAuthNone:
+		provider.clientAuth = tls.NoClientCert
+	case ClientAuthOptional:
+		provider.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		provider.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown TLS client auth mode: %v", clientAuth)
+	}
+	if provider.clientAuth != tls.NoClientCert && len(provider.clientCAFile) == 0 {
+		return nil, errors.New("a TLS client CA file is required for client certificate authentication")
+	}
+
+	if errLoad := provider.load(); errLoad != nil {
+		return nil, errLoad
+	}
+	return provider, nil
+}
+
+// load reads the certificate, key and client CAs; the previous state is kept if any of them is invalid
+func (p *tlsProvider) load() error {
+	certificate, errCertificate := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if errCertificate != nil {
+		return fmt.Errorf("unable to load TLS certificate: %v", errCertificate)
+	}
+	var clientCAs *x509.CertPool
+	if p.clientAuth != tls.NoClientCert {
+		content, errRead := os.ReadFile(p.clientCAFile)
+		if errRead != nil {
+			return fmt.Errorf("unable to read TLS client CAs: %v", errRead)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificates found in TLS client CA file '%v'", p.clientCAFile)
+		}
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.certificate = &certificate
+	p.clientCAs = clientCAs
+	return nil
+}
+
+func (p *tlsProvider) reload() {
+	if errLoad := p.load(); errLoad != nil {
+		p.logger.Errorf("failed to reload TLS certificates, keeping previous ones: %v", errLoad)
+		return
+	}
+	p.logger.Infof("Reloaded TLS certificate '%v'", p.certFile)
+}
+
+// watch reloads the certificates whenever one of the files changes, until the context is done
+func (p *tlsProvider) watch(ctx context.Context, interval time.Duration) {
+	for _, path := range []string{p.certFile, p.keyFile, p.clientCAFile} {
+		if len(path) > 0 {
+			go watchFile(ctx, path, interval, p.logger, p.reload)
+		}
+	}
+}
+
+// config returns the TLS config of the server; every handshake uses the latest certificate and client CAs
+func (p *tlsProvider) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			p.mtx.RLock()
+			defer p.mtx.RUnlock()
+			return p.certificate, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			p.mtx.RLock()
+			defer p.mtx.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*p.certificate},
+				ClientAuth:   p.clientAuth,
+				ClientCAs:    p.clientCAs,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// verifiedClientCertificate returns the leaf certificate of the client if it was verified against the client CAs
+func verifiedClientCertificate(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// certificateNames returns the names an API key can be mapped to: the subject, its common name and all SANs.
+// URI SANs are prefixed with their scheme (e.g. spiffe://cluster/ns/svc), emails and DNS names are returned as they are.
+func certificateNames(certificate *x509.Certificate) []string {
+	names := []string{certificate.Subject.String()}
+	if len(certificate.Subject.CommonName) > 0 {
+		names = append(names, certificate.Subject.CommonName)
+	}
+	names = append(names, certificate.DNSNames...)
+	names = append(names, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
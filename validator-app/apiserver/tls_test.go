@@ -0,0 +1,130 @@
+package apiserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	log "github.com/sirupsen/logrus"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, serial int64, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, errKey := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if errKey != nil {
+		t.Fatal(errKey)
+	}
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, errCreate := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if errCreate != nil {
+		t.Fatal(errCreate)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile, keyFile string) {
+	keyDer, _ := x509.MarshalECPrivateKey(c.key)
+	if errWrite := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw}), 0600); errWrite != nil {
+		t.Fatal(errWrite)
+	}
+	if len(keyFile) > 0 {
+		if errWrite := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); errWrite != nil {
+			t.Fatal(errWrite)
+		}
+	}
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.certificate.Raw}, PrivateKey: c.key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, 1, &x509.Certificate{Subject: pkix.Name{CommonName: "test ca"}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign}, nil)
+	serverTemplate := func() *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: "server"}, IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	}
+	clientCertificate := newTestCertificate(t, 3, &x509.Certificate{Subject: pkix.Name{CommonName: "indexer", Organization: []string{"Example"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+	newTestCertificate(t, 2, serverTemplate(), ca).write(t, certFile, keyFile)
+	ca.write(t, caFile, "")
+
+	provider, errProvider := newTLSProvider(TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}, log.StandardLogger())
+	if errProvider != nil {
+		t.Fatal(errProvider)
+	}
+
+	keystore, _ := LoadKeystore(filepath.Join(dir, "keystore.json"))
+	_, key, _ := keystore.CreateKey("indexer", []string{ScopeReadBlockReward}, nil)
+	if errNames := keystore.SetCertNames(key.Id, []string{"CN=indexer,O=Example"}); errNames != nil {
+		t.Fatal(errNames)
+	}
+	testServer := httptest.NewUnstartedServer(newTestRequestHandler(keystore))
+	testServer.TLS = provider.config()
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	newClient := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates}}}
+	}
+
+	// The client certificate authenticates as the mapped key
+	response, errRequest := newClient(clientCertificate.tlsCertificate()).Get(testServer.URL + "/time/slot/0")
+	if errRequest != nil {
+		t.Fatal(errRequest)
+	}
+	response.Body.Close()
+	if response.StatusCode != 200 || len(response.Header.Get("Validator-Session-Id")) == 0 {
+		t.Fatalf("expected session from client certificate, got %v", response.StatusCode)
+	}
+
+	// Without a certificate and API key no session can be created
+	response, errRequest = newClient().Get(testServer.URL + "/time/slot/0")
+	if errRequest != nil {
+		t.Fatal(errRequest)
+	}
+	response.Body.Close()
+	if response.StatusCode != 400 {
+		t.Errorf("expected request without credentials to be rejected, got %v", response.StatusCode)
+	}
+
+	// A replaced certificate is served after the reload
+	newTestCertificate(t, 4, serverTemplate(), ca).write(t, certFile, keyFile)
+	provider.reload()
+	response, errRequest = newClient().Get(testServer.URL + "/time/slot/0")
+	if errRequest != nil {
+		t.Fatal(errRequest)
+	}
+	response.Body.Close()
+	if serial := response.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 4 {
+		t.Errorf("expected reloaded certificate, got serial %v", serial)
+	}
+}
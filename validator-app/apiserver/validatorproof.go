@@ -0,0 +1,186 @@
+// Package apiserver
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package apiserver
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/go-chi/chi/v5"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// validatorChallengeTTL is the time a client has to sign a challenge with its validator keys
+	validatorChallengeTTL = 5 * time.Minute
+
+	// maxValidatorProofs limits the number of validators a single session can be scoped to
+	maxValidatorProofs = 100
+)
+
+// validatorChallengeResponse is returned by GET /auth/validator/challenge
+type validatorChallengeResponse struct {
+	Challenge   string `json:"challenge"`
+	DomainType  string `json:"domain_type"`
+	SigningRoot string `json:"signing_root"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// validatorProof is the signature of the challenge by a single validator key
+type validatorProof struct {
+	Pubkey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+// validatorVerifyRequest is the body of POST /auth/validator/verify
+type validatorVerifyRequest struct {
+	Challenge string           `json:"challenge"`
+	Proofs    []validatorProof `json:"proofs"`
+}
+
+// validatorVerifyResponse lists the validators the new session is scoped to; the session token is returned in the response header
+type validatorVerifyResponse struct {
+	Network    string                       `json:"network"`
+	Validators []validation.ValidatorStatus `json:"validators"`
+	ExpiresAt  string                       `json:"expires_at"`
+}
+
+// requireValidatorAccess rejects requests for validators the session didn't prove ownership of; admins may access all validators
+func requireValidatorAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(sessionContextKey).(*EthereumValidatorHTTPSessionHandler)
+		id := chi.URLParam(r, "id")
+		if !ok || (!session.HasScope(ScopeAdmin) && !session.HasValidator(getRequestNetwork(r).Name, id)) {
+			w.WriteHeader(403)
+			errorHTTPResponse(w, VALIDATOR_ACCESS_DENIED, id)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func authValidatorChallenge(w http.ResponseWriter, r *http.Request) {
+	var challenge [32]byte
+	if _, errRandom := rand.Read(challenge[:]); errRandom != nil {
+		getRequestServer(r).logger.Errorf("unable to generate challenge: %v", errRandom)
+		w.WriteHeader(500)
+		errorHTTPResponse(w, INTERNAL_SERVER_ERROR, "")
+		return
+	}
+	expiresAt := getRequestServer(r).validatorChallenges.add(hexutil.Encode(challenge[:]))
+
+	signingRoot := validation.ValidatorProofSigningRoot(getRequestNetwork(r), challenge)
+	response := &validatorChallengeResponse{
+		Challenge:   hexutil.Encode(challenge[:]),
+		DomainType:  hexutil.Encode(validation.DomainValidatorProof[:]),
+		SigningRoot: hexutil.Encode(signingRoot[:]),
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+	}
+	// 200 OK
+	w.WriteHeader(200)
+	if errEncode := json.NewEncoder(w).Encode(response); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func authValidatorVerify(w http.ResponseWriter, r *http.Request) {
+	server := getRequestServer(r)
+	network := getRequestNetwork(r)
+	request := &validatorVerifyRequest{}
+	if errDecode := json.NewDecoder(r.Body).Decode(request); errDecode != nil {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, "invalid request body")
+		return
+	}
+	if len(request.Proofs) == 0 || len(request.Proofs) > maxValidatorProofs {
+		w.WriteHeader(400)
+		errorHTTPResponse(w, BAD_REQUEST, fmt.Sprintf("between 1 and %v proofs required", maxValidatorProofs))
+		return
+	}
+
+	// The challenge is consumed by the first attempt, successful or not
+	var errAuth error
+	challenge, errChallenge := hexutil.Decode(request.Challenge)
+	if errChallenge != nil || len(challenge) != 32 || !server.validatorChallenges.consume(strings.ToLower(request.Challenge)) {
+		errAuth = errors.New("unknown or expired challenge")
+	}
+	pubkeys := make([]string, len(request.Proofs))
+	for i, proof := range request.Proofs {
+		if errAuth != nil {
+			break
+		}
+		errAuth = server.validation.VerifyValidatorProof(network, proof.Pubkey, proof.Signature, [32]byte(challenge))
+		pubkeys[i] = strings.ToLower(proof.Pubkey)
+	}
+	if errAuth != nil {
+		server.logger.Warnf("validator proof failed: %v", errAuth)
+		server.authGuard.recordFailure(clientIP(r), fmt.Sprintf("validator proof failed: %v", errAuth))
+		w.WriteHeader(401)
+		errorHTTPResponse(w, AUTH_FAILED, errAuth.Error())
+		return
+	}
+
+	// Only keys of validators known to the beacon chain are accepted
+	validators, errValidators := server.validation.GetValidatorStatuses(network, pubkeys)
+	if errValidators != nil {
+		server.logger.Errorf("failed to get validators: %v", errValidators)
+		validationErrorHTTPResponse(w, errValidators)
+		return
+	}
+	if len(validators) != len(pubkeys) {
+		server.authGuard.recordFailure(clientIP(r), "validator proof for unknown validator")
+		w.WriteHeader(401)
+		errorHTTPResponse(w, AUTH_FAILED, "unknown validator")
+		return
+	}
+
+	server.authGuard.recordSuccess(clientIP(r))
+
+	// Create the session scoped to the validators
+	sessionHandler := &EthereumValidatorHTTPSessionHandler{}
+	if errInit := sessionHandler.init(server, r.RemoteAddr, nil); errInit != nil {
+		server.logger.Errorf("failed to initialize session handler: %v", errInit.Error())
+	}
+	sessionHandler.validators = validators
+	sessionHandler.validatorNetwork = network.Name
+	server.AddHTTPHandler(sessionHandler)
+
+	w.Header().Set("Validator-Session-Id", sessionHandler.GetToken())
+	w.Header().Set("Validator-Session-Expires", sessionHandler.GetExpiresAt().UTC().Format(time.RFC3339))
+	// 200 OK
+	w.WriteHeader(200)
+	response := &validatorVerifyResponse{
+		Network:    network.Name,
+		Validators: validators,
+		ExpiresAt:  sessionHandler.GetExpiresAt().UTC().Format(time.RFC3339),
+	}
+	if errEncode := json.NewEncoder(w).Encode(response); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
+
+func validatorGetStatus(w http.ResponseWriter, r *http.Request) {
+	statuses, errStatus := getRequestServer(r).validation.GetValidatorStatuses(getRequestNetwork(r), []string{chi.URLParam(r, "id")})
+	if errStatus != nil {
+		getRequestServer(r).logger.Errorf("failed to get validator status: %v", errStatus)
+		validationErrorHTTPResponse(w, errStatus)
+		return
+	}
+	if len(statuses) == 0 {
+		w.WriteHeader(404)
+		errorHTTPResponse(w, NOT_FOUND, "validator not found")
+		return
+	}
+	// 200 OK
+	w.WriteHeader(200)
+	if errEncode := json.NewEncoder(w).Encode(statuses[0]); errEncode != nil {
+		getRequestServer(r).logger.Error(fmt.Errorf("failed to encode data: %v", errEncode))
+	}
+}
@@ -0,0 +1,300 @@
+// Package client
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/apiserver"
+	"github.com/runtimeracer/ethereum-validator-go/constants"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the version of the client; it's released together with the server and sent as User-Agent
+const Version = constants.AppVersion
+
+// Options configure a client created with New. Zero values select the defaults noted on the fields.
+type Options struct {
+	// BaseURL is the URL of the API server, e.g. https://validator.example.com
+	BaseURL string
+	// Network selects the network by the route prefix; defaults to the default network of the server
+	Network string
+	// HTTPClient sends the requests; defaults to a client with a 60s timeout, the request timeout of the server
+	HTTPClient *http.Client
+
+	// APIKey authenticates requests with the Validator-Api-Key header
+	APIKey string
+	// KeyId and Secret sign requests instead of sending the API key; see apiserver.SignRequest
+	KeyId  string
+	Secret string
+	// SessionToken resumes a session, e.g. one created by sign-in with ethereum or a validator proof
+	SessionToken string
+
+	// MaxRetries of failed idempotent requests; defaults to 3
+	MaxRetries int
+	// DisableRetries sends every request once
+	DisableRetries bool
+	// RetryBackoff is the wait before the first retry and doubles with every retry; defaults to 500ms.
+	// A longer Retry-After of the server takes precedence.
+	RetryBackoff time.Duration
+	// MaxRetryWait stops retrying if the server asks to wait longer; defaults to 1m
+	MaxRetryWait time.Duration
+
+	// PollInterval is the interval subscriptions poll the head in; defaults to the slot duration of the network
+	PollInterval time.Duration
+}
+
+// Client is a typed client of the API. It keeps the session returned by the server and sends it with every request;
+// the credentials are sent as well, so an expired session is replaced transparently. It's safe for concurrent use.
+type Client struct {
+	baseURL      *url.URL
+	network      string
+	httpClient   *http.Client
+	apiKey       string
+	keyId        string
+	secret       string
+	maxRetries   int
+	retryBackoff time.Duration
+	maxRetryWait time.Duration
+	pollInterval time.Duration
+	// Session
+	sessionToken   string
+	sessionExpires time.Time
+	sessionMtx     sync.RWMutex
+}
+
+// New creates a client from the options
+func New(opts Options) (*Client, error) {
+	baseURL, errURL := url.Parse(strings.TrimSuffix(opts.BaseURL, "/"))
+	if errURL != nil {
+		return nil, fmt.Errorf("invalid base url: %v", errURL)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url %q: scheme must be http or https", opts.BaseURL)
+	}
+	if (len(opts.KeyId) > 0) != (len(opts.Secret) > 0) {
+		return nil, errors.New("key id and secret must be set together")
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	maxRetries := opts.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	if opts.DisableRetries {
+		maxRetries = 0
+	}
+	return &Client{
+		baseURL:      baseURL,
+		network:      opts.Network,
+		httpClient:   httpClient,
+		apiKey:       opts.APIKey,
+		keyId:        opts.KeyId,
+		secret:       opts.Secret,
+		maxRetries:   maxRetries,
+		retryBackoff: withDefaultDuration(opts.RetryBackoff, 500*time.Millisecond),
+		maxRetryWait: withDefaultDuration(opts.MaxRetryWait, time.Minute),
+		pollInterval: opts.PollInterval,
+		sessionToken: opts.SessionToken,
+	}, nil
+}
+
+// BlockReward returns the reward details of a slot. The block id is a slot number, head, finalized, justified, genesis,
+// a 0x prefixed block root or an RFC 3339 timestamp.
+func (c *Client) BlockReward(ctx context.Context, blockID string) (*validation.BlockRewardSlot, error) {
+	slot := &validation.BlockRewardSlot{}
+	if errRequest := c.do(ctx, http.MethodGet, c.networkPath("blockreward", blockID), slot); errRequest != nil {
+		return nil, errRequest
+	}
+	return slot, nil
+}
+
+// SyncDuties returns the validators with sync committee duties in a slot; the block id is resolved like by BlockReward
+func (c *Client) SyncDuties(ctx context.Context, blockID string) (*validation.SyncDutiesResponse, error) {
+	duties := &validation.SyncDutiesResponse{}
+	if errRequest := c.do(ctx, http.MethodGet, c.networkPath("syncduties", blockID), duties); errRequest != nil {
+		return nil, errRequest
+	}
+	return duties, nil
+}
+
+// SlotTime returns the start time, epoch and fork of a slot
+func (c *Client) SlotTime(ctx context.Context, slot uint64) (*validation.SlotTimeResponse, error) {
+	slotTime := &validation.SlotTimeResponse{}
+	if errRequest := c.do(ctx, http.MethodGet, c.networkPath("time", "slot", strconv.FormatUint(slot, 10)), slotTime); errRequest != nil {
+		return nil, errRequest
+	}
+	return slotTime, nil
+}
+
+// SlotAt returns the slot active at a point in time
+func (c *Client) SlotAt(ctx context.Context, at time.Time) (*validation.SlotTimeResponse, error) {
+	slotTime := &validation.SlotTimeResponse{}
+	if errRequest := c.do(ctx, http.MethodGet, c.networkPath("time", "at", strconv.FormatInt(at.Unix(), 10)), slotTime); errRequest != nil {
+		return nil, errRequest
+	}
+	return slotTime, nil
+}
+
+// ValidatorStatus returns the state of a validator; the session needs to have proven ownership of it
+func (c *Client) ValidatorStatus(ctx context.Context, id string) (*validation.ValidatorStatus, error) {
+	status := &validation.ValidatorStatus{}
+	if errRequest := c.do(ctx, http.MethodGet, c.networkPath("validator", id), status); errRequest != nil {
+		return nil, errRequest
+	}
+	return status, nil
+}
+
+// Logout ends the session on the server; the next request creates a new one from the credentials
+func (c *Client) Logout(ctx context.Context) error {
+	if errRequest := c.do(ctx, http.MethodPost, "/auth/logout", nil); errRequest != nil {
+		return errRequest
+	}
+	c.setSession("", time.Time{})
+	return nil
+}
+
+// Session returns the current session token and its expiry; the token is empty before the first request
+func (c *Client) Session() (string, time.Time) {
+	c.sessionMtx.RLock()
+	defer c.sessionMtx.RUnlock()
+	return c.sessionToken, c.sessionExpires
+}
+
+func (c *Client) setSession(token string, expiresAt time.Time) {
+	c.sessionMtx.Lock()
+	defer c.sessionMtx.Unlock()
+	c.sessionToken = token
+	c.sessionExpires = expiresAt
+}
+
+// networkPath returns the path of a validation route, prefixed with the network if one is selected
+func (c *Client) networkPath(segments ...string) string {
+	if len(c.network) > 0 {
+		segments = append([]string{c.network}, segments...)
+	}
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// do sends a request and decodes the response into result. GET requests are retried on connection errors,
+// internal errors, rate limits and unavailable backends; error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, result interface{}) error {
+	retries := 0
+	if method == http.MethodGet {
+		retries = c.maxRetries
+	}
+	backoff := c.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		response, errRequest := c.send(ctx, method, path)
+		var errResponse error
+		if errRequest == nil {
+			errResponse = c.handleResponse(response, result)
+			if errResponse == nil {
+				return nil
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Give up if the error is permanent or the server asks to wait too long
+		wait := backoff
+		if errRequest == nil {
+			var apiError *Error
+			if !errors.As(errResponse, &apiError) || !apiError.Temporary() {
+				return errResponse
+			}
+			if apiError.RetryAfter > wait {
+				wait = apiError.RetryAfter
+			}
+		}
+		if attempt >= retries || wait > c.maxRetryWait {
+			if errRequest != nil {
+				return errRequest
+			}
+			return errResponse
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// send creates and sends a single attempt of a request; signed requests need a new nonce for every attempt
+func (c *Client) send(ctx context.Context, method, path string) (*http.Response, error) {
+	req, errRequest := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, nil)
+	if errRequest != nil {
+		return nil, errRequest
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "ethereum-validator-go-client/"+Version)
+	if sessionToken, _ := c.Session(); len(sessionToken) > 0 {
+		req.Header.Set("Validator-Session-Id", sessionToken)
+	}
+	if len(c.keyId) > 0 {
+		if errSign := apiserver.SignRequest(req, c.keyId, c.secret); errSign != nil {
+			return nil, fmt.Errorf("unable to sign request: %v", errSign)
+		}
+	} else if len(c.apiKey) > 0 {
+		req.Header.Set("Validator-Api-Key", c.apiKey)
+	}
+	return c.httpClient.Do(req)
+}
+
+// handleResponse keeps the refreshed session and decodes the body of successful responses into result
+func (c *Client) handleResponse(response *http.Response, result interface{}) error {
+	defer response.Body.Close()
+	if sessionToken := response.Header.Get("Validator-Session-Id"); len(sessionToken) > 0 {
+		expiresAt, _ := time.Parse(time.RFC3339, response.Header.Get("Validator-Session-Expires"))
+		c.setSession(sessionToken, expiresAt)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		apiError := decodeError(response)
+		if apiError.Code == apiserver.INVALID_SESSION {
+			// Logged out or expired; a retry can only succeed with new credentials
+			c.setSession("", time.Time{})
+		}
+		return apiError
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	if errDecode := json.NewDecoder(response.Body).Decode(result); errDecode != nil {
+		return fmt.Errorf("failed to decode response: %v", errDecode)
+	}
+	return nil
+}
+
+// withDefaultDuration returns fallback for unset durations
+func withDefaultDuration(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
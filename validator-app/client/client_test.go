@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/runtimeracer/ethereum-validator-go/apiserver"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testValidationService serves fixed data for a network without backend requests
+type testValidationService struct {
+	apiserver.ValidationService
+	network *validation.Network
+}
+
+func (s *testValidationService) GetNetwork(name string) (*validation.Network, error) {
+	if name != s.network.Name {
+		return nil, errors.New(validation.ErrUnknownNetwork)
+	}
+	return s.network, nil
+}
+
+func (s *testValidationService) GetDefaultNetwork() (*validation.Network, error) {
+	return s.network, nil
+}
+
+func (s *testValidationService) GetNetworks() []*validation.Network {
+	return []*validation.Network{s.network}
+}
+
+func (s *testValidationService) ResolveBlockID(network *validation.Network, blockID string) (uint64, error) {
+	return strconv.ParseUint(blockID, 10, 64)
+}
+
+func (s *testValidationService) GetBlockRewardSlot(network *validation.Network, slot uint64) (*validation.BlockRewardSlot, error) {
+	return &validation.BlockRewardSlot{Slot: slot, Status: validation.BlockStatusVanilla, Reward: 42}, nil
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	network := &validation.Network{
+		Name:                         "testnet",
+		BackendEndpoint:              "http://backend",
+		SecondsPerSlot:               12,
+		SlotsPerEpoch:                32,
+		EpochsPerSyncCommitteePeriod: 256,
+		Forks:                        []validation.ForkVersion{{Name: "phase0"}},
+	}
+	server, errNew := apiserver.New(apiserver.Options{
+		Logger:     logger,
+		Validation: &testValidationService{network: network},
+		Keystore:   apiserver.NewDefaultKeystore("key"),
+	})
+	if errNew != nil {
+		t.Fatal(errNew)
+	}
+	testServer := httptest.NewServer(server)
+	t.Cleanup(testServer.Close)
+	return testServer
+}
+
+func TestClient(t *testing.T) {
+	testServer := newTestServer(t)
+	client, errNew := New(Options{BaseURL: testServer.URL, Network: "testnet", APIKey: "key"})
+	if errNew != nil {
+		t.Fatal(errNew)
+	}
+
+	slot, errSlot := client.BlockReward(context.Background(), "8")
+	if errSlot != nil || slot.Slot != 8 || slot.Reward != 42 {
+		t.Fatalf("expected block reward of slot 8, got %+v (%v)", slot, errSlot)
+	}
+	token, expiresAt := client.Session()
+	if len(token) == 0 || expiresAt.Before(time.Now()) {
+		t.Errorf("expected session to be kept, got %q expiring %v", token, expiresAt)
+	}
+	slotTime, errTime := client.SlotTime(context.Background(), 2)
+	if errTime != nil || slotTime.Slot != 2 || slotTime.Timestamp != 24 {
+		t.Errorf("expected time of slot 2, got %+v (%v)", slotTime, errTime)
+	}
+
+	if errLogout := client.Logout(context.Background()); errLogout != nil {
+		t.Fatal(errLogout)
+	}
+	if token, _ = client.Session(); len(token) > 0 {
+		t.Errorf("expected session to be removed on logout, got %q", token)
+	}
+
+	unauthorized, _ := New(Options{BaseURL: testServer.URL, APIKey: "wrong"})
+	_, errSlot = unauthorized.BlockReward(context.Background(), "8")
+	var apiError *Error
+	if !errors.As(errSlot, &apiError) || apiError.StatusCode != 400 || apiError.Code != apiserver.INIT_SESSION_FAILED {
+		t.Errorf("expected failed authentication, got %v", errSlot)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var attempts atomic.Int32
+	var quotaExceeded atomic.Bool
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if quotaExceeded.Load() {
+			attempts.Add(1)
+			w.WriteHeader(429)
+			json.NewEncoder(w).Encode(&apiserver.ValidatorHttpError{Error: apiserver.QUOTA_EXCEEDED, Params: json.RawMessage(`"daily"`)})
+			return
+		}
+		switch attempts.Add(1) {
+		case 1:
+			w.WriteHeader(500)
+		case 2:
+			w.WriteHeader(503)
+		case 3:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(429)
+			json.NewEncoder(w).Encode(&apiserver.ValidatorHttpError{Error: apiserver.RATE_LIMITED, Params: json.RawMessage(`""`)})
+		default:
+			json.NewEncoder(w).Encode(&validation.BlockRewardSlot{Slot: 1})
+		}
+	}))
+	defer testServer.Close()
+
+	client, _ := New(Options{BaseURL: testServer.URL, RetryBackoff: time.Millisecond})
+	if _, errSlot := client.BlockReward(context.Background(), "1"); errSlot != nil || attempts.Load() != 4 {
+		t.Errorf("expected success after 3 retries, got %v attempts (%v)", attempts.Load(), errSlot)
+	}
+	// Internal errors are only retried for idempotent requests
+	if (&Error{StatusCode: 500, Method: http.MethodPost}).Temporary() {
+		t.Error("expected internal error of a POST request not to be temporary")
+	}
+
+	// Permanent errors aren't retried
+	attempts.Store(0)
+	quotaExceeded.Store(true)
+	_, errSlot := client.BlockReward(context.Background(), "1")
+	if !IsErrorCode(errSlot, apiserver.QUOTA_EXCEEDED) || attempts.Load() != 1 || !strings.Contains(errSlot.Error(), "daily") {
+		t.Errorf("expected quota error without retry, got %v attempts (%v)", attempts.Load(), errSlot)
+	}
+}
+
+func TestSubscribeBlockRewards(t *testing.T) {
+	var head atomic.Uint64
+	head.Store(10)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blockID := strings.TrimPrefix(r.URL.Path, "/blockreward/")
+		slot, _ := strconv.ParseUint(blockID, 10, 64)
+		if blockID == "head" {
+			slot = head.Load()
+		} else if slot%2 == 1 {
+			// Odd slots are missed
+			w.WriteHeader(404)
+			json.NewEncoder(w).Encode(&apiserver.ValidatorHttpError{Error: apiserver.NOT_FOUND, Params: json.RawMessage(`"slot does not exist"`)})
+			return
+		}
+		json.NewEncoder(w).Encode(&validation.BlockRewardSlot{Slot: slot})
+	}))
+	defer testServer.Close()
+	client, _ := New(Options{BaseURL: testServer.URL, PollInterval: 10 * time.Millisecond})
+
+	subscription, errSubscribe := client.SubscribeBlockRewards(context.Background())
+	if errSubscribe != nil {
+		t.Fatal(errSubscribe)
+	}
+	if slot := <-subscription.C; slot.Slot != 10 {
+		t.Fatalf("expected head first, got %v", slot.Slot)
+	}
+	// Skipped slots are delivered in order, missed ones are left out
+	head.Store(16)
+	for _, expected := range []uint64{12, 14, 16} {
+		if slot := <-subscription.C; slot.Slot != expected {
+			t.Fatalf("expected slot %v, got %v", expected, slot.Slot)
+		}
+	}
+	subscription.Close()
+	if _, ok := <-subscription.C; ok || subscription.Err() != nil {
+		t.Errorf("expected closed subscription without error, got %v", subscription.Err())
+	}
+}
@@ -0,0 +1,103 @@
+// Package client
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/apiserver"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error is an error response of the API. Code is the result of the ValidatorHttpError, e.g. apiserver.NOT_FOUND;
+// it's empty if the response wasn't sent by the API, e.g. by a proxy in front of it.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// Method is the HTTP method of the failed request
+	Method string
+	// RetryAfter is the wait requested by the server for rate limits and lockouts
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if len(e.Code) == 0 {
+		return fmt.Sprintf("api error %v: %v", e.StatusCode, e.Message)
+	}
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("api error %v: %v", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("api error %v: %v: %v", e.StatusCode, e.Code, e.Message)
+}
+
+// Temporary returns true if the request may succeed when it's sent again
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests:
+		// Quotas and lockouts don't end within a retry
+		return e.Code == apiserver.RATE_LIMITED || len(e.Code) == 0
+	case http.StatusBadGateway:
+		// Integrity check failures are reported with 502 as well; the backend keeps serving the same data
+		return e.Code != apiserver.INTEGRITY_CHECK_FAILED
+	case http.StatusInternalServerError:
+		// Mostly caused by failing backend requests; only idempotent requests are safe to send again
+		return e.Method == http.MethodGet
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsErrorCode returns true if err is an error response with the code
+func IsErrorCode(err error, code string) bool {
+	var apiError *Error
+	return errors.As(err, &apiError) && apiError.Code == code
+}
+
+// IsNotFound returns true if the slot, validator or route doesn't exist
+func IsNotFound(err error) bool {
+	return IsErrorCode(err, apiserver.NOT_FOUND)
+}
+
+// decodeError reads the ValidatorHttpError of an error response; other bodies are used as message
+func decodeError(response *http.Response) *Error {
+	apiError := &Error{
+		StatusCode: response.StatusCode,
+		Message:    http.StatusText(response.StatusCode),
+	}
+	if response.Request != nil {
+		apiError.Method = response.Request.Method
+	}
+	if retryAfter, errRetryAfter := strconv.Atoi(response.Header.Get("Retry-After")); errRetryAfter == nil {
+		apiError.RetryAfter = time.Duration(retryAfter) * time.Second
+	}
+
+	body, errRead := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if errRead != nil {
+		return apiError
+	}
+	httpError := &apiserver.ValidatorHttpError{}
+	if errDecode := json.Unmarshal(body, httpError); errDecode != nil || len(httpError.Error) == 0 {
+		return apiError
+	}
+	apiError.Code = httpError.Error
+	apiError.Message = ""
+	// Params are a JSON string for all errors of the server
+	if len(httpError.Params) > 0 {
+		var message string
+		if errMessage := json.Unmarshal(httpError.Params, &message); errMessage == nil {
+			apiError.Message = message
+		} else {
+			apiError.Message = string(httpError.Params)
+		}
+	}
+	return apiError
+}
@@ -0,0 +1,145 @@
+// Package client
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Subscription delivers the data of every new slot in order. C is closed when the subscription ends;
+// Err returns the reason afterwards. The server has no streaming endpoint, so subscriptions poll it.
+type Subscription[T any] struct {
+	C <-chan T
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+// Close ends the subscription and waits until C is closed
+func (s *Subscription[T]) Close() {
+	s.closeOnce.Do(s.cancel)
+	<-s.done
+}
+
+// Err waits until the subscription ended and returns the error it failed with; it's nil after Close
+func (s *Subscription[T]) Err() error {
+	<-s.done
+	return s.err
+}
+
+// SubscribeBlockRewards delivers the reward details of every new block, starting with the current head.
+// The server doesn't push data, so the head is polled once per slot and skipped slots are fetched in between;
+// missed slots don't have a block and are left out.
+func (c *Client) SubscribeBlockRewards(ctx context.Context) (*Subscription[*validation.BlockRewardSlot], error) {
+	return subscribe(ctx, c, c.BlockReward, func(slot *validation.BlockRewardSlot) uint64 { return slot.Slot })
+}
+
+// SubscribeSyncDuties delivers the sync duties of every new block like SubscribeBlockRewards
+func (c *Client) SubscribeSyncDuties(ctx context.Context) (*Subscription[*validation.SyncDutiesResponse], error) {
+	return subscribe(ctx, c, c.SyncDuties, func(duties *validation.SyncDutiesResponse) uint64 { return duties.Slot })
+}
+
+// subscribe fetches the head before returning, so authentication and network errors are reported by the caller
+func subscribe[T any](ctx context.Context, c *Client, fetch func(ctx context.Context, blockID string) (T, error), slotOf func(T) uint64) (*Subscription[T], error) {
+	head, errHead := fetch(ctx, "head")
+	if errHead != nil {
+		return nil, errHead
+	}
+	interval, errInterval := c.slotDuration(ctx, slotOf(head))
+	if errInterval != nil {
+		return nil, errInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	updates := make(chan T)
+	subscription := &Subscription[T]{C: updates, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(subscription.done)
+		defer close(updates)
+		defer cancel()
+		subscription.err = pollSlots(ctx, head, interval, updates, fetch, slotOf)
+		if ctx.Err() != nil {
+			// Closed or cancelled by the caller
+			subscription.err = nil
+		}
+	}()
+	return subscription, nil
+}
+
+// pollSlots sends the head and every slot following it until the context is done or a request fails
+func pollSlots[T any](ctx context.Context, head T, interval time.Duration, updates chan<- T, fetch func(ctx context.Context, blockID string) (T, error), slotOf func(T) uint64) error {
+	send := func(value T) error {
+		select {
+		case updates <- value:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if errSend := send(head); errSend != nil {
+		return errSend
+	}
+	lastSlot := slotOf(head)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		next, errHead := fetch(ctx, "head")
+		if errHead != nil {
+			return errHead
+		}
+		nextSlot := slotOf(next)
+		if nextSlot <= lastSlot {
+			continue
+		}
+		// Fill in the slots the head skipped since the last poll
+		for slot := lastSlot + 1; slot < nextSlot; slot++ {
+			value, errSlot := fetch(ctx, strconv.FormatUint(slot, 10))
+			if IsNotFound(errSlot) {
+				continue
+			} else if errSlot != nil {
+				return errSlot
+			}
+			if errSend := send(value); errSend != nil {
+				return errSend
+			}
+		}
+		if errSend := send(next); errSend != nil {
+			return errSend
+		}
+		lastSlot = nextSlot
+	}
+}
+
+// slotDuration returns the poll interval of subscriptions, which is the slot duration of the network
+func (c *Client) slotDuration(ctx context.Context, slot uint64) (time.Duration, error) {
+	if c.pollInterval > 0 {
+		return c.pollInterval, nil
+	}
+	current, errCurrent := c.SlotTime(ctx, slot)
+	if errCurrent != nil {
+		return 0, errCurrent
+	}
+	next, errNext := c.SlotTime(ctx, slot+1)
+	if errNext != nil {
+		return 0, errNext
+	}
+	if next.Timestamp <= current.Timestamp {
+		return 0, errors.New("unable to derive the slot duration of the network")
+	}
+	return time.Duration(next.Timestamp-current.Timestamp) * time.Second, nil
+}
@@ -0,0 +1,127 @@
+// Package cmd
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/constants"
+	"github.com/runtimeracer/ethereum-validator-go/export"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	exportRange   export.Range
+	exportNetwork string
+	exportFormat  string
+	exportOutput  string
+	exportWorkers int
+)
+
+// init sets up the command
+func init() {
+	exportCmd.Flags().StringVar(&exportRange.Slots, "slots", "", "inclusive slot range, e.g. 9000000-9000099")
+	exportCmd.Flags().StringVar(&exportRange.Epochs, "epochs", "", "inclusive epoch range, e.g. 281250-281252")
+	exportCmd.Flags().StringVar(&exportRange.From, "from", "", "start of a date range as date (YYYY-MM-DD, UTC) or RFC 3339 time")
+	exportCmd.Flags().StringVar(&exportRange.To, "to", "", "end of a date range as date (YYYY-MM-DD, inclusive) or RFC 3339 time; defaults to now")
+	exportCmd.Flags().StringVar(&exportNetwork, "network", "", fmt.Sprintf("network to export (default is $%v_NETWORK or mainnet)", constants.EnvPrefix))
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", fmt.Sprintf("output format (%v); defaults to the extension of --output", strings.Join(export.Formats, ", ")))
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "output file")
+	exportCmd.Flags().IntVar(&exportWorkers, "workers", 4, "slots computed concurrently")
+	if err := exportCmd.MarkFlagRequired("output"); err != nil {
+		fmt.Println(err)
+	}
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the block rewards of a slot, epoch or date range to CSV, JSON Lines or Parquet",
+	Long: `Exports the block rewards of a slot, epoch or date range to CSV, JSON Lines or Parquet.
+Rows contain the MEV status, relays and fee recipient of every proposed block; missed slots are left out.
+An interrupted export resumes when the command is run again with the same options.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := exportFormat
+		if len(format) == 0 {
+			format = export.FormatFromPath(exportOutput)
+		}
+		if len(format) == 0 {
+			return fmt.Errorf("unable to tell the format from %v; set --format", exportOutput)
+		}
+		if exportWorkers <= 0 {
+			return errors.New("--workers must be at least 1")
+		}
+
+		var network *validation.Network
+		var errNetwork error
+		if len(exportNetwork) == 0 {
+			network, errNetwork = validation.GetDefaultNetwork()
+		} else {
+			network, errNetwork = validation.GetNetwork(exportNetwork)
+		}
+		if errNetwork != nil {
+			return errNetwork
+		}
+		if !network.IsConfigured() {
+			return fmt.Errorf("no backend configured for network %v; configure $%v_%v_BACKEND_ENDPOINT", network.Name, constants.EnvPrefix, strings.ToUpper(network.Name))
+		}
+		first, last, errRange := exportRange.Resolve(network)
+		if errRange != nil {
+			return errRange
+		}
+		// Stop on Ctrl+C; the progress is kept for the next run
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		// Finality is only verified if a light client checkpoint is configured
+		if errLightClient := validation.InitLightClient(ctx); errLightClient != nil {
+			return errLightClient
+		}
+
+		fmt.Fprintf(os.Stderr, "Exporting %v slots %v-%v to %v\n", network.Name, first, last, exportOutput)
+		started := time.Now()
+		lastReport := time.Time{}
+		errExport := export.ToFile(ctx, export.FileOptions{
+			Network: network,
+			First:   first,
+			Last:    last,
+			Format:  format,
+			Path:    exportOutput,
+			Workers: exportWorkers,
+			Progress: func(progress export.Progress) {
+				if time.Since(lastReport) < 250*time.Millisecond && progress.Done < progress.Total {
+					return
+				}
+				lastReport = time.Now()
+				printExportProgress(progress, started)
+			},
+		})
+		fmt.Fprintln(os.Stderr)
+		if ctx.Err() != nil {
+			return errors.New("export interrupted; run the same command again to resume")
+		} else if errExport != nil {
+			return fmt.Errorf("export failed; run the same command again to resume: %v", errExport)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %v in %v\n", exportOutput, time.Since(started).Round(time.Second))
+		return nil
+	},
+}
+
+// printExportProgress updates the progress line; the rate and ETA only count the slots of this run
+func printExportProgress(progress export.Progress, started time.Time) {
+	line := fmt.Sprintf("%v/%v slots (%.1f%%), %v rows", progress.Done, progress.Total, 100*float64(progress.Done)/float64(progress.Total), progress.Rows)
+	if done := progress.Done - progress.Resumed; done > 0 {
+		rate := float64(done) / time.Since(started).Seconds()
+		remaining := time.Duration(float64(progress.Total-progress.Done) / rate * float64(time.Second))
+		line += fmt.Sprintf(", %.1f slots/s, ETA %v", rate, remaining.Round(time.Second))
+	}
+	fmt.Fprintf(os.Stderr, "\r%-80v", line)
+}
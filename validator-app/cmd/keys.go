@@ -0,0 +1,386 @@
+// Package cmd
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/apiserver"
+	"github.com/runtimeracer/ethereum-validator-go/constants"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	keyLabel   string
+	keyScopes  []string
+	keyExpires string
+
+	keyLimits      apiserver.KeyLimits
+	keyRouteLimits []string
+
+	keyIPRules apiserver.IPRules
+)
+
+// init sets up the command
+func init() {
+	keysCmd.PersistentFlags().String("keystore", "", fmt.Sprintf("keystore file (default is $%v_KEYSTORE_FILE)", constants.EnvPrefix))
+	if err := viper.BindPFlag("KEYSTORE_FILE", keysCmd.PersistentFlags().Lookup("keystore")); err != nil {
+		fmt.Println(err)
+	}
+
+	keysCreateCmd.Flags().StringVar(&keyLabel, "label", "", "label describing the owner of the key")
+	keysCreateCmd.Flags().StringSliceVar(&keyScopes, "scopes", []string{apiserver.ScopeReadBlockReward, apiserver.ScopeReadSyncDuties},
+		fmt.Sprintf("scopes granted to the key (%v)", strings.Join(apiserver.KnownScopes, ", ")))
+	keysCreateCmd.Flags().StringVar(&keyExpires, "expires", "", "expiry as duration (e.g. 720h) or RFC 3339 time; never expires if empty")
+
+	keysAddressAddCmd.Flags().StringVar(&keyLabel, "label", "", "label describing the owner of the address")
+	keysAddressAddCmd.Flags().StringSliceVar(&keyScopes, "scopes", []string{apiserver.ScopeReadBlockReward, apiserver.ScopeReadSyncDuties},
+		fmt.Sprintf("scopes granted to the address (%v)", strings.Join(apiserver.KnownScopes, ", ")))
+	keysAddressAddCmd.Flags().StringVar(&keyExpires, "expires", "", "expiry as duration (e.g. 720h) or RFC 3339 time; never expires if empty")
+
+	keysLimitCmd.Flags().Float64Var(&keyLimits.RequestsPerSecond, "rps", 0, "requests per second per route; 0 keeps the default")
+	keysLimitCmd.Flags().IntVar(&keyLimits.Burst, "burst", 0, "burst size per route; 0 keeps the default")
+	keysLimitCmd.Flags().Int64Var(&keyLimits.DailyQuota, "daily-quota", 0, "requests per UTC day; 0 keeps the default")
+	keysLimitCmd.Flags().Int64Var(&keyLimits.MonthlyQuota, "monthly-quota", 0, "requests per UTC month; 0 keeps the default")
+	keysLimitCmd.Flags().StringSliceVar(&keyRouteLimits, "route", nil, "route specific limit as <route>=<rps>:<burst>, e.g. blockreward=2:5")
+
+	keysIPRulesCmd.Flags().StringSliceVar(&keyIPRules.Allow, "allow", nil, "IPs or CIDRs requests are accepted from; all IPs if empty")
+	keysIPRulesCmd.Flags().StringSliceVar(&keyIPRules.Deny, "deny", nil, "IPs or CIDRs requests are rejected from; takes precedence over --allow")
+
+	keysAddressCmd.AddCommand(keysAddressAddCmd, keysAddressListCmd, keysAddressRemoveCmd)
+	keysCmd.AddCommand(keysCreateCmd, keysListCmd, keysRevokeCmd, keysRotateCmd, keysLimitCmd, keysIPRulesCmd, keysCertCmd, keysAddressCmd)
+	rootCmd.AddCommand(keysCmd)
+}
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manages the API keys and address rules in the keystore file of " + constants.AppName,
+	Args:  cobra.NoArgs,
+	RunE:  showHelp,
+}
+
+var keysCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a new API key and prints its secret once",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expiresAt, errExpires := parseKeyExpiry(keyExpires)
+		if errExpires != nil {
+			return errExpires
+		}
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+
+		secret, key, errCreate := keystore.CreateKey(keyLabel, keyScopes, expiresAt)
+		if errCreate != nil {
+			return errCreate
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Created API key '%v' (%v)\n", key.Id, key.Label)
+		fmt.Fprintf(cmd.OutOrStdout(), "Secret: %v\n", secret)
+		fmt.Fprintln(cmd.OutOrStdout(), "Store the secret safely; it can't be shown again.")
+		return nil
+	},
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all API keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tLABEL\tSCOPES\tENABLED\tSIGNING\tEXPIRES\tIP RULES")
+		for _, key := range keystore.ListKeys() {
+			expires := "never"
+			if key.ExpiresAt != nil {
+				expires = key.ExpiresAt.Format(time.RFC3339)
+			}
+			// Keys without a signing key can't sign requests until they're rotated
+			signing := "yes"
+			if !key.HasSigningKey() {
+				signing = "rotate"
+			}
+			fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", key.Id, key.Label, strings.Join(key.Scopes, ","), key.Enabled, signing, expires, formatIPRules(key.IPRules))
+		}
+		if globalRules := keystore.GetIPRules(); !globalRules.IsEmpty() {
+			fmt.Fprintf(writer, "\nGlobal IP rules: %v\n", formatIPRules(globalRules))
+		}
+		return writer.Flush()
+	},
+}
+
+var keysRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Disables an API key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+		if errRevoke := keystore.RevokeKey(args[0]); errRevoke != nil {
+			return errRevoke
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Revoked API key '%v'\n", args[0])
+		return nil
+	},
+}
+
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate <id>",
+	Short: "Replaces the secret of an API key and prints the new secret once",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+		secret, errRotate := keystore.RotateKey(args[0])
+		if errRotate != nil {
+			return errRotate
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Rotated API key '%v'\n", args[0])
+		fmt.Fprintf(cmd.OutOrStdout(), "Secret: %v\n", secret)
+		fmt.Fprintln(cmd.OutOrStdout(), "Store the secret safely; it can't be shown again.")
+		return nil
+	},
+}
+
+var keysLimitCmd = &cobra.Command{
+	Use:   "limit <id>",
+	Short: "Sets the rate limits and quotas of an API key; without flags the defaults are restored",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+
+		var limits *apiserver.KeyLimits
+		if cmd.Flags().NFlag() > 0 {
+			limits = &keyLimits
+			for _, routeLimit := range keyRouteLimits {
+				route, limit, errRoute := parseRouteLimit(routeLimit)
+				if errRoute != nil {
+					return errRoute
+				}
+				if limits.Routes == nil {
+					limits.Routes = make(map[string]apiserver.RateLimit)
+				}
+				limits.Routes[route] = limit
+			}
+		}
+		if errLimits := keystore.SetKeyLimits(args[0], limits); errLimits != nil {
+			return errLimits
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Updated limits of API key '%v'\n", args[0])
+		return nil
+	},
+}
+
+var keysIPRulesCmd = &cobra.Command{
+	Use:   "ip-rules [id]",
+	Short: "Sets the IP allowlist and denylist of an API key, or the global rules if no id is given; without flags the rules are removed",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+
+		var id string
+		if len(args) > 0 {
+			id = args[0]
+		}
+		if errRules := keystore.SetIPRules(id, &keyIPRules); errRules != nil {
+			return errRules
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		if len(id) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "Updated global IP rules")
+		} else {
+			fmt.Fprintf(cmd.OutOrStdout(), "Updated IP rules of API key '%v'\n", id)
+		}
+		return nil
+	},
+}
+
+var keysCertCmd = &cobra.Command{
+	Use:   "cert <id> [name...]",
+	Short: "Maps client certificate subjects or SANs to an API key for mTLS authentication; without names the mapping is removed",
+	Long: `Maps client certificate subjects or SANs to an API key for mTLS authentication; without names the mapping is removed.
+A name matches the full subject (e.g. "CN=indexer,O=Example"), the common name, a DNS or email SAN, or a URI SAN (e.g. "spiffe://cluster/ns/indexer").`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+		if errNames := keystore.SetCertNames(args[0], args[1:]); errNames != nil {
+			return errNames
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Updated client certificate names of API key '%v'\n", args[0])
+		return nil
+	},
+}
+
+var keysAddressCmd = &cobra.Command{
+	Use:   "address",
+	Short: "Manages the access rules of addresses signing in with Ethereum",
+	Args:  cobra.NoArgs,
+	RunE:  showHelp,
+}
+
+var keysAddressAddCmd = &cobra.Command{
+	Use:   "add <address>",
+	Short: "Grants scopes to an address; replaces an existing rule",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expiresAt, errExpires := parseKeyExpiry(keyExpires)
+		if errExpires != nil {
+			return errExpires
+		}
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+		rule, errRule := keystore.SetAddressRule(args[0], keyLabel, keyScopes, expiresAt)
+		if errRule != nil {
+			return errRule
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Granted %v to address %v\n", strings.Join(rule.Scopes, ","), rule.Address)
+		return nil
+	},
+}
+
+var keysAddressListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all address rules",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ADDRESS\tLABEL\tSCOPES\tENABLED\tEXPIRES")
+		for _, rule := range keystore.ListAddressRules() {
+			expires := "never"
+			if rule.ExpiresAt != nil {
+				expires = rule.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\n", rule.Address, rule.Label, strings.Join(rule.Scopes, ","), rule.Enabled, expires)
+		}
+		return writer.Flush()
+	},
+}
+
+var keysAddressRemoveCmd = &cobra.Command{
+	Use:   "remove <address>",
+	Short: "Removes the rule of an address",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keystore, errKeystore := loadKeystore()
+		if errKeystore != nil {
+			return errKeystore
+		}
+		if errRemove := keystore.RemoveAddressRule(args[0]); errRemove != nil {
+			return errRemove
+		}
+		if errSave := keystore.Save(); errSave != nil {
+			return errSave
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed rule of address %v\n", args[0])
+		return nil
+	},
+}
+
+func loadKeystore() (*apiserver.Keystore, error) {
+	keystoreFile := viper.GetString("KEYSTORE_FILE")
+	if len(keystoreFile) == 0 {
+		return nil, fmt.Errorf(constants.ErrMissingEnvVar, constants.EnvPrefix+"_KEYSTORE_FILE")
+	}
+	return apiserver.LoadKeystore(keystoreFile)
+}
+
+// formatIPRules returns the rules as allow=<cidrs> deny=<cidrs>, or "-" if there are none
+func formatIPRules(rules *apiserver.IPRules) string {
+	if rules.IsEmpty() {
+		return "-"
+	}
+	parts := make([]string, 0, 2)
+	if len(rules.Allow) > 0 {
+		parts = append(parts, "allow="+strings.Join(rules.Allow, ","))
+	}
+	if len(rules.Deny) > 0 {
+		parts = append(parts, "deny="+strings.Join(rules.Deny, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseRouteLimit parses a route limit in the format <route>=<rps>:<burst>
+func parseRouteLimit(value string) (string, apiserver.RateLimit, error) {
+	limit := apiserver.RateLimit{}
+	route, spec, found := strings.Cut(value, "=")
+	rps, burst, foundBurst := strings.Cut(spec, ":")
+	if !found || !foundBurst {
+		return "", limit, fmt.Errorf("invalid route limit: %v", value)
+	}
+	var errRps, errBurst error
+	limit.RequestsPerSecond, errRps = strconv.ParseFloat(rps, 64)
+	limit.Burst, errBurst = strconv.Atoi(burst)
+	if errRps != nil || errBurst != nil {
+		return "", limit, fmt.Errorf("invalid route limit: %v", value)
+	}
+	return route, limit, nil
+}
+
+// parseKeyExpiry parses a duration relative to now or an absolute RFC 3339 time
+func parseKeyExpiry(value string) (*time.Time, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	if duration, errDuration := time.ParseDuration(value); errDuration == nil {
+		expiresAt := time.Now().UTC().Add(duration)
+		return &expiresAt, nil
+	}
+	expiresAt, errTime := time.Parse(time.RFC3339, value)
+	if errTime != nil {
+		return nil, errors.New("invalid expiry; use a duration like 720h or an RFC 3339 time")
+	}
+	return &expiresAt, nil
+}
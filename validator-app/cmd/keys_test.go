@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/runtimeracer/ethereum-validator-go/apiserver"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	createdKeyPattern = regexp.MustCompile(`Created API key '([^']+)'`)
+	secretPattern     = regexp.MustCompile(`Secret: (\S+)`)
+)
+
+func TestKeysCommands(t *testing.T) {
+	keystorePath := filepath.Join(t.TempDir(), "keystore.json")
+
+	// Create prints the secret once and stores the key
+	output, errCreate := executeCommand(t, "keys", "--keystore", keystorePath, "create", "--label", "indexer", "--scopes", apiserver.ScopeReadBlockReward)
+	if errCreate != nil {
+		t.Fatalf("create failed: %v: %v", errCreate, output)
+	}
+	created, secret := createdKeyPattern.FindStringSubmatch(output), secretPattern.FindStringSubmatch(output)
+	if created == nil || secret == nil {
+		t.Fatalf("expected key id and secret, got %q", output)
+	}
+	id := created[1]
+	keystore, errLoad := apiserver.LoadKeystore(keystorePath)
+	if errLoad != nil {
+		t.Fatal(errLoad)
+	}
+	if key, errAuth := keystore.Authenticate(secret[1]); errAuth != nil || key.Id != id || key.Label != "indexer" {
+		t.Fatalf("expected created key to authenticate, got %+v (%v)", key, errAuth)
+	}
+
+	// List shows the key but not its secret
+	output, errList := executeCommand(t, "keys", "--keystore", keystorePath, "list")
+	if errList != nil || !strings.Contains(output, id) || !strings.Contains(output, apiserver.ScopeReadBlockReward) || strings.Contains(output, secret[1]) {
+		t.Fatalf("expected key in list, got %q (%v)", output, errList)
+	}
+
+	// Rotate replaces the secret
+	output, errRotate := executeCommand(t, "keys", "--keystore", keystorePath, "rotate", id)
+	rotated := secretPattern.FindStringSubmatch(output)
+	if errRotate != nil || rotated == nil || rotated[1] == secret[1] {
+		t.Fatalf("expected new secret, got %q (%v)", output, errRotate)
+	}
+	if keystore, errLoad = apiserver.LoadKeystore(keystorePath); errLoad != nil {
+		t.Fatal(errLoad)
+	}
+	if _, errAuth := keystore.Authenticate(secret[1]); errAuth == nil {
+		t.Error("expected previous secret to be rejected")
+	}
+	if key, errAuth := keystore.Authenticate(rotated[1]); errAuth != nil || key.Id != id {
+		t.Errorf("expected rotated secret to authenticate, got %+v (%v)", key, errAuth)
+	}
+
+	// Revoke disables the key
+	if output, errRevoke := executeCommand(t, "keys", "--keystore", keystorePath, "revoke", id); errRevoke != nil {
+		t.Fatalf("revoke failed: %v: %v", errRevoke, output)
+	}
+	if keystore, errLoad = apiserver.LoadKeystore(keystorePath); errLoad != nil {
+		t.Fatal(errLoad)
+	}
+	if _, errAuth := keystore.Authenticate(rotated[1]); errAuth == nil {
+		t.Error("expected revoked key to be rejected")
+	}
+	if output, errList = executeCommand(t, "keys", "--keystore", keystorePath, "list"); errList != nil || !strings.Contains(output, "false") {
+		t.Errorf("expected revoked key to be listed as disabled, got %q (%v)", output, errList)
+	}
+
+	// Unknown keys fail
+	if _, errRevoke := executeCommand(t, "keys", "--keystore", keystorePath, "revoke", "unknown"); errRevoke == nil {
+		t.Error("expected revoking an unknown key to fail")
+	}
+	if _, errRotate = executeCommand(t, "keys", "--keystore", keystorePath, "rotate", "unknown"); errRotate == nil {
+		t.Error("expected rotating an unknown key to fail")
+	}
+}
@@ -5,10 +5,11 @@ Copyright © 2024 RuntimeRacer
 package cmd
 
 import (
-	"context"
 	"github.com/runtimeracer/ethereum-validator-go/apiserver"
 	"github.com/runtimeracer/ethereum-validator-go/constants"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"os"
 )
 
 // init sets up the command
@@ -20,8 +21,18 @@ var launchCmd = &cobra.Command{
 	Use:   "launch",
 	Short: "Launches " + constants.AppName + " based on config and environment",
 	Run: func(cmd *cobra.Command, args []string) {
+		requireApiKeyConfig()
+
 		// Init Validator API Server
-		server := apiserver.Init(args)
-		server.Start(context.Background())
+		server, errInit := apiserver.Init(args)
+		if errInit != nil {
+			log.Error(errInit)
+			os.Exit(constants.ExitCodeStartFailed)
+		}
+		errStart := server.Start(cmd.Context())
+		if errStart != nil {
+			log.Error(errStart)
+		}
+		os.Exit(apiserver.ExitCode(errStart))
 	},
 }
@@ -0,0 +1,187 @@
+// Package cmd
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/client"
+	"github.com/runtimeracer/ethereum-validator-go/constants"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+var (
+	queryNetwork string
+	queryOutput  string
+	queryRemote  string
+	queryApiKey  string
+)
+
+// init sets up the commands
+func init() {
+	for _, queryCmd := range []*cobra.Command{blockRewardCmd, syncDutiesCmd} {
+		queryCmd.Flags().StringVar(&queryNetwork, "network", "", fmt.Sprintf("network to query (default is $%v_NETWORK or mainnet)", constants.EnvPrefix))
+		queryCmd.Flags().StringVarP(&queryOutput, "output", "o", OutputTable, fmt.Sprintf("output format (%v, %v)", OutputTable, OutputJSON))
+		queryCmd.Flags().StringVar(&queryRemote, "remote", "", "URL of an API server to query instead of the configured backend")
+		queryCmd.Flags().StringVar(&queryApiKey, "api-key", "", fmt.Sprintf("API key of the --remote server (default is $%v_API_KEY)", constants.EnvPrefix))
+		rootCmd.AddCommand(queryCmd)
+	}
+}
+
+var blockRewardCmd = &cobra.Command{
+	Use:   "blockreward <slot>",
+	Short: "Shows the block reward of a slot",
+	Long: `Shows the block reward of a slot, queried from the configured backend or the API server given by --remote.
+The slot is a slot number, head, finalized, justified, genesis, a 0x prefixed block root or an RFC 3339 timestamp.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if errOutput := checkQueryOutput(); errOutput != nil {
+			return errOutput
+		}
+		var slot *validation.BlockRewardSlot
+		if len(queryRemote) > 0 {
+			apiClient, errClient := newQueryClient()
+			if errClient != nil {
+				return errClient
+			}
+			var errSlot error
+			if slot, errSlot = apiClient.BlockReward(cmd.Context(), args[0]); errSlot != nil {
+				return errSlot
+			}
+		} else {
+			network, slotNumber, errResolve := resolveQuerySlot(cmd.Context(), args[0])
+			if errResolve != nil {
+				return errResolve
+			}
+			var errSlot error
+			if slot, errSlot = validation.GetBlockRewardSlot(network, slotNumber); errSlot != nil {
+				return errSlot
+			}
+		}
+
+		if queryOutput == OutputJSON {
+			return printJSON(slot)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "SLOT\tSTATUS\tREWARD (GWEI)\tVERIFIED\tFINALITY VERIFIED")
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\n", slot.Slot, slot.Status, slot.Reward, slot.Verified, slot.FinalityVerified)
+		return writer.Flush()
+	},
+}
+
+var syncDutiesCmd = &cobra.Command{
+	Use:   "syncduties <slot>",
+	Short: "Shows the validators with sync committee duties in a slot",
+	Long: `Shows the validators with sync committee duties in a slot, queried from the configured backend or the API server given by --remote.
+The slot is a slot number, head, finalized, justified, genesis, a 0x prefixed block root or an RFC 3339 timestamp.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if errOutput := checkQueryOutput(); errOutput != nil {
+			return errOutput
+		}
+		var duties *validation.SyncDutiesResponse
+		if len(queryRemote) > 0 {
+			apiClient, errClient := newQueryClient()
+			if errClient != nil {
+				return errClient
+			}
+			var errDuties error
+			if duties, errDuties = apiClient.SyncDuties(cmd.Context(), args[0]); errDuties != nil {
+				return errDuties
+			}
+		} else {
+			network, slotNumber, errResolve := resolveQuerySlot(cmd.Context(), args[0])
+			if errResolve != nil {
+				return errResolve
+			}
+			var errDuties error
+			if duties, errDuties = validation.GetSyncDuties(network, slotNumber); errDuties != nil {
+				return errDuties
+			}
+		}
+
+		if queryOutput == OutputJSON {
+			return printJSON(duties)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "SLOT\tPUBLIC KEY")
+		for _, pubkey := range duties.PublicValidatorKeys {
+			fmt.Fprintf(writer, "%v\t%v\n", duties.Slot, pubkey)
+		}
+		return writer.Flush()
+	},
+}
+
+func checkQueryOutput() error {
+	if queryOutput != OutputTable && queryOutput != OutputJSON {
+		return fmt.Errorf("unknown output format %q; use %v or %v", queryOutput, OutputTable, OutputJSON)
+	}
+	return nil
+}
+
+// newQueryClient returns a client of the --remote server
+func newQueryClient() (*client.Client, error) {
+	apiKey := queryApiKey
+	if len(apiKey) == 0 {
+		apiKey = viper.GetString("API_KEY")
+	}
+	if len(apiKey) == 0 {
+		return nil, fmt.Errorf(constants.ErrMissingEnvVar, constants.EnvPrefix+"_API_KEY")
+	}
+	return client.New(client.Options{BaseURL: queryRemote, Network: queryNetwork, APIKey: apiKey})
+}
+
+// resolveQuerySlot returns the network and slot of a local query; slots are resolved like by the API server
+func resolveQuerySlot(ctx context.Context, value string) (*validation.Network, uint64, error) {
+	var network *validation.Network
+	var errNetwork error
+	if len(queryNetwork) == 0 {
+		network, errNetwork = validation.GetDefaultNetwork()
+	} else {
+		network, errNetwork = validation.GetNetwork(queryNetwork)
+	}
+	if errNetwork != nil {
+		return nil, 0, errNetwork
+	}
+	if !network.IsConfigured() {
+		return nil, 0, fmt.Errorf("no backend configured for network %v; configure $%v_%v_BACKEND_ENDPOINT or use --remote", network.Name, constants.EnvPrefix, strings.ToUpper(network.Name))
+	}
+	// Finality is only verified if a light client checkpoint is configured
+	if errLightClient := validation.InitLightClient(ctx); errLightClient != nil {
+		return nil, 0, errLightClient
+	}
+
+	if timestamp, errTime := time.Parse(time.RFC3339, value); errTime == nil {
+		slot, errSlot := network.SlotAtTimestamp(timestamp.Unix())
+		return network, slot, errSlot
+	}
+	slot, errSlot := validation.ResolveBlockID(network, value)
+	if errSlot != nil {
+		return nil, 0, errSlot
+	}
+	return network, slot, nil
+}
+
+// printJSON writes the value as indented JSON to stdout
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if errEncode := encoder.Encode(value); errEncode != nil {
+		return fmt.Errorf("failed to encode output: %v", errEncode)
+	}
+	return nil
+}
@@ -33,18 +33,28 @@ to quickly create a Cobra application.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	// Check if a default command is defined
-	// https://github.com/spf13/cobra/issues/823
-	cmd, _, errArgs := rootCmd.Find(os.Args[1:])
-	// default cmd if no cmd is given
-	if errArgs != nil || cmd.Args == nil {
-		args := append([]string{"launch"}, os.Args[1:]...)
-		rootCmd.SetArgs(args)
+	rootCmd.SetArgs(withDefaultCommand(os.Args[1:]))
+	// Cobra already printed the error; unlike a failed server start, command errors don't need to stay visible
+	if errExecute := rootCmd.Execute(); errExecute != nil {
+		os.Exit(constants.ExitCodeCommandFailed)
 	}
+}
 
-	if errExecute := rootCmd.Execute(); errExecute != nil {
-		delayedShutdownWithExitCode(errExecute, "", 1, 10)
+// withDefaultCommand prepends the launch command if the arguments contain no command.
+// Unknown commands are left to fail, so a typo doesn't start the server.
+// https://github.com/spf13/cobra/issues/823
+func withDefaultCommand(args []string) []string {
+	cmd, _, errArgs := rootCmd.Find(args)
+	if errArgs == nil && cmd == rootCmd {
+		return append([]string{"launch"}, args...)
 	}
+	return args
+}
+
+// showHelp is run by commands which only group subcommands; combined with cobra.NoArgs, unknown subcommands fail
+// instead of showing the help, since cobra only checks them for the root command
+func showHelp(cmd *cobra.Command, args []string) error {
+	return cmd.Help()
 }
 
 func delayedShutdownWithExitCode(err error, solutionHint string, exitCode, shutdownSeconds int) {
@@ -74,13 +84,16 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	bindFlags(rootCmd)
+}
 
-	// Ensure default API Key is set
+// requireApiKeyConfig ensures the default API Key is set, unless the API keys are managed in a keystore file.
+// Only the server needs it; query and key management commands work without.
+func requireApiKeyConfig() {
 	defaultApiKey := viper.GetString("DEFAULT_API_KEY")
-	if len(defaultApiKey) == 0 {
+	if len(defaultApiKey) == 0 && len(viper.GetString("KEYSTORE_FILE")) == 0 {
 		fmt.Println("FATAL: No default API Key was provided.")
 		solutionHint := "This application requires an API Key for security reasons. Please check the documentation for details."
-		delayedShutdownWithExitCode(fmt.Errorf("unable to read config.json file (maybe it is missing): %v"), solutionHint, 1, 10)
+		delayedShutdownWithExitCode(fmt.Errorf(constants.ErrMissingEnvVar, constants.EnvPrefix+"_DEFAULT_API_KEY"), solutionHint, 1, 10)
 	}
 }
 
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// executeCommand runs the root command with the arguments like Execute and returns its output
+func executeCommand(t *testing.T, args ...string) (string, error) {
+	output := &bytes.Buffer{}
+	rootCmd.SetOut(output)
+	rootCmd.SetErr(output)
+	rootCmd.SetArgs(withDefaultCommand(args))
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+	})
+	errExecute := rootCmd.Execute()
+	return output.String(), errExecute
+}
+
+func TestWithDefaultCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{}, []string{"launch"}},
+		{[]string{"launch"}, []string{"launch"}},
+		{[]string{"version"}, []string{"version"}},
+		{[]string{"keys", "list"}, []string{"keys", "list"}},
+		// Typos are left to fail instead of starting the server
+		{[]string{"lauch"}, []string{"lauch"}},
+		{[]string{"keys", "lst"}, []string{"keys", "lst"}},
+		{[]string{"keys", "address", "ad"}, []string{"keys", "address", "ad"}},
+	}
+	for _, test := range tests {
+		if args := withDefaultCommand(test.args); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("expected %v for %v, got %v", test.expected, test.args, args)
+		}
+	}
+}
+
+func TestUnknownSubcommand(t *testing.T) {
+	for _, args := range [][]string{{"lauch"}, {"keys", "lst"}, {"keys", "address", "ad"}} {
+		output, errExecute := executeCommand(t, args...)
+		if errExecute == nil || !strings.Contains(errExecute.Error(), "unknown command") {
+			t.Errorf("expected %v to fail as unknown command, got %v: %v", args, errExecute, output)
+		}
+	}
+}
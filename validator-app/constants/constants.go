@@ -11,6 +11,13 @@ const (
 
 	// Generic constants
 	EnvPrefix = "ETHVAL"
+
+	// Exit codes of the launch command
+	ExitCodeOK             = 0 // Stopped after all requests completed
+	ExitCodeStartFailed    = 1 // Invalid config or listeners couldn't be opened
+	ExitCodeShutdownFailed = 2 // Requests were still in flight after the drain timeout, or a second signal forced the exit
+	// Exit code of the other commands
+	ExitCodeCommandFailed = 1
 )
 
 var (
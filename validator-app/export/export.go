@@ -0,0 +1,140 @@
+// Package export
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Formats are the supported output formats
+var Formats = []string{FormatCSV, FormatJSONL, FormatParquet}
+
+// Row is the block reward of a slot as it's exported
+type Row struct {
+	Slot             uint64   `json:"slot" parquet:"slot"`
+	Epoch            uint64   `json:"epoch" parquet:"epoch"`
+	Time             string   `json:"time" parquet:"time"`
+	ProposerIndex    uint64   `json:"proposer_index" parquet:"proposer_index"`
+	BlockNumber      uint64   `json:"block_number" parquet:"block_number"`
+	Status           string   `json:"status" parquet:"status"`
+	RewardGwei       float64  `json:"reward_gwei" parquet:"reward_gwei"`
+	FeeRecipient     string   `json:"fee_recipient" parquet:"fee_recipient"`
+	Relays           []string `json:"relays" parquet:"relays,list"`
+	Verified         bool     `json:"verified" parquet:"verified"`
+	FinalityVerified bool     `json:"finality_verified" parquet:"finality_verified"`
+}
+
+// csvHeader are the columns of CSV exports; they follow the fields of Row
+var csvHeader = []string{"slot", "epoch", "time", "proposer_index", "block_number", "status", "reward_gwei", "fee_recipient", "relays", "verified", "finality_verified"}
+
+// NewRow returns the row of a block reward
+func NewRow(network *validation.Network, reward *validation.BlockRewardSlot) *Row {
+	relays := reward.Relays
+	if relays == nil {
+		relays = make([]string, 0)
+	}
+	return &Row{
+		Slot:             reward.Slot,
+		Epoch:            network.EpochAtSlot(reward.Slot),
+		Time:             time.Unix(int64(network.SlotTimestamp(reward.Slot)), 0).UTC().Format(time.RFC3339),
+		ProposerIndex:    reward.ProposerIndex,
+		BlockNumber:      reward.BlockNumber,
+		Status:           reward.Status,
+		RewardGwei:       reward.Reward,
+		FeeRecipient:     reward.FeeRecipient,
+		Relays:           relays,
+		Verified:         reward.Verified,
+		FinalityVerified: reward.FinalityVerified,
+	}
+}
+
+// RowWriter writes rows in a streamable format; Flush writes buffered rows to the underlying writer
+type RowWriter interface {
+	Write(row *Row) error
+	Flush() error
+}
+
+// NewRowWriter returns a writer of the CSV or JSONL format. The CSV header is written with the first row
+// unless the output is appended to an export which already has it.
+func NewRowWriter(format string, w io.Writer, hasHeader bool) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvRowWriter{writer: csv.NewWriter(w), hasHeader: hasHeader}, nil
+	case FormatJSONL:
+		buffered := bufio.NewWriter(w)
+		return &jsonlRowWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	default:
+		return nil, fmt.Errorf("format %q can't be streamed; use %v or %v", format, FormatCSV, FormatJSONL)
+	}
+}
+
+type csvRowWriter struct {
+	writer    *csv.Writer
+	hasHeader bool
+}
+
+func (c *csvRowWriter) Write(row *Row) error {
+	if !c.hasHeader {
+		if errHeader := c.writer.Write(csvHeader); errHeader != nil {
+			return errHeader
+		}
+		c.hasHeader = true
+	}
+	return c.writer.Write([]string{
+		strconv.FormatUint(row.Slot, 10),
+		strconv.FormatUint(row.Epoch, 10),
+		row.Time,
+		strconv.FormatUint(row.ProposerIndex, 10),
+		strconv.FormatUint(row.BlockNumber, 10),
+		row.Status,
+		strconv.FormatFloat(row.RewardGwei, 'f', -1, 64),
+		row.FeeRecipient,
+		strings.Join(row.Relays, ";"),
+		strconv.FormatBool(row.Verified),
+		strconv.FormatBool(row.FinalityVerified),
+	})
+}
+
+func (c *csvRowWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type jsonlRowWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (j *jsonlRowWriter) Write(row *Row) error {
+	return j.encoder.Encode(row)
+}
+
+func (j *jsonlRowWriter) Flush() error {
+	return j.buffered.Flush()
+}
+
+// FormatFromPath returns the format matching the extension of the path; it's empty for unknown extensions
+func FormatFromPath(path string) string {
+	for _, format := range Formats {
+		if strings.HasSuffix(strings.ToLower(path), "."+format) {
+			return format
+		}
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"github.com/parquet-go/parquet-go"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testNetwork = &validation.Network{Name: "testnet", GenesisTime: 1606824023, SecondsPerSlot: 12, SlotsPerEpoch: 32}
+
+// fakeBlockRewards passes rewards for even slots and missed odd slots; it fails at failAt if set
+func fakeBlockRewards(failAt uint64) func(ctx context.Context, network *validation.Network, from, to uint64, workers int, fn func(slot uint64, reward *validation.BlockRewardSlot) error) error {
+	return func(ctx context.Context, network *validation.Network, from, to uint64, workers int, fn func(slot uint64, reward *validation.BlockRewardSlot) error) error {
+		for slot := from; slot <= to; slot++ {
+			if slot == failAt {
+				return errors.New("interrupted")
+			}
+			var reward *validation.BlockRewardSlot
+			if slot%2 == 0 {
+				reward = &validation.BlockRewardSlot{Slot: slot, Status: validation.BlockStatusMEV, Reward: 1.5, FeeRecipient: "0xabc", Relays: []string{"relay-a", "relay-b"}}
+			}
+			if errFn := fn(slot, reward); errFn != nil {
+				return errFn
+			}
+		}
+		return nil
+	}
+}
+
+func TestToFileResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rewards.csv")
+	opts := FileOptions{Network: testNetwork, First: 100, Last: 109, Format: FormatCSV, Path: path, BlockRewards: fakeBlockRewards(105)}
+
+	if errExport := ToFile(context.Background(), opts); errExport == nil {
+		t.Fatal("expected interrupted export to fail")
+	}
+	if info, errStat := os.Stat(path + progressSuffix); errStat != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected progress to be kept, readable by the owner only: %v", errStat)
+	}
+	// Options of another export are rejected
+	for _, other := range []FileOptions{
+		{Network: testNetwork, First: 101, Last: 109, Format: FormatCSV, Path: path},
+		{Network: testNetwork, First: 100, Last: 103, Format: FormatCSV, Path: path},
+		{Network: testNetwork, First: 100, Last: 109, Format: FormatJSONL, Path: path},
+	} {
+		if errExport := ToFile(context.Background(), other); errExport == nil {
+			t.Errorf("expected export with other options %+v to be rejected", other)
+		}
+	}
+
+	var lastProgress Progress
+	opts.Progress = func(progress Progress) { lastProgress = progress }
+	opts.BlockRewards = fakeBlockRewards(0)
+	if errExport := ToFile(context.Background(), opts); errExport != nil {
+		t.Fatal(errExport)
+	}
+	if lastProgress.Done != 10 || lastProgress.Total != 10 || lastProgress.Resumed != 5 || lastProgress.Rows != 5 {
+		t.Errorf("expected progress of resumed export, got %+v", lastProgress)
+	}
+	if _, errStat := os.Stat(path + progressSuffix); !errors.Is(errStat, os.ErrNotExist) {
+		t.Errorf("expected progress to be removed after the export, got %v", errStat)
+	}
+
+	content, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 6 || lines[0] != strings.Join(csvHeader, ",") {
+		t.Fatalf("expected header and 5 rows, got %q", content)
+	}
+	for i, line := range lines[1:] {
+		if !strings.HasPrefix(line, []string{"100,", "102,", "104,", "106,", "108,"}[i]) {
+			t.Errorf("expected rows in slot order without duplicates, got %q", content)
+		}
+	}
+	if !strings.Contains(lines[1], ",mev,1.5,0xabc,relay-a;relay-b,") {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+
+	// Existing exports aren't overwritten
+	if errExport := ToFile(context.Background(), opts); errExport == nil {
+		t.Error("expected existing output to be kept")
+	}
+}
+
+func TestToFileParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rewards.parquet")
+	if errExport := ToFile(context.Background(), FileOptions{Network: testNetwork, First: 2, Last: 7, Format: FormatParquet, Path: path, BlockRewards: fakeBlockRewards(0)}); errExport != nil {
+		t.Fatal(errExport)
+	}
+	for _, suffix := range []string{progressSuffix, partialSuffix} {
+		if _, errStat := os.Stat(path + suffix); !errors.Is(errStat, os.ErrNotExist) {
+			t.Errorf("expected %v file to be removed, got %v", suffix, errStat)
+		}
+	}
+
+	rows, errRead := parquet.ReadFile[Row](path)
+	if errRead != nil {
+		t.Fatal(errRead)
+	}
+	if len(rows) != 3 || rows[1].Slot != 4 || rows[1].Time != "2020-12-01T12:01:11Z" || len(rows[1].Relays) != 2 {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+}
+
+func TestRangeResolve(t *testing.T) {
+	tests := []struct {
+		rng         Range
+		first, last uint64
+	}{
+		{Range{Slots: "10-20"}, 10, 20},
+		{Range{Slots: "7"}, 7, 7},
+		{Range{Epochs: "2-3"}, 64, 127},
+		{Range{From: "2020-12-02", To: "2020-12-02"}, 3599, 10798},
+		{Range{From: "2020-12-01T12:00:24Z", To: "2020-12-01T12:00:47Z"}, 1, 2},
+	}
+	for _, test := range tests {
+		first, last, errResolve := test.rng.Resolve(testNetwork)
+		if errResolve != nil || first != test.first || last != test.last {
+			t.Errorf("expected %+v to resolve to %v-%v, got %v-%v (%v)", test.rng, test.first, test.last, first, last, errResolve)
+		}
+	}
+	for _, invalid := range []Range{{}, {Slots: "1-2", Epochs: "1"}, {Slots: "5-1"}, {To: "2020-12-02"}, {From: "yesterday"}} {
+		if _, _, errResolve := invalid.Resolve(testNetwork); errResolve == nil {
+			t.Errorf("expected %+v to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package export
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/parquet-go/parquet-go"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// progressSuffix is appended to the output path for the progress file of an unfinished export
+	progressSuffix = ".progress"
+	// partialSuffix is appended to the output path for the rows of an unfinished parquet export; parquet files
+	// can't be appended to, so the rows are collected as JSON Lines and converted once the export completes
+	partialSuffix = ".partial.jsonl"
+	// checkpointInterval is the interval the progress of an export is saved in
+	checkpointInterval = time.Second
+	// parquetBatchSize is the number of rows written to a parquet file at once
+	parquetBatchSize = 1024
+)
+
+// FileOptions configure an export to a file
+type FileOptions struct {
+	Network *validation.Network
+	// First and Last are the inclusive slot range of the export
+	First uint64
+	Last  uint64
+	// Format is FormatCSV, FormatJSONL or FormatParquet
+	Format string
+	Path   string
+	// Workers compute block rewards concurrently; defaults to 1
+	Workers int
+	// Progress is called after every slot, missed ones included
+	Progress func(progress Progress)
+	// BlockRewards computes the block rewards of the range; defaults to validation.ForEachBlockReward
+	BlockRewards func(ctx context.Context, network *validation.Network, from, to uint64, workers int, fn func(slot uint64, reward *validation.BlockRewardSlot) error) error
+}
+
+// Progress of an export
+type Progress struct {
+	// Done and Total count slots; Done includes the slots of the interrupted runs an export resumed
+	Done  uint64
+	Total uint64
+	// Rows is the number of rows written, which excludes missed slots
+	Rows uint64
+	// Resumed is the number of slots done by interrupted runs
+	Resumed uint64
+}
+
+// fileProgress is the progress file of an unfinished export. The slots before NextSlot are written to the data file,
+// which is truncated to Offset on resume to drop rows written after the last checkpoint.
+type fileProgress struct {
+	Network  string `json:"network"`
+	First    uint64 `json:"first"`
+	Last     uint64 `json:"last"`
+	Format   string `json:"format"`
+	NextSlot uint64 `json:"next_slot"`
+	Offset   int64  `json:"offset"`
+	Rows     uint64 `json:"rows"`
+}
+
+// ToFile writes the block rewards of a slot range to a file. An export which is interrupted, e.g. by cancelling
+// the context, keeps its progress next to the file and resumes when it's started again with the same options;
+// the last slot may be different, so open ended ranges resume up to the current slot.
+func ToFile(ctx context.Context, opts FileOptions) error {
+	if opts.Last < opts.First {
+		return fmt.Errorf("invalid slot range %v-%v", opts.First, opts.Last)
+	}
+	dataPath := opts.Path
+	switch opts.Format {
+	case FormatCSV, FormatJSONL:
+	case FormatParquet:
+		dataPath = opts.Path + partialSuffix
+	default:
+		return fmt.Errorf("unknown format %q", opts.Format)
+	}
+
+	progress, errProgress := loadProgress(opts)
+	if errProgress != nil {
+		return errProgress
+	}
+	resumed := progress.NextSlot - opts.First
+	if progress.NextSlot <= opts.Last {
+		if errExport := exportRows(ctx, opts, dataPath, progress, resumed); errExport != nil {
+			return errExport
+		}
+	}
+
+	// All slots are written; parquet exports still need to be converted. The progress file is removed before the
+	// partial rows, so an interruption in between never leaves a progress file without the rows it refers to.
+	if opts.Format == FormatParquet {
+		if errConvert := convertToParquet(dataPath, opts.Path); errConvert != nil {
+			return errConvert
+		}
+	}
+	if errRemove := os.Remove(opts.Path + progressSuffix); errRemove != nil {
+		return errRemove
+	}
+	if opts.Format == FormatParquet {
+		return os.Remove(dataPath)
+	}
+	return nil
+}
+
+// loadProgress returns the progress of an unfinished export with the same options, or creates it for a new export
+func loadProgress(opts FileOptions) (*fileProgress, error) {
+	progress := &fileProgress{
+		Network:  opts.Network.Name,
+		First:    opts.First,
+		Last:     opts.Last,
+		Format:   opts.Format,
+		NextSlot: opts.First,
+	}
+	content, errRead := os.ReadFile(opts.Path + progressSuffix)
+	if errors.Is(errRead, os.ErrNotExist) {
+		if _, errStat := os.Stat(opts.Path); errStat == nil {
+			return nil, fmt.Errorf("%v already exists; remove it or choose another output", opts.Path)
+		}
+		return progress, saveProgress(opts.Path, progress)
+	} else if errRead != nil {
+		return nil, errRead
+	}
+
+	saved := &fileProgress{}
+	if errDecode := json.Unmarshal(content, saved); errDecode != nil {
+		return nil, fmt.Errorf("invalid progress file %v%v: %v", opts.Path, progressSuffix, errDecode)
+	}
+	// The end of the range may move, e.g. for date ranges ending now, as long as the written slots are part of it
+	if saved.Network != progress.Network || saved.First != progress.First || saved.Format != progress.Format || saved.NextSlot > opts.Last+1 {
+		return nil, fmt.Errorf("an unfinished export of %v slots %v-%v as %v exists at %v; resume it with the same options or remove %v%v",
+			saved.Network, saved.First, saved.Last, saved.Format, opts.Path, opts.Path, progressSuffix)
+	}
+	saved.Last = opts.Last
+	return saved, nil
+}
+
+// saveProgress replaces the progress file atomically, so an interruption never leaves a partial one
+func saveProgress(path string, progress *fileProgress) error {
+	content, errEncode := json.Marshal(progress)
+	if errEncode != nil {
+		return errEncode
+	}
+	tmpPath := path + progressSuffix + ".tmp"
+	// Readable by the owner only, like the job files of the API server
+	if errWrite := os.WriteFile(tmpPath, content, 0600); errWrite != nil {
+		return errWrite
+	}
+	return os.Rename(tmpPath, path+progressSuffix)
+}
+
+// exportRows appends the rows of the remaining slots to the data file and checkpoints the progress regularly
+func exportRows(ctx context.Context, opts FileOptions, dataPath string, progress *fileProgress, resumed uint64) error {
+	file, errOpen := os.OpenFile(dataPath, os.O_CREATE|os.O_RDWR, 0644)
+	if errOpen != nil {
+		return errOpen
+	}
+	defer file.Close()
+	// Drop rows written after the last checkpoint; they're computed again
+	if errTruncate := file.Truncate(progress.Offset); errTruncate != nil {
+		return errTruncate
+	}
+	if _, errSeek := file.Seek(progress.Offset, io.SeekStart); errSeek != nil {
+		return errSeek
+	}
+	writerFormat := opts.Format
+	if writerFormat == FormatParquet {
+		writerFormat = FormatJSONL
+	}
+	writer, errWriter := NewRowWriter(writerFormat, file, progress.Offset > 0)
+	if errWriter != nil {
+		return errWriter
+	}
+
+	checkpoint := func() error {
+		if errFlush := writer.Flush(); errFlush != nil {
+			return errFlush
+		}
+		offset, errOffset := file.Seek(0, io.SeekCurrent)
+		if errOffset != nil {
+			return errOffset
+		}
+		progress.Offset = offset
+		return saveProgress(opts.Path, progress)
+	}
+
+	forEachBlockReward := opts.BlockRewards
+	if forEachBlockReward == nil {
+		forEachBlockReward = validation.ForEachBlockReward
+	}
+	total := opts.Last - opts.First + 1
+	lastCheckpoint := time.Now()
+	errRange := forEachBlockReward(ctx, opts.Network, progress.NextSlot, opts.Last, opts.Workers, func(slot uint64, reward *validation.BlockRewardSlot) error {
+		if reward != nil {
+			if errWrite := writer.Write(NewRow(opts.Network, reward)); errWrite != nil {
+				return errWrite
+			}
+			progress.Rows++
+		}
+		progress.NextSlot = slot + 1
+		if opts.Progress != nil {
+			opts.Progress(Progress{Done: slot - opts.First + 1, Total: total, Rows: progress.Rows, Resumed: resumed})
+		}
+		if time.Since(lastCheckpoint) >= checkpointInterval {
+			lastCheckpoint = time.Now()
+			return checkpoint()
+		}
+		return nil
+	})
+	// Keep what's complete, also if the export was interrupted or failed
+	if errCheckpoint := checkpoint(); errCheckpoint != nil && errRange == nil {
+		return errCheckpoint
+	}
+	return errRange
+}
+
+// convertToParquet writes the rows of a JSON Lines file to a parquet file
+func convertToParquet(sourcePath, path string) error {
+	source, errOpen := os.Open(sourcePath)
+	if errOpen != nil {
+		return errOpen
+	}
+	defer source.Close()
+	target, errCreate := os.Create(path)
+	if errCreate != nil {
+		return errCreate
+	}
+	defer target.Close()
+
+	writer := parquet.NewGenericWriter[Row](target)
+	batch := make([]Row, 0, parquetBatchSize)
+	scanner := bufio.NewScanner(source)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		row := Row{}
+		if errDecode := json.Unmarshal(scanner.Bytes(), &row); errDecode != nil {
+			return fmt.Errorf("invalid row in %v: %v", sourcePath, errDecode)
+		}
+		batch = append(batch, row)
+		if len(batch) == parquetBatchSize {
+			if _, errWrite := writer.Write(batch); errWrite != nil {
+				return errWrite
+			}
+			batch = batch[:0]
+		}
+	}
+	if errScan := scanner.Err(); errScan != nil {
+		return errScan
+	}
+	if _, errWrite := writer.Write(batch); errWrite != nil {
+		return errWrite
+	}
+	if errClose := writer.Close(); errClose != nil {
+		return errClose
+	}
+	return target.Close()
+}
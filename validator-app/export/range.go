@@ -0,0 +1,140 @@
+// Package export
+/*
+Copyright © 2024 RuntimeRacer
+*/
+package export
+
+import (
+	"errors"
+	"fmt"
+	"github.com/runtimeracer/ethereum-validator-go/validation"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Range selects the slots of an export by exactly one of a slot range, an epoch range or a date range
+type Range struct {
+	// Slots is an inclusive range like 9000000-9000099, or a single slot
+	Slots string `json:"slots,omitempty"`
+	// Epochs is an inclusive range like 281250-281252, or a single epoch
+	Epochs string `json:"epochs,omitempty"`
+	// From and To are dates (YYYY-MM-DD) or RFC 3339 times; a date includes the whole day in UTC.
+	// To defaults to now.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Resolve returns the first and last slot of the range. Ranges reaching into the future end at the current slot.
+func (r Range) Resolve(network *validation.Network) (uint64, uint64, error) {
+	var first, last uint64
+	selected := 0
+	if len(r.Slots) > 0 {
+		selected++
+		var errRange error
+		if first, last, errRange = parseNumberRange(r.Slots); errRange != nil {
+			return 0, 0, fmt.Errorf("invalid slot range: %v", errRange)
+		}
+	}
+	if len(r.Epochs) > 0 {
+		selected++
+		firstEpoch, lastEpoch, errRange := parseNumberRange(r.Epochs)
+		if errRange != nil {
+			return 0, 0, fmt.Errorf("invalid epoch range: %v", errRange)
+		}
+		first = firstEpoch * network.SlotsPerEpoch
+		last = (lastEpoch+1)*network.SlotsPerEpoch - 1
+	}
+	if len(r.From) > 0 || len(r.To) > 0 {
+		selected++
+		var errRange error
+		if first, last, errRange = r.resolveDates(network); errRange != nil {
+			return 0, 0, errRange
+		}
+	}
+	if selected != 1 {
+		return 0, 0, errors.New("select exactly one of a slot, epoch or date range")
+	}
+
+	currentSlot := network.CurrentSlot()
+	if first > currentSlot {
+		return 0, 0, fmt.Errorf("range starts at slot %v, which is in the future", first)
+	}
+	if last > currentSlot {
+		last = currentSlot
+	}
+	return first, last, nil
+}
+
+func (r Range) resolveDates(network *validation.Network) (uint64, uint64, error) {
+	if len(r.From) == 0 {
+		return 0, 0, errors.New("invalid date range: from is required")
+	}
+	from, _, errFrom := parseDate(r.From)
+	if errFrom != nil {
+		return 0, 0, fmt.Errorf("invalid date range: %v", errFrom)
+	}
+	to := time.Now()
+	if len(r.To) > 0 {
+		var isDate bool
+		var errTo error
+		if to, isDate, errTo = parseDate(r.To); errTo != nil {
+			return 0, 0, fmt.Errorf("invalid date range: %v", errTo)
+		}
+		if isDate {
+			// Include the whole day
+			to = to.AddDate(0, 0, 1).Add(-time.Second)
+		}
+	}
+	if to.Before(from) {
+		return 0, 0, errors.New("invalid date range: to is before from")
+	}
+
+	// Slots starting before genesis are left out
+	first, errFirst := network.SlotAtTimestamp(from.Unix())
+	if validation.IsTimeBeforeGenesis(errFirst) {
+		first = 0
+	} else if errFirst != nil {
+		return 0, 0, errFirst
+	} else if network.SlotTimestamp(first) < uint64(from.Unix()) {
+		// The slot active at from started before it
+		first++
+	}
+	last, errLast := network.SlotAtTimestamp(to.Unix())
+	if errLast != nil {
+		return 0, 0, fmt.Errorf("invalid date range: %v", errLast)
+	}
+	return first, last, nil
+}
+
+// parseNumberRange parses an inclusive range like 10-20 or a single number
+func parseNumberRange(value string) (uint64, uint64, error) {
+	firstValue, lastValue, isRange := strings.Cut(value, "-")
+	first, errFirst := strconv.ParseUint(strings.TrimSpace(firstValue), 10, 64)
+	if errFirst != nil {
+		return 0, 0, errFirst
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	last, errLast := strconv.ParseUint(strings.TrimSpace(lastValue), 10, 64)
+	if errLast != nil {
+		return 0, 0, errLast
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("%v ends before it starts", value)
+	}
+	return first, last, nil
+}
+
+// parseDate parses a date (YYYY-MM-DD) in UTC or an RFC 3339 time; isDate is true for dates
+func parseDate(value string) (time.Time, bool, error) {
+	if date, errDate := time.Parse(time.DateOnly, value); errDate == nil {
+		return date, true, nil
+	}
+	parsed, errTime := time.Parse(time.RFC3339, value)
+	if errTime != nil {
+		return time.Time{}, false, fmt.Errorf("%q is neither a date (YYYY-MM-DD) nor an RFC 3339 time", value)
+	}
+	return parsed, false, nil
+}
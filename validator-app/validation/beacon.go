@@ -0,0 +1,254 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// beaconResponse is the generic envelope of all beacon node API responses
+type beaconResponse struct {
+	ExecutionOptimistic bool            `json:"execution_optimistic"`
+	Finalized           bool            `json:"finalized"`
+	Data                json.RawMessage `json:"data"`
+}
+
+type beaconExecutionPayload struct {
+	ParentHash    string   `json:"parent_hash"`
+	FeeRecipient  string   `json:"fee_recipient"`
+	StateRoot     string   `json:"state_root"`
+	ReceiptsRoot  string   `json:"receipts_root"`
+	BlockNumber   uint64   `json:"block_number,string"`
+	GasUsed       uint64   `json:"gas_used,string"`
+	Timestamp     uint64   `json:"timestamp,string"`
+	BaseFeePerGas string   `json:"base_fee_per_gas"`
+	BlockHash     string   `json:"block_hash"`
+	Transactions  []string `json:"transactions"`
+}
+
+type beaconBlock struct {
+	Message struct {
+		Slot          uint64 `json:"slot,string"`
+		ProposerIndex uint64 `json:"proposer_index,string"`
+		ParentRoot    string `json:"parent_root"`
+		StateRoot     string `json:"state_root"`
+		Body          struct {
+			ExecutionPayload *beaconExecutionPayload `json:"execution_payload"`
+		} `json:"body"`
+	} `json:"message"`
+	Signature string `json:"signature"`
+}
+
+type beaconHeader struct {
+	Root      string `json:"root"`
+	Canonical bool   `json:"canonical"`
+	Header    struct {
+		Message struct {
+			Slot          uint64 `json:"slot,string"`
+			ProposerIndex uint64 `json:"proposer_index,string"`
+			ParentRoot    string `json:"parent_root"`
+			StateRoot     string `json:"state_root"`
+			BodyRoot      string `json:"body_root"`
+		} `json:"message"`
+	} `json:"header"`
+}
+
+type beaconSyncCommittee struct {
+	Validators []string `json:"validators"`
+}
+
+type beaconValidator struct {
+	Index     uint64 `json:"index,string"`
+	Balance   uint64 `json:"balance,string"`
+	Status    string `json:"status"`
+	Validator struct {
+		Pubkey                string `json:"pubkey"`
+		WithdrawalCredentials string `json:"withdrawal_credentials"`
+		EffectiveBalance      uint64 `json:"effective_balance,string"`
+		Slashed               bool   `json:"slashed"`
+		ActivationEpoch       uint64 `json:"activation_epoch,string"`
+		ExitEpoch             uint64 `json:"exit_epoch,string"`
+	} `json:"validator"`
+}
+
+// getBeaconHttpClient returns a ready-to-use http client for the beacon node API and relays of the network
+func getBeaconHttpClient(network *Network) *http.Client {
+	network.clientMtx.Lock()
+	defer network.clientMtx.Unlock()
+	// Return if already initialized
+	if network.httpClient != nil {
+		return network.httpClient
+	}
+
+	timeout := network.BackendTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	network.httpClient = &http.Client{Timeout: timeout}
+	return network.httpClient
+}
+
+// beaconGetRaw calls the beacon node API and returns the raw response body.
+// It returns false if the requested resource does not exist.
+func beaconGetRaw(network *Network, path string) ([]byte, bool, error) {
+	if !network.IsConfigured() {
+		return nil, false, fmt.Errorf("no backend configured for network %v", network.Name)
+	}
+	requestURL := fmt.Sprintf("%s/%s", getBackendURL(network), strings.TrimPrefix(path, "/"))
+	started := time.Now()
+	body, found, errGet := beaconRequest(network, requestURL, path)
+	observeBackendCall(BackendBeacon, backendEndpoint("/"+strings.TrimPrefix(path, "/")), http.MethodGet, started, errGet)
+	return body, found, errGet
+}
+
+func beaconRequest(network *Network, requestURL, path string) ([]byte, bool, error) {
+	response, errGet := getBeaconHttpClient(network).Get(requestURL)
+	if errGet != nil {
+		return nil, false, fmt.Errorf("beacon request failed: %v", errGet)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	body, errRead := io.ReadAll(response.Body)
+	if errRead != nil {
+		return nil, false, fmt.Errorf("unable to read beacon response: %v", errRead)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("beacon request '%v' failed with status %v: %s", path, response.StatusCode, body)
+	}
+	return body, true, nil
+}
+
+// beaconGet calls the beacon node API and decodes the data field of the response into out.
+// It returns false if the requested resource does not exist.
+func beaconGet(network *Network, path string, out interface{}) (*beaconResponse, bool, error) {
+	body, found, errGet := beaconGetRaw(network, path)
+	if errGet != nil || !found {
+		return nil, found, errGet
+	}
+
+	envelope := &beaconResponse{}
+	if errDecode := json.Unmarshal(body, envelope); errDecode != nil {
+		return nil, false, fmt.Errorf("unable to decode beacon response: %v", errDecode)
+	}
+	if errDecode := json.Unmarshal(envelope.Data, out); errDecode != nil {
+		return nil, false, fmt.Errorf("unable to decode beacon response data: %v", errDecode)
+	}
+	return envelope, true, nil
+}
+
+type beaconFinalityCheckpoints struct {
+	CurrentJustified struct {
+		Epoch uint64 `json:"epoch,string"`
+		Root  string `json:"root"`
+	} `json:"current_justified"`
+}
+
+// ResolveBlockID resolves a beacon API block identifier to a concrete slot.
+// Supported are slot numbers, head, finalized, justified, genesis and 0x prefixed block roots.
+func ResolveBlockID(network *Network, blockID string) (uint64, error) {
+	if slot, errParse := strconv.ParseUint(blockID, 10, 64); errParse == nil {
+		return slot, nil
+	}
+
+	switch strings.ToLower(blockID) {
+	case "genesis":
+		return 0, nil
+	case "head", "finalized":
+		return getBeaconHeaderSlot(network, strings.ToLower(blockID))
+	case "justified":
+		// Block IDs don't cover the justified checkpoint; resolve it through the head state
+		checkpoints := &beaconFinalityCheckpoints{}
+		_, found, err := beaconGet(network, "/eth/v1/beacon/states/head/finality_checkpoints", checkpoints)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, errSlotDoesNotExist
+		}
+		return getBeaconHeaderSlot(network, checkpoints.CurrentJustified.Root)
+	}
+
+	if root, errRoot := hexutil.Decode(blockID); errRoot == nil && len(root) == 32 {
+		return getBeaconHeaderSlot(network, blockID)
+	}
+	return 0, errSlotDoesNotExist
+}
+
+// getBeaconHeaderSlot returns the slot of the block header with the given block id
+func getBeaconHeaderSlot(network *Network, blockID string) (uint64, error) {
+	header := &beaconHeader{}
+	_, found, err := beaconGet(network, fmt.Sprintf("/eth/v1/beacon/headers/%v", blockID), header)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errSlotDoesNotExist
+	}
+	return header.Header.Message.Slot, nil
+}
+
+// checkSlotReached ensures the slot is not in the future, based on the network's clock
+func checkSlotReached(network *Network, slot uint64) error {
+	if slot > network.CurrentSlot() {
+		return errSlotInFuture
+	}
+	return nil
+}
+
+// getBeaconBlock returns the beacon block for the given block id (slot, root or named identifier)
+func getBeaconBlock(network *Network, blockID string) (*beaconBlock, error) {
+	block := &beaconBlock{}
+	_, found, err := beaconGet(network, fmt.Sprintf("/eth/v2/beacon/blocks/%v", blockID), block)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errSlotDoesNotExist
+	}
+	return block, nil
+}
+
+// getBeaconSyncCommittee returns the indices of the validators in the sync committee for the given slot
+func getBeaconSyncCommittee(network *Network, slot uint64) ([]string, error) {
+	committee := &beaconSyncCommittee{}
+	_, found, err := beaconGet(network, fmt.Sprintf("/eth/v1/beacon/states/%v/sync_committees", slot), committee)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errSlotDoesNotExist
+	}
+	return committee.Validators, nil
+}
+
+// getBeaconValidators returns the validators for the given indices, in the order of the beacon state
+func getBeaconValidators(network *Network, slot uint64, indices []string) ([]beaconValidator, error) {
+	validators := make([]beaconValidator, 0, len(indices))
+	// Request in chunks to keep the URL length reasonable
+	const chunkSize = 64
+	for start := 0; start < len(indices); start += chunkSize {
+		end := start + chunkSize
+		if end > len(indices) {
+			end = len(indices)
+		}
+		chunk := make([]beaconValidator, 0, end-start)
+		path := fmt.Sprintf("/eth/v1/beacon/states/%v/validators?id=%v", slot, strings.Join(indices[start:end], ","))
+		_, found, err := beaconGet(network, path, &chunk)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errSlotDoesNotExist
+		}
+		validators = append(validators, chunk...)
+	}
+	return validators, nil
+}
@@ -0,0 +1,75 @@
+package validation
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestBeaconNode serves block headers by block id and the finality checkpoints of the head state
+func newTestBeaconNode(t *testing.T, headers map[string]uint64, justifiedRoot string) *Network {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/eth/v1/beacon/headers/{blockID}", func(w http.ResponseWriter, r *http.Request) {
+		slot, ok := headers[r.PathValue("blockID")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"root":"0x01","canonical":true,"header":{"message":{"slot":"%v"}}}}`, slot)
+	})
+	mux.HandleFunc("/eth/v1/beacon/states/head/finality_checkpoints", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data":{"current_justified":{"epoch":"3","root":"%v"}}}`, justifiedRoot)
+	})
+	node := httptest.NewServer(mux)
+	t.Cleanup(node.Close)
+	return &Network{Name: "testnet", BackendEndpoint: node.URL}
+}
+
+func TestResolveBlockID(t *testing.T) {
+	const (
+		blockRoot     = "0x1111111111111111111111111111111111111111111111111111111111111111"
+		justifiedRoot = "0x2222222222222222222222222222222222222222222222222222222222222222"
+		unknownRoot   = "0x3333333333333333333333333333333333333333333333333333333333333333"
+	)
+	network := newTestBeaconNode(t, map[string]uint64{
+		"head":        130,
+		"finalized":   64,
+		blockRoot:     100,
+		justifiedRoot: 96,
+	}, justifiedRoot)
+
+	tests := []struct {
+		blockID string
+		slot    uint64
+	}{
+		// Slot numbers are echoed without a request
+		{"12345", 12345},
+		{"0", 0},
+		{"genesis", 0},
+		{"head", 130},
+		{"HEAD", 130},
+		{"finalized", 64},
+		{"justified", 96},
+		{blockRoot, 100},
+	}
+	for _, test := range tests {
+		slot, errResolve := ResolveBlockID(network, test.blockID)
+		if errResolve != nil || slot != test.slot {
+			t.Errorf("expected %v to resolve to slot %v, got %v (%v)", test.blockID, test.slot, slot, errResolve)
+		}
+	}
+
+	// Unknown roots and invalid identifiers don't exist
+	for _, blockID := range []string{unknownRoot, "0x1234", "latest", "-1"} {
+		if _, errResolve := ResolveBlockID(network, blockID); !IsSlotDoesNotExist(errResolve) {
+			t.Errorf("expected %v not to exist, got %v", blockID, errResolve)
+		}
+	}
+
+	// Backend failures aren't reported as missing slots
+	network.BackendEndpoint = "http://127.0.0.1:1"
+	if _, errResolve := ResolveBlockID(network, "head"); errResolve == nil || IsSlotDoesNotExist(errResolve) {
+		t.Errorf("expected backend error, got %v", errResolve)
+	}
+}
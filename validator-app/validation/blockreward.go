@@ -1,47 +1,119 @@
 package validation
 
 import (
-	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
 	"math/big"
+	"strconv"
+)
+
+const (
+	BlockStatusMEV     = "mev"
+	BlockStatusVanilla = "vanilla"
 )
 
 type BlockRewardSlot struct {
+	// Slot is the slot the reward details belong to; named identifiers and timestamps are resolved to it.
+	Slot uint64 `json:"slot"`
 	// Status describes Whether the slot contains a block produced by a MEV relay or a vanilla block (built internally in the validator node).
 	Status string `json:"status"`
 	// Reward describes The amount of reward the node operator/validator received for including the block in that slot (in GWEI).
 	Reward float64 `json:"reward"`
+	// Verified describes whether the execution block and its receipts were verified against the beacon block's execution payload.
+	Verified bool `json:"verified"`
+	// FinalityVerified describes whether the block is part of the finalized chain verified by the light client through sync committee signatures.
+	FinalityVerified bool `json:"finality_verified"`
+	// ProposerIndex is the index of the validator which proposed the block.
+	ProposerIndex uint64 `json:"proposer_index"`
+	// BlockNumber is the number of the execution block included in the slot.
+	BlockNumber uint64 `json:"block_number"`
+	// FeeRecipient is the address the reward was paid to; for MEV blocks it's the proposer's address the builder paid, not the builder's.
+	FeeRecipient string `json:"fee_recipient"`
+	// Relays are the names of the MEV relays which delivered the block; it's empty for vanilla blocks.
+	Relays []string `json:"relays,omitempty"`
 }
 
-func GetBlockRewardSlot(slot uint64) (*BlockRewardSlot, error) {
-	// Get MEV2 Client
-	mev2, errMEV2 := getMEV2RelayBackendClient()
-	if errMEV2 != nil {
-		return nil, errMEV2
+func GetBlockRewardSlot(network *Network, slot uint64) (*BlockRewardSlot, error) {
+	// Ensure it's not in the future
+	if errReached := checkSlotReached(network, slot); errReached != nil {
+		return nil, errReached
 	}
 
-	mev2.EthBlockNumber()
+	// Get the beacon block; missed slots don't have one
+	block, errBlock := getBeaconBlock(network, strconv.FormatUint(slot, 10))
+	if errBlock != nil {
+		return nil, errBlock
+	}
+	payload := block.Message.Body.ExecutionPayload
+	if payload == nil {
+		return nil, fmt.Errorf("block in slot %v has no execution payload", slot)
+	}
 
-	// Get Web3 Client
-	client, errClient := getWeb3BackendClient()
-	if errClient != nil {
-		return nil, errClient
+	// Get the execution block and its receipts the payload refers to
+	executionBlock, errExecutionBlock := getExecutionBlock(network, payload.BlockNumber)
+	if errExecutionBlock != nil {
+		return nil, errExecutionBlock
 	}
-	// Get Current Block Number in the Endpoint's network
-	currentBlockNumber, errBlockNumber := client.Eth.GetBlockNumber()
-	if errBlockNumber != nil {
-		return nil, errBlockNumber
+	receipts, errReceipts := getExecutionReceipts(network, payload.BlockNumber)
+	if errReceipts != nil {
+		return nil, errReceipts
 	}
-	// Ensure it's not in the future
-	if slot > currentBlockNumber {
-		return nil, errors.New(ErrSlotInFuture)
+	transactions, errTransactions := decodeExecutionTransactions(payload.Transactions)
+	if errTransactions != nil {
+		return nil, errTransactions
+	}
+	if errVerify := verifyExecutionPayload(payload, executionBlock, transactions, receipts); errVerify != nil {
+		return nil, errVerify
+	}
+
+	// If a relay delivered the payload, the proposer was paid the bid value by the builder
+	trace, relays, errTrace := getRelayDeliveredPayload(network, slot, payload.BlockHash)
+	if errTrace != nil {
+		return nil, errTrace
+	}
+	var rewardWei *big.Int
+	status := BlockStatusVanilla
+	feeRecipient := payload.FeeRecipient
+	if trace != nil {
+		var errValue error
+		if rewardWei, errValue = trace.bidValueWei(); errValue != nil {
+			return nil, errValue
+		}
+		status = BlockStatusMEV
+		feeRecipient = trace.ProposerFeeRecipient
+	} else {
+		// Vanilla blocks pay all priority fees to the fee recipient
+		var errFees error
+		if rewardWei, errFees = receipts.priorityFees(transactions, hexBigToInt(executionBlock.BaseFeePerGas)); errFees != nil {
+			return nil, errFees
+		}
 	}
 
-	blockNumber := &big.Int{}
-	blockNumber.SetUint64(slot)
-	blockInfo, errBlockInfo := client.Eth.GetBlocByNumber(blockNumber, true)
-	if errBlockInfo != nil {
-		return nil, errBlockInfo
+	// Check the block against the finalized chain, if the light client is enabled
+	finalityVerified := false
+	if network.lightClient != nil {
+		var errFinality error
+		finalityVerified, errFinality = network.lightClient.isFinalizedExecutionBlock(payload.BlockNumber, common.HexToHash(payload.BlockHash))
+		if errFinality != nil {
+			return nil, errFinality
+		}
 	}
-	blockInfo
 
+	return &BlockRewardSlot{
+		Slot:             slot,
+		Status:           status,
+		Reward:           weiToGwei(rewardWei),
+		Verified:         true,
+		FinalityVerified: finalityVerified,
+		ProposerIndex:    block.Message.ProposerIndex,
+		BlockNumber:      payload.BlockNumber,
+		FeeRecipient:     feeRecipient,
+		Relays:           relays,
+	}, nil
+}
+
+// weiToGwei converts a wei amount into GWEI
+func weiToGwei(wei *big.Int) float64 {
+	gwei, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e9)).Float64()
+	return gwei
 }
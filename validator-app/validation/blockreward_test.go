@@ -1 +1,239 @@
 package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExecutionBlockComputeHash(t *testing.T) {
+	header := &types.Header{
+		ParentHash:  common.HexToHash("0x01"),
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    common.HexToAddress("0x95222290dd7278aa3ddd389cc1e1d165cc4bafe5"),
+		Root:        common.HexToHash("0x02"),
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  big.NewInt(0),
+		Number:      big.NewInt(17000000),
+		GasLimit:    30000000,
+		GasUsed:     12345,
+		Time:        1681338455,
+		Extra:       []byte("beaverbuild.org"),
+		MixDigest:   common.HexToHash("0x03"),
+		BaseFee:     big.NewInt(25000000000),
+	}
+	block := &executionBlock{
+		ParentHash:       header.ParentHash,
+		UncleHash:        header.UncleHash,
+		Miner:            header.Coinbase,
+		StateRoot:        header.Root,
+		TransactionsRoot: header.TxHash,
+		ReceiptsRoot:     header.ReceiptHash,
+		LogsBloom:        header.Bloom.Bytes(),
+		Difficulty:       (*hexutil.Big)(header.Difficulty),
+		Number:           (*hexutil.Big)(header.Number),
+		GasLimit:         hexutil.Uint64(header.GasLimit),
+		GasUsed:          hexutil.Uint64(header.GasUsed),
+		Timestamp:        hexutil.Uint64(header.Time),
+		ExtraData:        header.Extra,
+		MixHash:          header.MixDigest,
+		BaseFeePerGas:    (*hexutil.Big)(header.BaseFee),
+	}
+
+	hash, err := block.computeHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != header.Hash() {
+		t.Errorf("expected hash %v, got %v", header.Hash(), hash)
+	}
+}
+
+func TestExecutionReceiptsComputeRoot(t *testing.T) {
+	expected := make(types.Receipts, 0)
+	receipts := make(executionReceipts, 0)
+	// More than 128 receipts to cover the special key ordering of the trie
+	for i := 0; i < 130; i++ {
+		receipt := &types.Receipt{
+			Type:              uint8(i % 3),
+			Status:            uint64(i % 2),
+			CumulativeGasUsed: uint64(21000 * (i + 1)),
+			Logs: []*types.Log{{
+				Address: common.HexToAddress("0xdac17f958d2ee523a2206206994597c13d831ec7"),
+				Topics:  []common.Hash{common.HexToHash("0xddf252ad")},
+				Data:    []byte{byte(i)},
+			}},
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		expected = append(expected, receipt)
+
+		status := hexutil.Uint64(receipt.Status)
+		receipts = append(receipts, executionReceipt{
+			Type:              hexutil.Uint64(receipt.Type),
+			Status:            &status,
+			CumulativeGasUsed: hexutil.Uint64(receipt.CumulativeGasUsed),
+			LogsBloom:         receipt.Bloom.Bytes(),
+			Logs: []executionLog{{
+				Address: receipt.Logs[0].Address,
+				Topics:  receipt.Logs[0].Topics,
+				Data:    receipt.Logs[0].Data,
+			}},
+		})
+	}
+
+	expectedRoot := types.DeriveSha(expected, trie.NewStackTrie(nil))
+	if root := receipts.computeRoot(); root != expectedRoot {
+		t.Errorf("expected receipts root %v, got %v", expectedRoot, root)
+	}
+}
+
+func TestVerifyExecutionPayloadMismatch(t *testing.T) {
+	block := &executionBlock{
+		UncleHash:     types.EmptyUncleHash,
+		ReceiptsRoot:  types.EmptyRootHash,
+		LogsBloom:     make([]byte, 256),
+		BaseFeePerGas: (*hexutil.Big)(big.NewInt(7)),
+	}
+	payload := &beaconExecutionPayload{
+		BlockHash:    common.HexToHash("0xdead").Hex(),
+		ReceiptsRoot: types.EmptyRootHash.Hex(),
+	}
+
+	err := verifyExecutionPayload(payload, block, executionTransactions{}, executionReceipts{})
+	integrityError, ok := err.(*IntegrityError)
+	if !ok {
+		t.Fatalf("expected integrity error, got %v", err)
+	}
+	if integrityError.Check != IntegrityCheckBlockHash {
+		t.Errorf("expected failed check %v, got %v", IntegrityCheckBlockHash, integrityError.Check)
+	}
+}
+
+// newTestExecutionNode serves a beacon block at slot 5 and the execution block and receipts it commits to.
+// Receipts are served from the function, so tests can tamper with them.
+func newTestExecutionNode(t *testing.T, payload *beaconExecutionPayload, block *executionBlock, receipts func() interface{}) *Network {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/eth/v2/beacon/blocks/5", func(w http.ResponseWriter, r *http.Request) {
+		beaconBlock := &beaconBlock{}
+		beaconBlock.Message.Slot = 5
+		beaconBlock.Message.Body.ExecutionPayload = payload
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": beaconBlock})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Id     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		var result interface{} = block
+		if request.Method == "eth_getBlockReceipts" {
+			result = receipts()
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": request.Id, "result": result})
+	})
+	node := httptest.NewServer(mux)
+	t.Cleanup(node.Close)
+	return &Network{Name: "testnet", BackendEndpoint: node.URL, SecondsPerSlot: 12, SlotsPerEpoch: 32}
+}
+
+func TestBlockRewardFromVerifiedData(t *testing.T) {
+	gwei := func(value int64) *big.Int { return new(big.Int).Mul(big.NewInt(value), big.NewInt(1e9)) }
+	recipient := common.HexToAddress("0x01")
+	signature := big.NewInt(1)
+	baseFee := gwei(10)
+
+	// Fees per gas above the base fee are 2, 5, 1 (capped by the max fee) and 3 gwei
+	transactions := types.Transactions{
+		types.NewTx(&types.LegacyTx{GasPrice: gwei(12), Gas: 21000, To: &recipient, V: signature, R: signature, S: signature}),
+		types.NewTx(&types.AccessListTx{ChainID: big.NewInt(1), Nonce: 1, GasPrice: gwei(15), Gas: 60000, To: &recipient, V: signature, R: signature, S: signature}),
+		types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), Nonce: 2, GasTipCap: gwei(2), GasFeeCap: gwei(11), Gas: 30000, To: &recipient, V: signature, R: signature, S: signature}),
+		types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), Nonce: 3, GasTipCap: gwei(3), GasFeeCap: gwei(100), Gas: 40000, To: &recipient, V: signature, R: signature, S: signature}),
+	}
+	gasUsed := []uint64{21000, 50000, 30000, 40000}
+	const expectedReward = 2*21000 + 5*50000 + 1*30000 + 3*40000
+
+	encodedTransactions := make([]string, 0)
+	receipts := make(executionReceipts, 0)
+	cumulativeGasUsed := uint64(0)
+	for i, transaction := range transactions {
+		encoded, errEncode := transaction.MarshalBinary()
+		if errEncode != nil {
+			t.Fatal(errEncode)
+		}
+		encodedTransactions = append(encodedTransactions, hexutil.Encode(encoded))
+		cumulativeGasUsed += gasUsed[i]
+		status := hexutil.Uint64(1)
+		receipts = append(receipts, executionReceipt{Type: hexutil.Uint64(transaction.Type()), Status: &status, CumulativeGasUsed: hexutil.Uint64(cumulativeGasUsed), LogsBloom: make([]byte, 256), Logs: []executionLog{}})
+	}
+	block := &executionBlock{
+		UncleHash:        types.EmptyUncleHash,
+		TransactionsRoot: types.DeriveSha(transactions, trie.NewStackTrie(nil)),
+		ReceiptsRoot:     receipts.computeRoot(),
+		LogsBloom:        make([]byte, 256),
+		Difficulty:       (*hexutil.Big)(big.NewInt(0)),
+		Number:           (*hexutil.Big)(big.NewInt(100)),
+		GasLimit:         30000000,
+		GasUsed:          hexutil.Uint64(cumulativeGasUsed),
+		ExtraData:        []byte{},
+		BaseFeePerGas:    (*hexutil.Big)(baseFee),
+	}
+	blockHash, errHash := block.computeHash()
+	if errHash != nil {
+		t.Fatal(errHash)
+	}
+	block.Hash = blockHash
+	payload := &beaconExecutionPayload{
+		BlockNumber:  100,
+		BlockHash:    blockHash.Hex(),
+		ReceiptsRoot: block.ReceiptsRoot.Hex(),
+		FeeRecipient: recipient.Hex(),
+		Transactions: encodedTransactions,
+	}
+
+	var servedReceipts interface{} = receipts
+	network := newTestExecutionNode(t, payload, block, func() interface{} { return servedReceipts })
+	reward, errReward := GetBlockRewardSlot(network, 5)
+	if errReward != nil || !reward.Verified || reward.Reward != expectedReward {
+		t.Fatalf("expected verified reward of %v gwei, got %+v (%v)", expectedReward, reward, errReward)
+	}
+
+	// Gas used and effective gas price of the receipts aren't committed to, so they don't affect the reward
+	inflated := make([]map[string]interface{}, 0)
+	for _, receipt := range receipts {
+		fields := map[string]interface{}{}
+		encoded, _ := json.Marshal(receipt)
+		json.Unmarshal(encoded, &fields)
+		fields["gasUsed"] = hexutil.EncodeUint64(1000000)
+		fields["effectiveGasPrice"] = hexutil.EncodeBig(gwei(1000))
+		inflated = append(inflated, fields)
+	}
+	servedReceipts = inflated
+	if reward, errReward = GetBlockRewardSlot(network, 5); errReward != nil || reward.Reward != expectedReward {
+		t.Errorf("expected inflated receipt fields to be ignored, got %+v (%v)", reward, errReward)
+	}
+
+	// The gas used the reward is based on is covered by the receipts root
+	tampered := append(executionReceipts{}, receipts...)
+	tampered[0].CumulativeGasUsed += 100000
+	servedReceipts = tampered
+	var integrityError *IntegrityError
+	if _, errReward = GetBlockRewardSlot(network, 5); !errors.As(errReward, &integrityError) || integrityError.Check != IntegrityCheckReceiptsRoot {
+		t.Errorf("expected receipts root mismatch, got %v", errReward)
+	}
+
+	// The fees per gas are covered by the transactions root
+	servedReceipts = receipts
+	expensive, _ := types.NewTx(&types.LegacyTx{GasPrice: gwei(1000), Gas: 21000, To: &recipient, V: signature, R: signature, S: signature}).MarshalBinary()
+	payload.Transactions = append([]string{hexutil.Encode(expensive)}, encodedTransactions[1:]...)
+	if _, errReward = GetBlockRewardSlot(network, 5); !errors.As(errReward, &integrityError) || integrityError.Check != IntegrityCheckTransactionsRoot {
+		t.Errorf("expected transactions root mismatch, got %v", errReward)
+	}
+}
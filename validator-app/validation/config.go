@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+// ConfigFromEnv reads the network configuration from the config file and environment.
+// Backend settings are read from <NETWORK>_BACKEND_ENDPOINT, <NETWORK>_BACKEND_TOKEN and <NETWORK>_MEV_RELAYS,
+// the trusted light client checkpoint from <NETWORK>_LIGHT_CLIENT_CHECKPOINT; the default network falls back to the
+// unprefixed settings.
+func ConfigFromEnv() Config {
+	config := Config{
+		DefaultNetwork: strings.ToLower(viper.GetString("NETWORK")),
+		Networks:       make(map[string]NetworkConfig),
+	}
+	if len(config.DefaultNetwork) == 0 {
+		config.DefaultNetwork = "mainnet"
+	}
+	for _, network := range builtinNetworks() {
+		isDefault := network.Name == config.DefaultNetwork
+		networkConfig := NetworkConfig{
+			BackendEndpoint:     configString(network.Name, "BACKEND_ENDPOINT", isDefault),
+			BackendToken:        configString(network.Name, "BACKEND_TOKEN", isDefault),
+			BackendTimeout:      time.Duration(viper.GetInt("API_TIMEOUT")) * time.Second,
+			BackendUseWebsocket: viper.GetBool("BACKEND_USE_WEBSOCKET"),
+			LightClient: LightClientConfig{
+				Checkpoint:   configString(network.Name, "LIGHT_CLIENT_CHECKPOINT", isDefault),
+				Fixtures:     configString(network.Name, "LIGHT_CLIENT_FIXTURES", isDefault),
+				MaxAncestry:  uint64(viper.GetInt("LIGHT_CLIENT_MAX_ANCESTRY")),
+				SyncInterval: time.Duration(viper.GetInt("LIGHT_CLIENT_SYNC_INTERVAL")) * time.Second,
+			},
+		}
+		if relays := configString(network.Name, "MEV_RELAYS", isDefault); len(relays) > 0 {
+			networkConfig.MEVRelays = splitList(relays)
+		}
+		config.Networks[network.Name] = networkConfig
+	}
+	return config
+}
+
+// configString reads the network specific config value, falling back to the unprefixed key if requested
+func configString(network, key string, fallback bool) string {
+	value := viper.GetString(fmt.Sprintf("%s_%s", strings.ToUpper(network), key))
+	if len(value) == 0 && fallback {
+		value = viper.GetString(key)
+	}
+	return value
+}
@@ -0,0 +1,281 @@
+package validation
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"math/big"
+)
+
+// executionBlock is an execution layer block header as returned by eth_getBlockByNumber.
+// Optional fields are nil if the block predates the fork which introduced them.
+type executionBlock struct {
+	Hash                  common.Hash      `json:"hash"`
+	ParentHash            common.Hash      `json:"parentHash"`
+	UncleHash             common.Hash      `json:"sha3Uncles"`
+	Miner                 common.Address   `json:"miner"`
+	StateRoot             common.Hash      `json:"stateRoot"`
+	TransactionsRoot      common.Hash      `json:"transactionsRoot"`
+	ReceiptsRoot          common.Hash      `json:"receiptsRoot"`
+	LogsBloom             hexutil.Bytes    `json:"logsBloom"`
+	Difficulty            *hexutil.Big     `json:"difficulty"`
+	Number                *hexutil.Big     `json:"number"`
+	GasLimit              hexutil.Uint64   `json:"gasLimit"`
+	GasUsed               hexutil.Uint64   `json:"gasUsed"`
+	Timestamp             hexutil.Uint64   `json:"timestamp"`
+	ExtraData             hexutil.Bytes    `json:"extraData"`
+	MixHash               common.Hash      `json:"mixHash"`
+	Nonce                 types.BlockNonce `json:"nonce"`
+	BaseFeePerGas         *hexutil.Big     `json:"baseFeePerGas"`
+	WithdrawalsRoot       *common.Hash     `json:"withdrawalsRoot"`
+	BlobGasUsed           *hexutil.Uint64  `json:"blobGasUsed"`
+	ExcessBlobGas         *hexutil.Uint64  `json:"excessBlobGas"`
+	ParentBeaconBlockRoot *common.Hash     `json:"parentBeaconBlockRoot"`
+	RequestsHash          *common.Hash     `json:"requestsHash"`
+}
+
+type executionLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
+// executionReceipt is a transaction receipt as returned by eth_getBlockReceipts. Only the fields of the consensus
+// encoding are decoded; gasUsed and effectiveGasPrice aren't covered by the receipts root, so they can't be trusted.
+type executionReceipt struct {
+	Type              hexutil.Uint64  `json:"type"`
+	Root              hexutil.Bytes   `json:"root"`
+	Status            *hexutil.Uint64 `json:"status"`
+	CumulativeGasUsed hexutil.Uint64  `json:"cumulativeGasUsed"`
+	LogsBloom         hexutil.Bytes   `json:"logsBloom"`
+	Logs              []executionLog  `json:"logs"`
+}
+
+type executionReceipts []executionReceipt
+
+// executionTransactions are the consensus encoded transactions of an execution payload
+type executionTransactions [][]byte
+
+// getExecutionBlock returns the header of the execution block with the given number
+func getExecutionBlock(network *Network, blockNumber uint64) (*executionBlock, error) {
+	client, errClient := getRPCBackendClient(network)
+	if errClient != nil {
+		return nil, errClient
+	}
+	var block *executionBlock
+	if errCall := callRPCBackend(client, "eth_getBlockByNumber", &block, hexutil.EncodeUint64(blockNumber), false); errCall != nil {
+		return nil, errCall
+	}
+	if block == nil {
+		return nil, errSlotDoesNotExist
+	}
+	return block, nil
+}
+
+// getExecutionReceipts returns all receipts of the execution block with the given number
+func getExecutionReceipts(network *Network, blockNumber uint64) (executionReceipts, error) {
+	client, errClient := getRPCBackendClient(network)
+	if errClient != nil {
+		return nil, errClient
+	}
+	receipts := make(executionReceipts, 0)
+	if errCall := callRPCBackend(client, "eth_getBlockReceipts", &receipts, hexutil.EncodeUint64(blockNumber)); errCall != nil {
+		return nil, errCall
+	}
+	return receipts, nil
+}
+
+// computeHash returns the keccak256 hash of the RLP encoded header
+func (b *executionBlock) computeHash() (common.Hash, error) {
+	fields := []interface{}{
+		b.ParentHash,
+		b.UncleHash,
+		b.Miner,
+		b.StateRoot,
+		b.TransactionsRoot,
+		b.ReceiptsRoot,
+		[]byte(b.LogsBloom),
+		hexBigToInt(b.Difficulty),
+		hexBigToInt(b.Number),
+		uint64(b.GasLimit),
+		uint64(b.GasUsed),
+		uint64(b.Timestamp),
+		[]byte(b.ExtraData),
+		b.MixHash,
+		b.Nonce,
+	}
+	// Fork specific fields are appended in the order they were introduced
+	if b.BaseFeePerGas != nil {
+		fields = append(fields, hexBigToInt(b.BaseFeePerGas))
+	}
+	if b.WithdrawalsRoot != nil {
+		fields = append(fields, *b.WithdrawalsRoot)
+	}
+	if b.BlobGasUsed != nil {
+		fields = append(fields, uint64(*b.BlobGasUsed))
+	}
+	if b.ExcessBlobGas != nil {
+		fields = append(fields, uint64(*b.ExcessBlobGas))
+	}
+	if b.ParentBeaconBlockRoot != nil {
+		fields = append(fields, *b.ParentBeaconBlockRoot)
+	}
+	if b.RequestsHash != nil {
+		fields = append(fields, *b.RequestsHash)
+	}
+
+	encoded, errEncode := rlp.EncodeToBytes(fields)
+	if errEncode != nil {
+		return common.Hash{}, fmt.Errorf("unable to encode block header: %v", errEncode)
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// Len implements types.DerivableList
+func (r executionReceipts) Len() int {
+	return len(r)
+}
+
+// EncodeIndex implements types.DerivableList using the consensus encoding of the receipt
+func (r executionReceipts) EncodeIndex(i int, w *bytes.Buffer) {
+	receipt := r[i]
+	// Pre-Byzantium receipts contain the intermediate state root instead of a status
+	postStateOrStatus := []byte(receipt.Root)
+	if receipt.Status != nil && *receipt.Status == 1 {
+		postStateOrStatus = []byte{0x01}
+	} else if receipt.Status != nil {
+		postStateOrStatus = []byte{}
+	}
+	logs := make([]interface{}, len(receipt.Logs))
+	for idx, entry := range receipt.Logs {
+		logs[idx] = []interface{}{entry.Address, entry.Topics, []byte(entry.Data)}
+	}
+
+	// Typed receipts are prefixed with their type byte
+	if receipt.Type != 0 {
+		w.WriteByte(byte(receipt.Type))
+	}
+	// Encoding of these plain values can't fail
+	_ = rlp.Encode(w, []interface{}{postStateOrStatus, uint64(receipt.CumulativeGasUsed), []byte(receipt.LogsBloom), logs})
+}
+
+// computeRoot returns the root of the receipts trie
+func (r executionReceipts) computeRoot() common.Hash {
+	return types.DeriveSha(r, trie.NewStackTrie(nil))
+}
+
+// decodeExecutionTransactions decodes the hex encoded transactions of a beacon block's execution payload
+func decodeExecutionTransactions(encoded []string) (executionTransactions, error) {
+	transactions := make(executionTransactions, 0, len(encoded))
+	for i, transaction := range encoded {
+		decoded, errDecode := hexutil.Decode(transaction)
+		if errDecode != nil || len(decoded) == 0 {
+			return nil, fmt.Errorf("invalid transaction %v of execution payload", i)
+		}
+		transactions = append(transactions, decoded)
+	}
+	return transactions, nil
+}
+
+// Len implements types.DerivableList
+func (t executionTransactions) Len() int {
+	return len(t)
+}
+
+// EncodeIndex implements types.DerivableList; the payload holds the consensus encoding already
+func (t executionTransactions) EncodeIndex(i int, w *bytes.Buffer) {
+	w.Write(t[i])
+}
+
+// computeRoot returns the root of the transactions trie
+func (t executionTransactions) computeRoot() common.Hash {
+	return types.DeriveSha(t, trie.NewStackTrie(nil))
+}
+
+// priorityFeePerGas returns the fee per gas the transaction paid to the fee recipient on top of the base fee.
+// The fee fields are read from the encoding directly, since the bundled go-ethereum version doesn't know about
+// blob and set code transactions.
+func (t executionTransactions) priorityFeePerGas(i int, baseFee *big.Int) (*big.Int, error) {
+	encoded := t[i]
+	// Legacy transactions are plain lists, typed ones are prefixed with their type byte
+	txType := byte(0)
+	if encoded[0] < 0xc0 {
+		txType, encoded = encoded[0], encoded[1:]
+	}
+	fields := make([]rlp.RawValue, 0)
+	if errDecode := rlp.DecodeBytes(encoded, &fields); errDecode != nil {
+		return nil, fmt.Errorf("unable to decode transaction %v: %v", i, errDecode)
+	}
+	field := func(index int) (*big.Int, error) {
+		value := new(big.Int)
+		if index >= len(fields) {
+			return nil, fmt.Errorf("transaction %v of type %v has no field %v", i, txType, index)
+		}
+		if errDecode := rlp.DecodeBytes(fields[index], value); errDecode != nil {
+			return nil, fmt.Errorf("unable to decode field %v of transaction %v: %v", index, i, errDecode)
+		}
+		return value, nil
+	}
+
+	switch txType {
+	case types.LegacyTxType, types.AccessListTxType:
+		// [nonce, gasPrice, ...] and [chainId, nonce, gasPrice, ...]
+		gasPrice, errGasPrice := field(int(txType) + 1)
+		if errGasPrice != nil {
+			return nil, errGasPrice
+		}
+		return new(big.Int).Sub(gasPrice, baseFee), nil
+	default:
+		// Dynamic fee, blob and set code transactions start with [chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, ...]
+		maxPriorityFee, errPriorityFee := field(2)
+		if errPriorityFee != nil {
+			return nil, errPriorityFee
+		}
+		maxFee, errMaxFee := field(3)
+		if errMaxFee != nil {
+			return nil, errMaxFee
+		}
+		// The effective gas price is min(maxFeePerGas, baseFee+maxPriorityFeePerGas)
+		if headroom := new(big.Int).Sub(maxFee, baseFee); headroom.Cmp(maxPriorityFee) < 0 {
+			return headroom, nil
+		}
+		return maxPriorityFee, nil
+	}
+}
+
+// priorityFees returns the sum of all priority fees paid to the fee recipient of the block in wei. The gas used by
+// each transaction is the difference of the cumulative gas used of consecutive receipts, and the fees per gas are
+// taken from the transactions; both are committed to by the block header.
+func (r executionReceipts) priorityFees(transactions executionTransactions, baseFee *big.Int) (*big.Int, error) {
+	if len(transactions) != len(r) {
+		return nil, fmt.Errorf("block has %v transactions but %v receipts", len(transactions), len(r))
+	}
+	fees := new(big.Int)
+	previousCumulativeGasUsed := uint64(0)
+	for i, receipt := range r {
+		if uint64(receipt.CumulativeGasUsed) < previousCumulativeGasUsed {
+			return nil, fmt.Errorf("cumulative gas used of receipt %v decreases", i)
+		}
+		gasUsed := uint64(receipt.CumulativeGasUsed) - previousCumulativeGasUsed
+		previousCumulativeGasUsed = uint64(receipt.CumulativeGasUsed)
+
+		tip, errTip := transactions.priorityFeePerGas(i, baseFee)
+		if errTip != nil {
+			return nil, errTip
+		}
+		fees.Add(fees, tip.Mul(tip, new(big.Int).SetUint64(gasUsed)))
+	}
+	return fees, nil
+}
+
+func hexBigToInt(value *hexutil.Big) *big.Int {
+	if value == nil {
+		return new(big.Int)
+	}
+	return value.ToInt()
+}
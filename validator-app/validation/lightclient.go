@@ -0,0 +1,585 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	log "github.com/sirupsen/logrus"
+	blst "github.com/supranational/blst/bindings/go"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	// Generalized indices of the light client merkle proofs; Electra added beacon state fields, which moved the
+	// state fields one level deeper
+	finalizedRootGindex               = 105
+	finalizedRootGindexElectra        = 169
+	currentSyncCommitteeGindex        = 54
+	currentSyncCommitteeGindexElectra = 86
+	nextSyncCommitteeGindex           = 55
+	nextSyncCommitteeGindexElectra    = 87
+	executionPayloadGindex            = 25
+
+	maxLightClientUpdatesPerRequest = 128
+	// Execution blocks fetched by a single finality lookup; further lookups continue where it stopped. Blocks older
+	// than this are reported as unverified until enough lookups walked back to them.
+	maxExecutionBlocksPerLookup = 16
+)
+
+var (
+	// Domain and signature scheme of sync committee signatures
+	domainSyncCommittee = [4]byte{0x07, 0x00, 0x00, 0x00}
+	blsSignatureDST     = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+)
+
+type lightClientBeaconHeader struct {
+	Slot          uint64      `json:"slot,string"`
+	ProposerIndex uint64      `json:"proposer_index,string"`
+	ParentRoot    common.Hash `json:"parent_root"`
+	StateRoot     common.Hash `json:"state_root"`
+	BodyRoot      common.Hash `json:"body_root"`
+}
+
+// lightClientExecutionHeader is the execution payload header of a light client header (Capella and later)
+type lightClientExecutionHeader struct {
+	ParentHash       common.Hash    `json:"parent_hash"`
+	FeeRecipient     common.Address `json:"fee_recipient"`
+	StateRoot        common.Hash    `json:"state_root"`
+	ReceiptsRoot     common.Hash    `json:"receipts_root"`
+	LogsBloom        hexutil.Bytes  `json:"logs_bloom"`
+	PrevRandao       common.Hash    `json:"prev_randao"`
+	BlockNumber      uint64         `json:"block_number,string"`
+	GasLimit         uint64         `json:"gas_limit,string"`
+	GasUsed          uint64         `json:"gas_used,string"`
+	Timestamp        uint64         `json:"timestamp,string"`
+	ExtraData        hexutil.Bytes  `json:"extra_data"`
+	BaseFeePerGas    string         `json:"base_fee_per_gas"`
+	BlockHash        common.Hash    `json:"block_hash"`
+	TransactionsRoot common.Hash    `json:"transactions_root"`
+	WithdrawalsRoot  common.Hash    `json:"withdrawals_root"`
+	// Deneb and later
+	BlobGasUsed   string `json:"blob_gas_used,omitempty"`
+	ExcessBlobGas string `json:"excess_blob_gas,omitempty"`
+}
+
+type lightClientHeader struct {
+	Beacon          lightClientBeaconHeader     `json:"beacon"`
+	Execution       *lightClientExecutionHeader `json:"execution,omitempty"`
+	ExecutionBranch []common.Hash               `json:"execution_branch,omitempty"`
+}
+
+type lightClientSyncCommittee struct {
+	Pubkeys         []hexutil.Bytes `json:"pubkeys"`
+	AggregatePubkey hexutil.Bytes   `json:"aggregate_pubkey"`
+}
+
+type lightClientSyncAggregate struct {
+	SyncCommitteeBits      hexutil.Bytes `json:"sync_committee_bits"`
+	SyncCommitteeSignature hexutil.Bytes `json:"sync_committee_signature"`
+}
+
+type lightClientBootstrap struct {
+	Header                     lightClientHeader         `json:"header"`
+	CurrentSyncCommittee       *lightClientSyncCommittee `json:"current_sync_committee"`
+	CurrentSyncCommitteeBranch []common.Hash             `json:"current_sync_committee_branch"`
+}
+
+// lightClientUpdate covers both full updates and finality updates, which lack the next sync committee
+type lightClientUpdate struct {
+	AttestedHeader          lightClientHeader         `json:"attested_header"`
+	NextSyncCommittee       *lightClientSyncCommittee `json:"next_sync_committee,omitempty"`
+	NextSyncCommitteeBranch []common.Hash             `json:"next_sync_committee_branch,omitempty"`
+	FinalizedHeader         lightClientHeader         `json:"finalized_header"`
+	FinalityBranch          []common.Hash             `json:"finality_branch"`
+	SyncAggregate           lightClientSyncAggregate  `json:"sync_aggregate"`
+	SignatureSlot           uint64                    `json:"signature_slot,string"`
+}
+
+// verifiedExecutionBlock is an execution block known to be part of the finalized chain
+type verifiedExecutionBlock struct {
+	hash       common.Hash
+	parentHash common.Hash
+}
+
+type lightClient struct {
+	network     *Network
+	source      lightClientSource
+	maxAncestry uint64
+	maxWalk     uint64
+
+	// Store
+	finalizedHeader      *lightClientHeader
+	currentSyncCommittee *lightClientSyncCommittee
+	nextSyncCommittee    *lightClientSyncCommittee
+	// Execution blocks verified by walking back from the finalized execution block
+	verifiedExecutionBlocks map[uint64]verifiedExecutionBlock
+	mtx                     sync.RWMutex
+	// Serializes the walks, so concurrent lookups don't fetch the same blocks
+	walkMtx sync.Mutex
+}
+
+// LightClientConfig configures the light client of a network
+type LightClientConfig struct {
+	// Checkpoint is the hex encoded trusted block root the light client bootstraps from; it's disabled if empty
+	Checkpoint string
+	// Fixtures is a directory of bootstrap and update fixtures which are used instead of the beacon node
+	Fixtures string
+	// MaxAncestry limits how many execution blocks below a finalized block can be verified; defaults to 8192
+	MaxAncestry uint64
+	// SyncInterval is the interval updates are followed in; defaults to one epoch
+	SyncInterval time.Duration
+}
+
+// InitLightClient bootstraps a light client for every network of the environment with a configured trusted
+// checkpoint and keeps following sync committee updates in the background until the context is done.
+func InitLightClient(ctx context.Context) error {
+	return EnvNetworks().InitLightClient(ctx)
+}
+
+// InitLightClient bootstraps a light client for every network with a configured trusted checkpoint
+// and keeps following sync committee updates in the background until the context is done.
+func (n *Networks) InitLightClient(ctx context.Context) error {
+	for _, network := range n.All() {
+		if errInit := initNetworkLightClient(ctx, network); errInit != nil {
+			return fmt.Errorf("%v: %v", network.Name, errInit)
+		}
+	}
+	return nil
+}
+
+// LightClientEnabled returns true if a trusted checkpoint is configured for the network
+func (n *Network) LightClientEnabled() bool {
+	return len(n.lightClientConfig.Checkpoint) > 0
+}
+
+// HasLightClient returns true if the light client of the network has been initialized and verifies finality
+func (n *Network) HasLightClient() bool {
+	return n.lightClient != nil
+}
+
+func initNetworkLightClient(ctx context.Context, network *Network) error {
+	config := network.lightClientConfig
+	if len(config.Checkpoint) == 0 {
+		return nil
+	}
+	checkpointRoot, errRoot := hexutil.Decode(config.Checkpoint)
+	if errRoot != nil || len(checkpointRoot) != 32 {
+		return fmt.Errorf("invalid light client checkpoint: %v", config.Checkpoint)
+	}
+
+	// Load data either from local fixtures or from the beacon node
+	var source lightClientSource = &beaconLightClientSource{network: network}
+	if len(config.Fixtures) > 0 {
+		source = &fixtureLightClientSource{network: network, directory: config.Fixtures}
+	}
+
+	client := newLightClient(network, source, config.MaxAncestry)
+	if errBootstrap := client.bootstrap(common.BytesToHash(checkpointRoot)); errBootstrap != nil {
+		return fmt.Errorf("light client bootstrap failed: %v", errBootstrap)
+	}
+	if errSync := client.sync(); errSync != nil {
+		return fmt.Errorf("light client sync failed: %v", errSync)
+	}
+	network.lightClient = client
+
+	// Follow updates; a new finalized checkpoint is produced about once per epoch
+	interval := config.SyncInterval
+	if interval <= 0 {
+		interval = time.Duration(network.SecondsPerSlot*network.SlotsPerEpoch) * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if errSync := client.sync(); errSync != nil {
+					log.Warnf("light client sync failed for %v: %v", network.Name, errSync)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// newLightClient creates a light client which needs to be bootstrapped; maxAncestry defaults to one day of blocks
+func newLightClient(network *Network, source lightClientSource, maxAncestry uint64) *lightClient {
+	if maxAncestry == 0 {
+		maxAncestry = 8192
+	}
+	return &lightClient{
+		network:                 network,
+		source:                  source,
+		maxAncestry:             maxAncestry,
+		maxWalk:                 maxExecutionBlocksPerLookup,
+		verifiedExecutionBlocks: make(map[uint64]verifiedExecutionBlock),
+	}
+}
+
+// bootstrap initializes the store from the trusted checkpoint block root
+func (c *lightClient) bootstrap(checkpointRoot common.Hash) error {
+	bootstrap, errBootstrap := c.source.getBootstrap(checkpointRoot)
+	if errBootstrap != nil {
+		return errBootstrap
+	}
+	if headerRoot := common.Hash(bootstrap.Header.Beacon.hashTreeRoot()); headerRoot != checkpointRoot {
+		return fmt.Errorf("bootstrap header root %v doesn't match checkpoint %v", headerRoot, checkpointRoot)
+	}
+	if errHeader := bootstrap.Header.verifyExecution(); errHeader != nil {
+		return errHeader
+	}
+	if bootstrap.CurrentSyncCommittee == nil {
+		return errors.New("bootstrap contains no sync committee")
+	}
+	if !isValidMerkleBranch(bootstrap.CurrentSyncCommittee.hashTreeRoot(), hashesToRoots(bootstrap.CurrentSyncCommitteeBranch),
+		c.stateGindex(bootstrap.Header.Beacon.Slot, currentSyncCommitteeGindex, currentSyncCommitteeGindexElectra), bootstrap.Header.Beacon.StateRoot) {
+		return errors.New("invalid current sync committee branch")
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.finalizedHeader = &bootstrap.Header
+	c.currentSyncCommittee = bootstrap.CurrentSyncCommittee
+	c.nextSyncCommittee = nil
+	log.Infof("Light client for %v bootstrapped at slot %v", c.network.Name, bootstrap.Header.Beacon.Slot)
+	return nil
+}
+
+// sync applies all updates from the current store period up to the latest finality update
+func (c *lightClient) sync() error {
+	c.mtx.RLock()
+	storePeriod := c.network.SyncPeriodAtSlot(c.finalizedHeader.Beacon.Slot)
+	c.mtx.RUnlock()
+
+	updates, errUpdates := c.source.getUpdates(storePeriod, maxLightClientUpdatesPerRequest)
+	if errUpdates != nil {
+		return errUpdates
+	}
+	for _, update := range updates {
+		if errUpdate := c.processUpdate(update); errUpdate != nil {
+			return errUpdate
+		}
+	}
+
+	finalityUpdate, errFinality := c.source.getFinalityUpdate()
+	if errFinality != nil {
+		return errFinality
+	}
+	if finalityUpdate == nil {
+		return nil
+	}
+	return c.processUpdate(finalityUpdate)
+}
+
+// processUpdate verifies the update against the store and applies it
+func (c *lightClient) processUpdate(update *lightClientUpdate) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	finalizedSlot := c.finalizedHeader.Beacon.Slot
+	storePeriod := c.network.SyncPeriodAtSlot(finalizedSlot)
+	attestedSlot := update.AttestedHeader.Beacon.Slot
+	// Ignore updates we already applied
+	if update.FinalizedHeader.Beacon.Slot <= finalizedSlot && (update.NextSyncCommittee == nil || c.nextSyncCommittee != nil) {
+		return nil
+	}
+	if update.SignatureSlot <= attestedSlot || attestedSlot < update.FinalizedHeader.Beacon.Slot {
+		return fmt.Errorf("invalid update slots: signature %v, attested %v, finalized %v",
+			update.SignatureSlot, attestedSlot, update.FinalizedHeader.Beacon.Slot)
+	}
+
+	// Pick the committee which signed the update
+	signaturePeriod := c.network.SyncPeriodAtSlot(update.SignatureSlot)
+	var committee *lightClientSyncCommittee
+	switch {
+	case signaturePeriod == storePeriod:
+		committee = c.currentSyncCommittee
+	case signaturePeriod == storePeriod+1 && c.nextSyncCommittee != nil:
+		committee = c.nextSyncCommittee
+	default:
+		return fmt.Errorf("no sync committee known for period %v", signaturePeriod)
+	}
+
+	// Verify all headers and proofs before checking the signature
+	for _, header := range []*lightClientHeader{&update.AttestedHeader, &update.FinalizedHeader} {
+		if errHeader := header.verifyExecution(); errHeader != nil {
+			return errHeader
+		}
+	}
+	if !isValidMerkleBranch(update.FinalizedHeader.Beacon.hashTreeRoot(), hashesToRoots(update.FinalityBranch),
+		c.stateGindex(attestedSlot, finalizedRootGindex, finalizedRootGindexElectra), update.AttestedHeader.Beacon.StateRoot) {
+		return errors.New("invalid finality branch")
+	}
+	if update.NextSyncCommittee != nil {
+		if c.network.SyncPeriodAtSlot(attestedSlot) != c.network.SyncPeriodAtSlot(update.FinalizedHeader.Beacon.Slot) {
+			return errors.New("next sync committee update is not finalized in the same period")
+		}
+		if !isValidMerkleBranch(update.NextSyncCommittee.hashTreeRoot(), hashesToRoots(update.NextSyncCommitteeBranch),
+			c.stateGindex(attestedSlot, nextSyncCommitteeGindex, nextSyncCommitteeGindexElectra), update.AttestedHeader.Beacon.StateRoot) {
+			return errors.New("invalid next sync committee branch")
+		}
+	}
+	if errSignature := c.verifySyncAggregate(committee, update); errSignature != nil {
+		return errSignature
+	}
+
+	// Apply the update; rotate committees once the finalized header enters the next period
+	if update.NextSyncCommittee != nil && c.nextSyncCommittee == nil && c.network.SyncPeriodAtSlot(attestedSlot) == storePeriod {
+		c.nextSyncCommittee = update.NextSyncCommittee
+	}
+	if update.FinalizedHeader.Beacon.Slot > finalizedSlot {
+		if c.network.SyncPeriodAtSlot(update.FinalizedHeader.Beacon.Slot) == storePeriod+1 {
+			if c.nextSyncCommittee == nil {
+				return errors.New("unable to rotate sync committee without next committee")
+			}
+			c.currentSyncCommittee = c.nextSyncCommittee
+			c.nextSyncCommittee = nil
+			if update.NextSyncCommittee != nil && c.network.SyncPeriodAtSlot(attestedSlot) == storePeriod+1 {
+				c.nextSyncCommittee = update.NextSyncCommittee
+			}
+		}
+		c.finalizedHeader = &update.FinalizedHeader
+		// Verified blocks stay valid since finality can't be reverted; only bound the memory they take up
+		if uint64(len(c.verifiedExecutionBlocks)) > 2*c.maxAncestry {
+			c.verifiedExecutionBlocks = make(map[uint64]verifiedExecutionBlock)
+		}
+		log.Debugf("Light client for %v finalized slot %v", c.network.Name, update.FinalizedHeader.Beacon.Slot)
+	}
+	return nil
+}
+
+// verifySyncAggregate verifies the sync committee signature over the attested header
+func (c *lightClient) verifySyncAggregate(committee *lightClientSyncCommittee, update *lightClientUpdate) error {
+	bits := update.SyncAggregate.SyncCommitteeBits
+	if len(bits)*8 != SyncCommitteeSize || len(committee.Pubkeys) != SyncCommitteeSize {
+		return errors.New("invalid sync committee size")
+	}
+
+	// Collect the participating public keys
+	pubkeys := make([]*blst.P1Affine, 0, SyncCommitteeSize)
+	for i, pubkey := range committee.Pubkeys {
+		if (bits[i/8]>>(uint(i)%8))&1 == 0 {
+			continue
+		}
+		point := new(blst.P1Affine).Uncompress(pubkey)
+		if point == nil {
+			return fmt.Errorf("invalid sync committee pubkey %v", pubkey)
+		}
+		pubkeys = append(pubkeys, point)
+	}
+	// Require a supermajority, as the spec does for applying finality
+	if len(pubkeys)*3 < SyncCommitteeSize*2 {
+		return fmt.Errorf("insufficient sync committee participation: %v of %v", len(pubkeys), SyncCommitteeSize)
+	}
+
+	// The signature is made over the attested header, in the fork active in the slot before the signature slot
+	signatureSlot := update.SignatureSlot
+	if signatureSlot > 0 {
+		signatureSlot--
+	}
+	fork := c.network.ForkAtEpoch(c.network.EpochAtSlot(signatureSlot))
+	domain := computeDomain(domainSyncCommittee, fork.Version, c.network.GenesisValidatorsRoot)
+	signingRoot := merkleize([][32]byte{update.AttestedHeader.Beacon.hashTreeRoot(), domain}, 2)
+
+	signature := new(blst.P2Affine).Uncompress(update.SyncAggregate.SyncCommitteeSignature)
+	if signature == nil {
+		return errors.New("invalid sync committee signature encoding")
+	}
+	if !signature.FastAggregateVerify(true, pubkeys, signingRoot[:], blsSignatureDST) {
+		return errors.New("invalid sync committee signature")
+	}
+	return nil
+}
+
+// isFinalizedExecutionBlock checks whether the execution block with the given number and hash is part of the
+// finalized chain, by walking the verified parent hashes back from the finalized execution block. A lookup fetches
+// at most maxWalk blocks; it returns false if the block wasn't reached, and later lookups continue from there.
+func (c *lightClient) isFinalizedExecutionBlock(number uint64, hash common.Hash) (bool, error) {
+	start, verified, ok := c.closestVerifiedExecutionBlock(number)
+	if !ok {
+		return false, nil
+	}
+	observeCacheLookup(CacheVerifiedExecutionBlocks, start == number)
+	if start == number {
+		return verified.hash == hash, nil
+	}
+
+	// Lookups waiting for a running walk continue from the blocks it verified
+	c.walkMtx.Lock()
+	defer c.walkMtx.Unlock()
+	if start, verified, ok = c.closestVerifiedExecutionBlock(number); !ok {
+		return false, nil
+	}
+	if start == number {
+		return verified.hash == hash, nil
+	}
+	walked, errWalk := c.walkExecutionBlocks(start, verified, number)
+	// Blocks verified before a failure are kept as well
+	c.mtx.Lock()
+	for i, block := range walked {
+		c.verifiedExecutionBlocks[start-1-uint64(i)] = block
+	}
+	c.mtx.Unlock()
+	if errWalk != nil {
+		return false, errWalk
+	}
+	if start-uint64(len(walked)) > number {
+		return false, nil
+	}
+	return walked[len(walked)-1].hash == hash, nil
+}
+
+// closestVerifiedExecutionBlock returns the lowest verified block at or above the given block number; it returns
+// false if the block isn't finalized or too old to be verified
+func (c *lightClient) closestVerifiedExecutionBlock(number uint64) (uint64, verifiedExecutionBlock, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	finalized := c.finalizedHeader.Execution
+	if finalized == nil || number > finalized.BlockNumber || finalized.BlockNumber-number > c.maxAncestry {
+		return 0, verifiedExecutionBlock{}, false
+	}
+	if _, ok := c.verifiedExecutionBlocks[finalized.BlockNumber]; !ok {
+		c.verifiedExecutionBlocks[finalized.BlockNumber] = verifiedExecutionBlock{hash: finalized.BlockHash, parentHash: finalized.ParentHash}
+	}
+	start := number
+	for ; start < finalized.BlockNumber; start++ {
+		if _, ok := c.verifiedExecutionBlocks[start]; ok {
+			break
+		}
+	}
+	return start, c.verifiedExecutionBlocks[start], true
+}
+
+// walkExecutionBlocks fetches the ancestors of the verified block at start, down to the given block number or up
+// to maxWalk blocks, and verifies each against the parent hash of its child
+func (c *lightClient) walkExecutionBlocks(start uint64, verified verifiedExecutionBlock, number uint64) ([]verifiedExecutionBlock, error) {
+	walked := make([]verifiedExecutionBlock, 0)
+	for current := start; current > number && uint64(len(walked)) < c.maxWalk; current-- {
+		block, errBlock := getExecutionBlock(c.network, current-1)
+		if errBlock != nil {
+			return walked, errBlock
+		}
+		blockHash, errHash := block.computeHash()
+		if errHash != nil {
+			return walked, errHash
+		}
+		if blockHash != verified.parentHash {
+			return walked, &IntegrityError{
+				Check:    IntegrityCheckBlockHash,
+				Expected: verified.parentHash.Hex(),
+				Actual:   blockHash.Hex(),
+			}
+		}
+		verified = verifiedExecutionBlock{hash: blockHash, parentHash: block.ParentHash}
+		walked = append(walked, verified)
+	}
+	return walked, nil
+}
+
+// stateGindex returns the generalized index of a beacon state field in the fork active at the given slot
+func (c *lightClient) stateGindex(slot, gindex, gindexElectra uint64) uint64 {
+	active := c.network.ForkAtEpoch(c.network.EpochAtSlot(slot))
+	for _, fork := range c.network.Forks {
+		if fork.Name == "electra" && active.Epoch >= fork.Epoch {
+			return gindexElectra
+		}
+	}
+	return gindex
+}
+
+// hashTreeRoot returns the SSZ root of the beacon block header, which equals the block root
+func (h *lightClientBeaconHeader) hashTreeRoot() [32]byte {
+	return merkleize([][32]byte{
+		uint64Root(h.Slot),
+		uint64Root(h.ProposerIndex),
+		h.ParentRoot,
+		h.StateRoot,
+		h.BodyRoot,
+	}, 5)
+}
+
+// verifyExecution verifies the execution payload header is part of the beacon block body
+func (h *lightClientHeader) verifyExecution() error {
+	// Headers before Capella don't carry an execution payload header
+	if h.Execution == nil {
+		return nil
+	}
+	root, errRoot := h.Execution.hashTreeRoot()
+	if errRoot != nil {
+		return errRoot
+	}
+	if !isValidMerkleBranch(root, hashesToRoots(h.ExecutionBranch), executionPayloadGindex, h.Beacon.BodyRoot) {
+		return fmt.Errorf("invalid execution branch for slot %v", h.Beacon.Slot)
+	}
+	return nil
+}
+
+// hashTreeRoot returns the SSZ root of the execution payload header
+func (h *lightClientExecutionHeader) hashTreeRoot() ([32]byte, error) {
+	baseFee, ok := new(big.Int).SetString(h.BaseFeePerGas, 10)
+	if !ok {
+		return [32]byte{}, fmt.Errorf("invalid base fee: %v", h.BaseFeePerGas)
+	}
+	fields := [][32]byte{
+		h.ParentHash,
+		bytesRoot(h.FeeRecipient.Bytes()),
+		h.StateRoot,
+		h.ReceiptsRoot,
+		bytesRoot(h.LogsBloom),
+		h.PrevRandao,
+		uint64Root(h.BlockNumber),
+		uint64Root(h.GasLimit),
+		uint64Root(h.GasUsed),
+		uint64Root(h.Timestamp),
+		byteListRoot(h.ExtraData, 32),
+		uint256Root(baseFee),
+		h.BlockHash,
+		h.TransactionsRoot,
+		h.WithdrawalsRoot,
+	}
+	if len(h.BlobGasUsed) > 0 || len(h.ExcessBlobGas) > 0 {
+		for _, value := range []string{h.BlobGasUsed, h.ExcessBlobGas} {
+			parsed, ok := new(big.Int).SetString(value, 10)
+			if !ok || !parsed.IsUint64() {
+				return [32]byte{}, fmt.Errorf("invalid blob gas value: %v", value)
+			}
+			fields = append(fields, uint64Root(parsed.Uint64()))
+		}
+	}
+	return merkleize(fields, len(fields)), nil
+}
+
+// hashTreeRoot returns the SSZ root of the sync committee
+func (s *lightClientSyncCommittee) hashTreeRoot() [32]byte {
+	pubkeys := make([][32]byte, len(s.Pubkeys))
+	for i, pubkey := range s.Pubkeys {
+		pubkeys[i] = bytesRoot(pubkey)
+	}
+	return merkleize([][32]byte{
+		merkleize(pubkeys, SyncCommitteeSize),
+		bytesRoot(s.AggregatePubkey),
+	}, 2)
+}
+
+// computeDomain returns the signing domain for the given domain type and fork
+func computeDomain(domainType [4]byte, version [4]byte, genesisValidatorsRoot [32]byte) [32]byte {
+	forkDataRoot := merkleize([][32]byte{bytesRoot(version[:]), genesisValidatorsRoot}, 2)
+	var domain [32]byte
+	copy(domain[:4], domainType[:])
+	copy(domain[4:], forkDataRoot[:28])
+	return domain
+}
+
+func hashesToRoots(hashes []common.Hash) [][32]byte {
+	roots := make([][32]byte, len(hashes))
+	for i, hash := range hashes {
+		roots[i] = hash
+	}
+	return roots
+}
@@ -0,0 +1,142 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"os"
+	"path/filepath"
+)
+
+// lightClientSource provides the data the light client verifies; none of it needs to be trusted
+type lightClientSource interface {
+	getBootstrap(checkpointRoot common.Hash) (*lightClientBootstrap, error)
+	getUpdates(startPeriod, count uint64) ([]*lightClientUpdate, error)
+	getFinalityUpdate() (*lightClientUpdate, error)
+}
+
+// lightClientVersionedData is the format of a single entry returned by the light client updates endpoint
+type lightClientVersionedData struct {
+	Version string          `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// beaconLightClientSource loads light client data from the beacon node's light client API
+type beaconLightClientSource struct {
+	network *Network
+}
+
+func (s *beaconLightClientSource) getBootstrap(checkpointRoot common.Hash) (*lightClientBootstrap, error) {
+	bootstrap := &lightClientBootstrap{}
+	_, found, err := beaconGet(s.network, fmt.Sprintf("/eth/v1/beacon/light_client/bootstrap/%v", checkpointRoot.Hex()), bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no bootstrap available for checkpoint %v", checkpointRoot.Hex())
+	}
+	return bootstrap, nil
+}
+
+func (s *beaconLightClientSource) getUpdates(startPeriod, count uint64) ([]*lightClientUpdate, error) {
+	body, found, err := beaconGetRaw(s.network, fmt.Sprintf("/eth/v1/beacon/light_client/updates?start_period=%v&count=%v", startPeriod, count))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return []*lightClientUpdate{}, nil
+	}
+	return decodeLightClientUpdates(body)
+}
+
+func (s *beaconLightClientSource) getFinalityUpdate() (*lightClientUpdate, error) {
+	update := &lightClientUpdate{}
+	_, found, err := beaconGet(s.network, "/eth/v1/beacon/light_client/finality_update", update)
+	if err != nil || !found {
+		return nil, err
+	}
+	return update, nil
+}
+
+// fixtureLightClientSource loads light client data from local files in the beacon API format:
+// bootstrap.json, updates.json and optionally finality_update.json
+type fixtureLightClientSource struct {
+	network   *Network
+	directory string
+}
+
+func (s *fixtureLightClientSource) getBootstrap(checkpointRoot common.Hash) (*lightClientBootstrap, error) {
+	envelope := &lightClientVersionedData{}
+	if errRead := s.readFile("bootstrap.json", envelope); errRead != nil {
+		return nil, errRead
+	}
+	bootstrap := &lightClientBootstrap{}
+	if errDecode := json.Unmarshal(envelope.Data, bootstrap); errDecode != nil {
+		return nil, fmt.Errorf("unable to decode bootstrap fixture: %v", errDecode)
+	}
+	return bootstrap, nil
+}
+
+func (s *fixtureLightClientSource) getUpdates(startPeriod, count uint64) ([]*lightClientUpdate, error) {
+	body, errRead := os.ReadFile(filepath.Join(s.directory, "updates.json"))
+	if errors.Is(errRead, os.ErrNotExist) {
+		return []*lightClientUpdate{}, nil
+	} else if errRead != nil {
+		return nil, errRead
+	}
+	all, errDecode := decodeLightClientUpdates(body)
+	if errDecode != nil {
+		return nil, errDecode
+	}
+
+	// Filter like the beacon API would
+	updates := make([]*lightClientUpdate, 0)
+	for _, update := range all {
+		period := s.network.SyncPeriodAtSlot(update.AttestedHeader.Beacon.Slot)
+		if period >= startPeriod && period < startPeriod+count {
+			updates = append(updates, update)
+		}
+	}
+	return updates, nil
+}
+
+func (s *fixtureLightClientSource) getFinalityUpdate() (*lightClientUpdate, error) {
+	envelope := &lightClientVersionedData{}
+	if errRead := s.readFile("finality_update.json", envelope); errors.Is(errRead, os.ErrNotExist) {
+		return nil, nil
+	} else if errRead != nil {
+		return nil, errRead
+	}
+	update := &lightClientUpdate{}
+	if errDecode := json.Unmarshal(envelope.Data, update); errDecode != nil {
+		return nil, fmt.Errorf("unable to decode finality update fixture: %v", errDecode)
+	}
+	return update, nil
+}
+
+func (s *fixtureLightClientSource) readFile(name string, out interface{}) error {
+	body, errRead := os.ReadFile(filepath.Join(s.directory, name))
+	if errRead != nil {
+		return errRead
+	}
+	if errDecode := json.Unmarshal(body, out); errDecode != nil {
+		return fmt.Errorf("unable to decode fixture %v: %v", name, errDecode)
+	}
+	return nil
+}
+
+func decodeLightClientUpdates(body []byte) ([]*lightClientUpdate, error) {
+	entries := make([]lightClientVersionedData, 0)
+	if errDecode := json.Unmarshal(body, &entries); errDecode != nil {
+		return nil, fmt.Errorf("unable to decode light client updates: %v", errDecode)
+	}
+	updates := make([]*lightClientUpdate, len(entries))
+	for i, entry := range entries {
+		updates[i] = &lightClientUpdate{}
+		if errDecode := json.Unmarshal(entry.Data, updates[i]); errDecode != nil {
+			return nil, fmt.Errorf("unable to decode light client update: %v", errDecode)
+		}
+	}
+	return updates, nil
+}
@@ -0,0 +1,351 @@
+package validation
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	blst "github.com/supranational/blst/bindings/go"
+	"math/big"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsValidMerkleBranch(t *testing.T) {
+	leaves := make([][32]byte, 8)
+	for i := range leaves {
+		leaves[i] = sha256.Sum256([]byte{byte(i)})
+	}
+	root := merkleize(leaves, 8)
+
+	// Proof for leaf 5: sibling 4, then the pair (6,7), then the left half
+	branch := [][32]byte{
+		leaves[4],
+		hashPair(leaves[6], leaves[7]),
+		merkleize(leaves[:4], 4),
+	}
+	if !isValidMerkleBranch(leaves[5], branch, 13, root) {
+		t.Error("expected valid branch")
+	}
+	if isValidMerkleBranch(leaves[5], branch, 12, root) {
+		t.Error("expected invalid branch for wrong index")
+	}
+	// The branch length has to match the depth of the generalized index
+	if isValidMerkleBranch(leaves[5], branch[:2], 13, root) {
+		t.Error("expected invalid branch for missing sibling")
+	}
+	if isValidMerkleBranch(leaves[5], append(branch, root), 13, hashPair(root, root)) {
+		t.Error("expected invalid branch for extra sibling")
+	}
+}
+
+func TestVerifySyncAggregate(t *testing.T) {
+	network, errNetwork := GetNetwork("mainnet")
+	if errNetwork != nil {
+		t.Fatal(errNetwork)
+	}
+	client := &lightClient{network: network}
+	update := &lightClientUpdate{
+		AttestedHeader: lightClientHeader{Beacon: lightClientBeaconHeader{
+			Slot:      9000000,
+			StateRoot: common.HexToHash("0x01"),
+			BodyRoot:  common.HexToHash("0x02"),
+		}},
+		SignatureSlot: 9000001,
+	}
+	domain := computeDomain(domainSyncCommittee, network.ForkAtEpoch(network.EpochAtSlot(update.SignatureSlot-1)).Version, network.GenesisValidatorsRoot)
+	signingRoot := merkleize([][32]byte{update.AttestedHeader.Beacon.hashTreeRoot(), domain}, 2)
+
+	// All but the last 100 members sign
+	committee := &lightClientSyncCommittee{}
+	bits := make(hexutil.Bytes, SyncCommitteeSize/8)
+	signatures := make([]*blst.P2Affine, 0)
+	for i := 0; i < SyncCommitteeSize; i++ {
+		ikm := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+		secretKey := blst.KeyGen(ikm[:])
+		committee.Pubkeys = append(committee.Pubkeys, new(blst.P1Affine).From(secretKey).Compress())
+		if i < SyncCommitteeSize-100 {
+			bits[i/8] |= 1 << (uint(i) % 8)
+			signatures = append(signatures, new(blst.P2Affine).Sign(secretKey, signingRoot[:], blsSignatureDST))
+		}
+	}
+	aggregate := new(blst.P2Aggregate)
+	if !aggregate.Aggregate(signatures, false) {
+		t.Fatal("unable to aggregate signatures")
+	}
+	update.SyncAggregate = lightClientSyncAggregate{
+		SyncCommitteeBits:      bits,
+		SyncCommitteeSignature: aggregate.ToAffine().Compress(),
+	}
+
+	if err := client.verifySyncAggregate(committee, update); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+
+	// Changing the attested header must invalidate the signature
+	update.AttestedHeader.Beacon.ProposerIndex = 1
+	if err := client.verifySyncAggregate(committee, update); err == nil {
+		t.Error("expected invalid signature for modified header")
+	}
+}
+
+// testStateTree builds a beacon state root containing the given leaves at their generalized indices
+type testStateTree map[uint64][32]byte
+
+func (tree testStateTree) node(gindex uint64, depth int) [32]byte {
+	if leaf, ok := tree[gindex]; ok {
+		return leaf
+	}
+	if bits.Len64(gindex)-1 >= depth {
+		return [32]byte{}
+	}
+	return hashPair(tree.node(2*gindex, depth), tree.node(2*gindex+1, depth))
+}
+
+func (tree testStateTree) root() common.Hash {
+	return tree.node(1, 8)
+}
+
+func (tree testStateTree) branch(gindex uint64) []common.Hash {
+	branch := make([]common.Hash, 0)
+	for ; gindex > 1; gindex /= 2 {
+		branch = append(branch, tree.node(gindex^1, 8))
+	}
+	return branch
+}
+
+// testSyncCommittee is a committee whose members all share one key, so an update needs only a single signature
+type testSyncCommittee struct {
+	secretKey *blst.SecretKey
+	committee *lightClientSyncCommittee
+}
+
+func newTestSyncCommittee(seed byte) *testSyncCommittee {
+	ikm := sha256.Sum256([]byte{seed})
+	secretKey := blst.KeyGen(ikm[:])
+	pubkey := new(blst.P1Affine).From(secretKey).Compress()
+	committee := &lightClientSyncCommittee{AggregatePubkey: pubkey}
+	for i := 0; i < SyncCommitteeSize; i++ {
+		committee.Pubkeys = append(committee.Pubkeys, pubkey)
+	}
+	return &testSyncCommittee{secretKey: secretKey, committee: committee}
+}
+
+// is returns true if the committee decoded by the light client is this one
+func (s *testSyncCommittee) is(committee *lightClientSyncCommittee) bool {
+	return committee != nil && committee.hashTreeRoot() == s.committee.hashTreeRoot()
+}
+
+// sign adds the sync aggregate of the full committee to the update
+func (s *testSyncCommittee) sign(network *Network, update *lightClientUpdate) {
+	domain := computeDomain(domainSyncCommittee, network.ForkAtEpoch(network.EpochAtSlot(update.SignatureSlot-1)).Version, network.GenesisValidatorsRoot)
+	signingRoot := merkleize([][32]byte{update.AttestedHeader.Beacon.hashTreeRoot(), domain}, 2)
+	signature := new(blst.P2Affine).Sign(s.secretKey, signingRoot[:], blsSignatureDST)
+	signatures := make([]*blst.P2Affine, SyncCommitteeSize)
+	bits := make(hexutil.Bytes, SyncCommitteeSize/8)
+	for i := range signatures {
+		signatures[i] = signature
+		bits[i/8] |= 1 << (uint(i) % 8)
+	}
+	aggregate := new(blst.P2Aggregate)
+	aggregate.Aggregate(signatures, false)
+	update.SyncAggregate = lightClientSyncAggregate{
+		SyncCommitteeBits:      bits,
+		SyncCommitteeSignature: aggregate.ToAffine().Compress(),
+	}
+}
+
+// newTestUpdate creates an update of the period which finalizes a header and proves the next committee
+func newTestUpdate(network *Network, period uint64, signer, next *testSyncCommittee) *lightClientUpdate {
+	firstSlot := period * network.EpochsPerSyncCommitteePeriod * network.SlotsPerEpoch
+	update := &lightClientUpdate{
+		FinalizedHeader:   lightClientHeader{Beacon: lightClientBeaconHeader{Slot: firstSlot + 128, StateRoot: common.HexToHash("0x01")}},
+		NextSyncCommittee: next.committee,
+		SignatureSlot:     firstSlot + 201,
+	}
+	tree := testStateTree{
+		finalizedRootGindexElectra:     update.FinalizedHeader.Beacon.hashTreeRoot(),
+		nextSyncCommitteeGindexElectra: next.committee.hashTreeRoot(),
+	}
+	update.AttestedHeader = lightClientHeader{Beacon: lightClientBeaconHeader{Slot: firstSlot + 200, StateRoot: tree.root()}}
+	update.FinalityBranch = tree.branch(finalizedRootGindexElectra)
+	update.NextSyncCommitteeBranch = tree.branch(nextSyncCommitteeGindexElectra)
+	signer.sign(network, update)
+	return update
+}
+
+// writeTestFixture writes the data in the versioned format of the beacon API
+func writeTestFixture(t *testing.T, directory, name string, data interface{}) {
+	encode := func(value interface{}) lightClientVersionedData {
+		encoded, errEncode := json.Marshal(value)
+		if errEncode != nil {
+			t.Fatal(errEncode)
+		}
+		return lightClientVersionedData{Version: "electra", Data: encoded}
+	}
+	var fixture interface{}
+	if updates, ok := data.([]*lightClientUpdate); ok {
+		entries := make([]lightClientVersionedData, len(updates))
+		for i, update := range updates {
+			entries[i] = encode(update)
+		}
+		fixture = entries
+	} else {
+		fixture = encode(data)
+	}
+	body, errEncode := json.Marshal(fixture)
+	if errEncode != nil {
+		t.Fatal(errEncode)
+	}
+	if errWrite := os.WriteFile(filepath.Join(directory, name), body, 0600); errWrite != nil {
+		t.Fatal(errWrite)
+	}
+}
+
+func TestLightClientFixtureSync(t *testing.T) {
+	network, errNetwork := GetNetwork("mainnet")
+	if errNetwork != nil {
+		t.Fatal(errNetwork)
+	}
+	// A period after the Electra fork, so the proofs use its generalized indices
+	period := uint64(1430)
+	committees := []*testSyncCommittee{newTestSyncCommittee(1), newTestSyncCommittee(2), newTestSyncCommittee(3)}
+
+	bootstrapTree := testStateTree{currentSyncCommitteeGindexElectra: committees[0].committee.hashTreeRoot()}
+	bootstrap := &lightClientBootstrap{
+		Header: lightClientHeader{Beacon: lightClientBeaconHeader{
+			Slot:      period*network.EpochsPerSyncCommitteePeriod*network.SlotsPerEpoch + 64,
+			StateRoot: bootstrapTree.root(),
+		}},
+		CurrentSyncCommittee:       committees[0].committee,
+		CurrentSyncCommitteeBranch: bootstrapTree.branch(currentSyncCommitteeGindexElectra),
+	}
+	checkpointRoot := common.Hash(bootstrap.Header.Beacon.hashTreeRoot())
+	// The first update provides the next committee, the second one is signed by it and finalizes the next period
+	updates := []*lightClientUpdate{
+		newTestUpdate(network, period, committees[0], committees[1]),
+		newTestUpdate(network, period+1, committees[1], committees[2]),
+	}
+
+	newClient := func(t *testing.T, updates []*lightClientUpdate) *lightClient {
+		directory := t.TempDir()
+		writeTestFixture(t, directory, "bootstrap.json", bootstrap)
+		writeTestFixture(t, directory, "updates.json", updates)
+		client := newLightClient(network, &fixtureLightClientSource{network: network, directory: directory}, 0)
+		if errBootstrap := client.bootstrap(checkpointRoot); errBootstrap != nil {
+			t.Fatalf("bootstrap failed: %v", errBootstrap)
+		}
+		return client
+	}
+
+	t.Run("period rollover", func(t *testing.T) {
+		client := newClient(t, updates)
+		if errSync := client.sync(); errSync != nil {
+			t.Fatalf("sync failed: %v", errSync)
+		}
+		if client.finalizedHeader.Beacon.Slot != updates[1].FinalizedHeader.Beacon.Slot {
+			t.Errorf("expected finalized slot %v, got %v", updates[1].FinalizedHeader.Beacon.Slot, client.finalizedHeader.Beacon.Slot)
+		}
+		if !committees[1].is(client.currentSyncCommittee) || !committees[2].is(client.nextSyncCommittee) {
+			t.Error("expected sync committees to be rotated")
+		}
+	})
+
+	t.Run("stale update", func(t *testing.T) {
+		client := newClient(t, updates)
+		if errSync := client.sync(); errSync != nil {
+			t.Fatalf("sync failed: %v", errSync)
+		}
+		// Signed by a committee the store rotated out; it's ignored rather than applied or rejected
+		if errUpdate := client.processUpdate(updates[0]); errUpdate != nil {
+			t.Fatalf("expected stale update to be ignored, got %v", errUpdate)
+		}
+		if client.finalizedHeader.Beacon.Slot != updates[1].FinalizedHeader.Beacon.Slot || !committees[1].is(client.currentSyncCommittee) {
+			t.Error("expected stale update not to change the store")
+		}
+	})
+
+	t.Run("bad finality branch", func(t *testing.T) {
+		tampered := *updates[0]
+		tampered.FinalityBranch = append([]common.Hash{}, updates[0].FinalityBranch...)
+		tampered.FinalityBranch[2] = common.HexToHash("0x02")
+		truncated := *updates[0]
+		truncated.FinalityBranch = updates[0].FinalityBranch[:len(updates[0].FinalityBranch)-1]
+
+		for _, update := range []*lightClientUpdate{&tampered, &truncated} {
+			client := newClient(t, []*lightClientUpdate{update})
+			if errSync := client.sync(); errSync == nil || errSync.Error() != "invalid finality branch" {
+				t.Errorf("expected invalid finality branch, got %v", errSync)
+			}
+			if client.finalizedHeader.Beacon.Slot != bootstrap.Header.Beacon.Slot || client.nextSyncCommittee != nil {
+				t.Error("expected rejected update not to change the store")
+			}
+		}
+	})
+}
+
+func TestFinalizedExecutionBlockWalk(t *testing.T) {
+	// Chain of execution blocks 0 to 40, each committing to the hash of its parent
+	blocks := make([]*executionBlock, 41)
+	parentHash := common.Hash{}
+	for i := range blocks {
+		blocks[i] = &executionBlock{
+			ParentHash: parentHash,
+			LogsBloom:  make([]byte, 256),
+			Difficulty: (*hexutil.Big)(big.NewInt(0)),
+			Number:     (*hexutil.Big)(big.NewInt(int64(i))),
+			ExtraData:  []byte{},
+		}
+		hash, errHash := blocks[i].computeHash()
+		if errHash != nil {
+			t.Fatal(errHash)
+		}
+		blocks[i].Hash = hash
+		parentHash = hash
+	}
+	var calls atomic.Int64
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Id     json.RawMessage `json:"id"`
+			Params []string        `json:"params"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		calls.Add(1)
+		number, _ := hexutil.DecodeUint64(request.Params[0])
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": request.Id, "result": blocks[number]})
+	}))
+	defer node.Close()
+
+	client := newLightClient(&Network{Name: "testnet", BackendEndpoint: node.URL}, nil, 0)
+	finalized := blocks[40]
+	client.finalizedHeader = &lightClientHeader{Execution: &lightClientExecutionHeader{BlockNumber: 40, BlockHash: finalized.Hash, ParentHash: finalized.ParentHash}}
+
+	// Concurrent lookups share the walk; every block is fetched once and a lookup fetches at most maxWalk blocks
+	target := 40 - 2*maxExecutionBlocksPerLookup
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, errLookup := client.isFinalizedExecutionBlock(uint64(target), blocks[target].Hash); errLookup != nil {
+				t.Error(errLookup)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := calls.Load(); count != 2*maxExecutionBlocksPerLookup {
+		t.Errorf("expected %v block fetches, got %v", 2*maxExecutionBlocksPerLookup, count)
+	}
+	if finalized, errLookup := client.isFinalizedExecutionBlock(uint64(target), blocks[target].Hash); errLookup != nil || !finalized {
+		t.Errorf("expected block %v to be verified, got %v (%v)", target, finalized, errLookup)
+	}
+	if finalized, _ := client.isFinalizedExecutionBlock(uint64(target), common.HexToHash("0x01")); finalized {
+		t.Error("expected other hash not to be finalized")
+	}
+}
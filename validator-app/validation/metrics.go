@@ -0,0 +1,89 @@
+package validation
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Backends of BackendCall
+const (
+	BackendBeacon    = "beacon"
+	BackendExecution = "execution"
+	BackendRelay     = "relay"
+)
+
+// Caches of SetCacheObserver
+const (
+	// CacheVerifiedExecutionBlocks holds the execution blocks the light client verified against a finalized header
+	CacheVerifiedExecutionBlocks = "verified_execution_blocks"
+)
+
+// BackendCall describes a completed request to a backend
+type BackendCall struct {
+	Backend string
+	// Endpoint is the path of beacon and relay requests, with identifiers replaced by placeholders, or "json-rpc"
+	Endpoint string
+	// Method is the HTTP method or the JSON-RPC method
+	Method   string
+	Duration time.Duration
+	// Err is set if the request failed; resources which don't exist aren't failures
+	Err error
+}
+
+var (
+	backendObserver atomic.Pointer[func(call BackendCall)]
+	cacheObserver   atomic.Pointer[func(cache string, hit bool)]
+)
+
+// SetBackendObserver registers a function which is called after every backend request, e.g. to record metrics.
+// It replaces the previous observer; nil removes it.
+func SetBackendObserver(observer func(call BackendCall)) {
+	if observer == nil {
+		backendObserver.Store(nil)
+		return
+	}
+	backendObserver.Store(&observer)
+}
+
+// observeBackendCall passes a completed request to the observer
+func observeBackendCall(backend, endpoint, method string, started time.Time, err error) {
+	if observer := backendObserver.Load(); observer != nil {
+		(*observer)(BackendCall{Backend: backend, Endpoint: endpoint, Method: method, Duration: time.Since(started), Err: err})
+	}
+}
+
+// SetCacheObserver registers a function which is called after every cache lookup with its result, e.g. to record the
+// hit ratio. It replaces the previous observer; nil removes it.
+func SetCacheObserver(observer func(cache string, hit bool)) {
+	if observer == nil {
+		cacheObserver.Store(nil)
+		return
+	}
+	cacheObserver.Store(&observer)
+}
+
+// observeCacheLookup passes the result of a cache lookup to the observer
+func observeCacheLookup(cache string, hit bool) {
+	if observer := cacheObserver.Load(); observer != nil {
+		(*observer)(cache, hit)
+	}
+}
+
+// backendEndpoint returns the path of a request URL with slots, indices, roots and pubkeys replaced by {id},
+// so requests of the same endpoint are grouped
+func backendEndpoint(requestURL string) string {
+	path := requestURL
+	if parsed, errParse := url.Parse(requestURL); errParse == nil {
+		path = parsed.Path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if _, errNumber := strconv.ParseUint(segment, 10, 64); errNumber == nil || strings.HasPrefix(segment, "0x") {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,62 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBackendEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"/eth/v2/beacon/blocks/9000000":                     "/eth/v2/beacon/blocks/{id}",
+		"/eth/v1/beacon/headers/head":                       "/eth/v1/beacon/headers/head",
+		"/eth/v1/beacon/states/100/validators?id=1,2,3":     "/eth/v1/beacon/states/{id}/validators",
+		"/eth/v1/beacon/light_client/bootstrap/0xabcdef":    "/eth/v1/beacon/light_client/bootstrap/{id}",
+		"https://relay.example/relay/v1/data/bidtraces?x=1": "/relay/v1/data/bidtraces",
+	}
+	for requestURL, expected := range tests {
+		if endpoint := backendEndpoint(requestURL); endpoint != expected {
+			t.Errorf("expected %v to be grouped as %v, got %v", requestURL, expected, endpoint)
+		}
+	}
+}
+
+func TestBackendObserver(t *testing.T) {
+	calls := make([]BackendCall, 0)
+	SetBackendObserver(func(call BackendCall) { calls = append(calls, call) })
+	defer SetBackendObserver(nil)
+
+	network := &Network{Name: "testnet", BackendEndpoint: "http://127.0.0.1:1"}
+	if _, _, errGet := beaconGetRaw(network, "/eth/v1/beacon/headers/123"); errGet == nil {
+		t.Fatal("expected request to an unreachable backend to fail")
+	}
+	if len(calls) != 1 || calls[0].Backend != BackendBeacon || calls[0].Endpoint != "/eth/v1/beacon/headers/{id}" || calls[0].Method != "GET" || calls[0].Err == nil {
+		t.Errorf("expected failed beacon call to be observed, got %+v", calls)
+	}
+	if errors.Is(calls[0].Err, errSlotDoesNotExist) {
+		t.Error("expected backend failure, not a missing slot")
+	}
+}
+
+func TestCacheObserver(t *testing.T) {
+	lookups := make(map[bool]int)
+	SetCacheObserver(func(cache string, hit bool) {
+		if cache == CacheVerifiedExecutionBlocks {
+			lookups[hit]++
+		}
+	})
+	defer SetCacheObserver(nil)
+
+	client := newLightClient(&Network{Name: "testnet", BackendEndpoint: "http://127.0.0.1:1"}, nil, 0)
+	client.finalizedHeader = &lightClientHeader{Execution: &lightClientExecutionHeader{BlockNumber: 100}}
+
+	// The finalized block is verified; older blocks have to be fetched from the backend
+	if _, errLookup := client.isFinalizedExecutionBlock(100, client.finalizedHeader.Execution.BlockHash); errLookup != nil {
+		t.Fatal(errLookup)
+	}
+	if _, errLookup := client.isFinalizedExecutionBlock(99, client.finalizedHeader.Execution.ParentHash); errLookup == nil {
+		t.Fatal("expected lookup with an unreachable backend to fail")
+	}
+	if lookups[true] != 1 || lookups[false] != 1 {
+		t.Errorf("expected one hit and one miss, got %v", lookups)
+	}
+}
@@ -0,0 +1,297 @@
+package validation
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/chenzhijie/go-web3/rpc"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ErrUnknownNetwork = "unknown network"
+
+	// SyncCommitteeSize is the same for all networks using the mainnet preset
+	SyncCommitteeSize = 512
+)
+
+// ForkVersion describes a fork of the beacon chain and the epoch it got activated at
+type ForkVersion struct {
+	Name    string
+	Epoch   uint64
+	Version [4]byte
+}
+
+// Network is the profile of an Ethereum network; all slot math is based on it
+type Network struct {
+	// Name is the identifier of the network used in requests and config keys
+	Name string
+	// ChainId is the chain id of the execution layer
+	ChainId uint64
+	// GenesisTime is the unix timestamp of slot 0
+	GenesisTime uint64
+	// GenesisValidatorsRoot is part of every signing domain
+	GenesisValidatorsRoot [32]byte
+	// Spec constants
+	SecondsPerSlot               uint64
+	SlotsPerEpoch                uint64
+	EpochsPerSyncCommitteePeriod uint64
+	// Forks is the fork schedule, ordered by activation epoch
+	Forks []ForkVersion
+	// Backend endpoints
+	BackendEndpoint string
+	BackendToken    string
+	MEVRelays       []string
+	// BackendTimeout limits beacon node and relay requests; defaults to 10s
+	BackendTimeout time.Duration
+	// BackendUseWebsocket connects to the execution backend via websocket
+	BackendUseWebsocket bool
+
+	// Backend clients and light client of this network
+	rpcClient         *rpc.Client
+	httpClient        *http.Client
+	lightClientConfig LightClientConfig
+	lightClient       *lightClient
+	clientMtx         sync.Mutex
+}
+
+// Config configures the backends and light clients of the networks, see NewNetworks
+type Config struct {
+	// DefaultNetwork is used if a request doesn't name a network; defaults to mainnet
+	DefaultNetwork string
+	// Networks configure the networks by name; networks without entry have no backend
+	Networks map[string]NetworkConfig
+}
+
+// NetworkConfig configures the backend and light client of a network
+type NetworkConfig struct {
+	BackendEndpoint     string
+	BackendToken        string
+	BackendTimeout      time.Duration
+	BackendUseWebsocket bool
+	// MEVRelays replace the built-in relays of the network if set
+	MEVRelays   []string
+	LightClient LightClientConfig
+}
+
+// Networks are the profiles of all supported networks with their backend configuration
+type Networks struct {
+	defaultName string
+	byName      map[string]*Network
+}
+
+var (
+	envNetworks *Networks
+	networksMtx sync.Mutex
+)
+
+// builtinNetworks returns the profiles of all supported networks without backend configuration
+func builtinNetworks() []*Network {
+	return []*Network{
+		{
+			Name:                         "mainnet",
+			ChainId:                      1,
+			GenesisTime:                  1606824023,
+			GenesisValidatorsRoot:        mustDecodeRoot("4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95"),
+			SecondsPerSlot:               12,
+			SlotsPerEpoch:                32,
+			EpochsPerSyncCommitteePeriod: 256,
+			Forks: []ForkVersion{
+				{Name: "phase0", Epoch: 0, Version: [4]byte{0x00, 0x00, 0x00, 0x00}},
+				{Name: "altair", Epoch: 74240, Version: [4]byte{0x01, 0x00, 0x00, 0x00}},
+				{Name: "bellatrix", Epoch: 144896, Version: [4]byte{0x02, 0x00, 0x00, 0x00}},
+				{Name: "capella", Epoch: 194048, Version: [4]byte{0x03, 0x00, 0x00, 0x00}},
+				{Name: "deneb", Epoch: 269568, Version: [4]byte{0x04, 0x00, 0x00, 0x00}},
+				{Name: "electra", Epoch: 364032, Version: [4]byte{0x05, 0x00, 0x00, 0x00}},
+			},
+			MEVRelays: []string{
+				"https://boost-relay.flashbots.net",
+				"https://bloxroute.max-profit.blxrbdn.com",
+				"https://bloxroute.regulated.blxrbdn.com",
+				"https://relay.ultrasound.money",
+				"https://agnostic-relay.net",
+				"https://aestus.live",
+				"https://mainnet-relay.securerpc.com",
+				"https://relay.edennetwork.io",
+			},
+		},
+		{
+			Name:                         "holesky",
+			ChainId:                      17000,
+			GenesisTime:                  1695902400,
+			GenesisValidatorsRoot:        mustDecodeRoot("9143aa7c615a7f7115e2b6aac319c03529df8242ae705fba9df39b79c59fa8b1"),
+			SecondsPerSlot:               12,
+			SlotsPerEpoch:                32,
+			EpochsPerSyncCommitteePeriod: 256,
+			Forks: []ForkVersion{
+				{Name: "phase0", Epoch: 0, Version: [4]byte{0x01, 0x01, 0x70, 0x00}},
+				{Name: "altair", Epoch: 0, Version: [4]byte{0x02, 0x01, 0x70, 0x00}},
+				{Name: "bellatrix", Epoch: 0, Version: [4]byte{0x03, 0x01, 0x70, 0x00}},
+				{Name: "capella", Epoch: 256, Version: [4]byte{0x04, 0x01, 0x70, 0x00}},
+				{Name: "deneb", Epoch: 29696, Version: [4]byte{0x05, 0x01, 0x70, 0x00}},
+				{Name: "electra", Epoch: 115968, Version: [4]byte{0x06, 0x01, 0x70, 0x00}},
+			},
+			MEVRelays: []string{
+				"https://boost-relay-holesky.flashbots.net",
+				"https://bloxroute.holesky.blxrbdn.com",
+				"https://holesky.aestus.live",
+			},
+		},
+		{
+			Name:                         "sepolia",
+			ChainId:                      11155111,
+			GenesisTime:                  1655733600,
+			GenesisValidatorsRoot:        mustDecodeRoot("d8ea171f3c94aea21ebc42a1ed61052acf3f9209c00e4efbaaddac09ed9b8078"),
+			SecondsPerSlot:               12,
+			SlotsPerEpoch:                32,
+			EpochsPerSyncCommitteePeriod: 256,
+			Forks: []ForkVersion{
+				{Name: "phase0", Epoch: 0, Version: [4]byte{0x90, 0x00, 0x00, 0x69}},
+				{Name: "altair", Epoch: 50, Version: [4]byte{0x90, 0x00, 0x00, 0x70}},
+				{Name: "bellatrix", Epoch: 100, Version: [4]byte{0x90, 0x00, 0x00, 0x71}},
+				{Name: "capella", Epoch: 56832, Version: [4]byte{0x90, 0x00, 0x00, 0x72}},
+				{Name: "deneb", Epoch: 132608, Version: [4]byte{0x90, 0x00, 0x00, 0x73}},
+				{Name: "electra", Epoch: 222464, Version: [4]byte{0x90, 0x00, 0x00, 0x74}},
+			},
+			MEVRelays: []string{
+				"https://boost-relay-sepolia.flashbots.net",
+			},
+		},
+	}
+}
+
+// NewNetworks creates the profiles of all supported networks with the given configuration
+func NewNetworks(config Config) (*Networks, error) {
+	result := &Networks{
+		defaultName: strings.ToLower(config.DefaultNetwork),
+		byName:      make(map[string]*Network),
+	}
+	if len(result.defaultName) == 0 {
+		result.defaultName = "mainnet"
+	}
+	for _, network := range builtinNetworks() {
+		result.byName[network.Name] = network
+	}
+	for name, networkConfig := range config.Networks {
+		network, ok := result.byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("%v: %v", ErrUnknownNetwork, name)
+		}
+		network.BackendEndpoint = networkConfig.BackendEndpoint
+		network.BackendToken = networkConfig.BackendToken
+		network.BackendTimeout = networkConfig.BackendTimeout
+		network.BackendUseWebsocket = networkConfig.BackendUseWebsocket
+		if len(networkConfig.MEVRelays) > 0 {
+			network.MEVRelays = networkConfig.MEVRelays
+		}
+		network.lightClientConfig = networkConfig.LightClient
+	}
+	return result, nil
+}
+
+// Get returns the profile of the network with the given name
+func (n *Networks) Get(name string) (*Network, error) {
+	network, ok := n.byName[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%v: %v", ErrUnknownNetwork, name)
+	}
+	return network, nil
+}
+
+// Default returns the profile of the default network
+func (n *Networks) Default() (*Network, error) {
+	return n.Get(n.defaultName)
+}
+
+// All returns the profiles of all supported networks
+func (n *Networks) All() []*Network {
+	result := make([]*Network, 0, len(n.byName))
+	for _, network := range builtinNetworks() {
+		result = append(result, n.byName[network.Name])
+	}
+	return result
+}
+
+// EnvNetworks returns the networks configured by the environment, see ConfigFromEnv
+func EnvNetworks() *Networks {
+	networksMtx.Lock()
+	defer networksMtx.Unlock()
+	if envNetworks == nil {
+		// The environment only configures built-in networks
+		envNetworks, _ = NewNetworks(ConfigFromEnv())
+	}
+	return envNetworks
+}
+
+// GetNetwork returns the profile of the network with the given name, as configured by the environment
+func GetNetwork(name string) (*Network, error) {
+	return EnvNetworks().Get(name)
+}
+
+// GetDefaultNetwork returns the profile of the network configured by NETWORK, mainnet if unset
+func GetDefaultNetwork() (*Network, error) {
+	return EnvNetworks().Default()
+}
+
+// GetNetworks returns the profiles of all supported networks, as configured by the environment
+func GetNetworks() []*Network {
+	return EnvNetworks().All()
+}
+
+// IsConfigured returns true if a backend endpoint is configured for the network
+func (n *Network) IsConfigured() bool {
+	return len(n.BackendEndpoint) > 0
+}
+
+// EpochAtSlot returns the epoch the slot belongs to
+func (n *Network) EpochAtSlot(slot uint64) uint64 {
+	return slot / n.SlotsPerEpoch
+}
+
+// SyncPeriodAtSlot returns the sync committee period the slot belongs to
+func (n *Network) SyncPeriodAtSlot(slot uint64) uint64 {
+	return n.EpochAtSlot(slot) / n.EpochsPerSyncCommitteePeriod
+}
+
+// ForkAtEpoch returns the fork active at the given epoch
+func (n *Network) ForkAtEpoch(epoch uint64) ForkVersion {
+	active := n.Forks[0]
+	for _, fork := range n.Forks {
+		if fork.Epoch <= epoch {
+			active = fork
+		}
+	}
+	return active
+}
+
+// CurrentSlot returns the slot of the network's wall clock
+func (n *Network) CurrentSlot() uint64 {
+	now := uint64(time.Now().Unix())
+	if now < n.GenesisTime {
+		return 0
+	}
+	return (now - n.GenesisTime) / n.SecondsPerSlot
+}
+
+func splitList(value string) []string {
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), "/")
+		if len(entry) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func mustDecodeRoot(value string) [32]byte {
+	var root [32]byte
+	decoded, err := hex.DecodeString(value)
+	if err != nil || len(decoded) != 32 {
+		panic("invalid root: " + value)
+	}
+	copy(root[:], decoded)
+	return root
+}
@@ -0,0 +1,128 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// rangeSlotAttempts is the number of attempts a slot of a range gets before the range fails
+	rangeSlotAttempts = 3
+	// rangeWindowPerWorker limits the slots computed ahead of the slowest one
+	rangeWindowPerWorker = 4
+)
+
+// ForEachBlockReward computes the block rewards of the slots from to to (inclusive) with concurrent workers and passes
+// them to fn in slot order; missed slots are passed with a nil reward. Backend failures are retried before the range fails.
+// It stops at the first failing slot, error of fn or when the context is done; all slots passed to fn before are
+// complete, so the range can be resumed after the last of them.
+func ForEachBlockReward(ctx context.Context, network *Network, from, to uint64, workers int, fn func(slot uint64, reward *BlockRewardSlot) error) error {
+	return forEachSlot(ctx, from, to, workers, func(ctx context.Context, slot uint64) (*BlockRewardSlot, error) {
+		var lastErr error
+		for attempt := 0; attempt < rangeSlotAttempts; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(attempt) * time.Second):
+				}
+			}
+			reward, errReward := GetBlockRewardSlot(network, slot)
+			if IsSlotDoesNotExist(errReward) {
+				return nil, nil
+			} else if errReward == nil || IsSlotInFuture(errReward) {
+				return reward, errReward
+			}
+			lastErr = errReward
+		}
+		return nil, lastErr
+	}, fn)
+}
+
+// forEachSlot fetches the slots with concurrent workers and passes the results to fn in slot order
+func forEachSlot[T any](ctx context.Context, from, to uint64, workers int, fetch func(ctx context.Context, slot uint64) (T, error), fn func(slot uint64, value T) error) error {
+	if to < from {
+		return fmt.Errorf("invalid slot range %v-%v", from, to)
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type slotResult struct {
+		slot  uint64
+		value T
+		err   error
+	}
+	slots := make(chan uint64)
+	results := make(chan slotResult)
+	// Slots are only handed out within the window, so a slow slot doesn't pile up results behind it
+	window := make(chan struct{}, workers*rangeWindowPerWorker)
+
+	go func() {
+		defer close(slots)
+		for slot := from; ; slot++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case slots <- slot:
+			case <-ctx.Done():
+				return
+			}
+			if slot == to {
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slot := range slots {
+				value, errFetch := fetch(ctx, slot)
+				select {
+				case results <- slotResult{slot: slot, value: value, err: errFetch}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Pass results on in order
+	pending := make(map[uint64]slotResult)
+	next := from
+	for result := range results {
+		pending[result.slot] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			<-window
+			if ready.err != nil {
+				return fmt.Errorf("slot %v: %w", next, ready.err)
+			}
+			if errFn := fn(next, ready.value); errFn != nil {
+				return errFn
+			}
+			if next == to {
+				return nil
+			}
+			next++
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestForEachSlot(t *testing.T) {
+	// Later slots complete first; results are passed on in order anyway
+	fetch := func(ctx context.Context, slot uint64) (uint64, error) {
+		time.Sleep(time.Duration(20-slot) * time.Millisecond)
+		if slot == 15 {
+			return 0, errors.New("backend failed")
+		}
+		return slot * 2, nil
+	}
+	passed := make([]uint64, 0)
+	errRange := forEachSlot(context.Background(), 10, 14, 4, fetch, func(slot uint64, value uint64) error {
+		if value != slot*2 {
+			t.Errorf("expected value of slot %v, got %v", slot, value)
+		}
+		passed = append(passed, slot)
+		return nil
+	})
+	if errRange != nil || len(passed) != 5 {
+		t.Fatalf("expected all slots, got %v (%v)", passed, errRange)
+	}
+	for i, slot := range passed {
+		if slot != uint64(10+i) {
+			t.Fatalf("expected slots in order, got %v", passed)
+		}
+	}
+
+	// The range stops at the failing slot; all slots before it are passed
+	passed = passed[:0]
+	errRange = forEachSlot(context.Background(), 12, 18, 3, fetch, func(slot uint64, value uint64) error {
+		passed = append(passed, slot)
+		return nil
+	})
+	if errRange == nil || len(passed) != 3 || passed[2] != 14 {
+		t.Errorf("expected range to fail after slot 14, got %v (%v)", passed, errRange)
+	}
+}
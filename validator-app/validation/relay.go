@@ -1,27 +1,108 @@
 package validation
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/metachris/flashbotsrpc"
-	"github.com/spf13/viper"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
-var mev2RelayBackendClient *flashbotsrpc.FlashbotsRPC
+const ErrRelaysUnavailable = "mev relays unavailable"
 
-func getMEV2RelayBackendClient() (*flashbotsrpc.FlashbotsRPC, error) {
-	// Return if already initialized
-	if mev2RelayBackendClient != nil {
-		return mev2RelayBackendClient, nil
+var errRelaysUnavailable = errors.New(ErrRelaysUnavailable)
+
+// relayBidTrace describes a payload delivered by a MEV-Boost relay
+type relayBidTrace struct {
+	Slot                 uint64 `json:"slot,string"`
+	BlockHash            string `json:"block_hash"`
+	BuilderPubkey        string `json:"builder_pubkey"`
+	ProposerFeeRecipient string `json:"proposer_fee_recipient"`
+	Value                string `json:"value"`
+}
+
+// getRelayDeliveredPayload asks the configured relays whether they delivered the payload with the given block hash.
+// It returns nil if no relay delivered the payload, i.e. the block was built locally; otherwise it returns the names
+// of all relays which delivered it, since builders submit the same block to several relays.
+func getRelayDeliveredPayload(network *Network, slot uint64, blockHash string) (*relayBidTrace, []string, error) {
+	var lastErr error
+	var delivered *relayBidTrace
+	relays := make([]string, 0)
+	answered := 0
+	for _, relay := range network.MEVRelays {
+		requestURL := fmt.Sprintf("%s/relay/v1/data/bidtraces/proposer_payload_delivered?slot=%v", relay, slot)
+		started := time.Now()
+		traces, errTraces := getRelayBidTraces(network, requestURL)
+		observeBackendCall(BackendRelay, relayName(relay)+backendEndpoint(requestURL), http.MethodGet, started, errTraces)
+		if errTraces != nil {
+			lastErr = errTraces
+			continue
+		}
+		answered++
+		for i, trace := range traces {
+			if trace.Slot == slot && strings.EqualFold(trace.BlockHash, blockHash) {
+				if delivered == nil {
+					delivered = &traces[i]
+				}
+				relays = append(relays, relayName(relay))
+				break
+			}
+		}
+	}
+	if delivered != nil {
+		return delivered, relays, nil
+	}
+	// A relay which didn't answer may have delivered the block, so it's only vanilla if all relays answered
+	if lastErr != nil {
+		return nil, nil, fmt.Errorf("%w: %v of %v relays failed: %v", errRelaysUnavailable, len(network.MEVRelays)-answered, len(network.MEVRelays), lastErr)
 	}
+	return nil, nil, nil
+}
+
+// IsRelaysUnavailable returns true if the MEV status of a block is unknown because a relay couldn't be queried
+func IsRelaysUnavailable(err error) bool {
+	return errors.Is(err, errRelaysUnavailable)
+}
 
-	// Build Endpoint URL
-	rpcProviderURL := viper.GetString("BACKEND_ENDPOINT")
-	rpcProviderToken := viper.GetString("BACKEND_TOKEN")
-	rpcFullURL := fmt.Sprintf("%s/%s", rpcProviderURL, rpcProviderToken)
+// relayName returns the host of a relay URL, which identifies the relay
+func relayName(relay string) string {
+	relayURL, errURL := url.Parse(relay)
+	if errURL != nil || len(relayURL.Host) == 0 {
+		return relay
+	}
+	return relayURL.Host
+}
+
+func getRelayBidTraces(network *Network, requestURL string) ([]relayBidTrace, error) {
+	response, errGet := getBeaconHttpClient(network).Get(requestURL)
+	if errGet != nil {
+		return nil, errGet
+	}
+	defer response.Body.Close()
+
+	body, errRead := io.ReadAll(response.Body)
+	if errRead != nil {
+		return nil, errRead
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("relay request '%v' failed with status %v", requestURL, response.StatusCode)
+	}
+	traces := make([]relayBidTrace, 0)
+	if errDecode := json.Unmarshal(body, &traces); errDecode != nil {
+		return nil, errDecode
+	}
+	return traces, nil
+}
 
-	mev2RelayBackendClient = flashbotsrpc.New(rpcFullURL)
-	if mev2RelayBackendClient == nil {
-		return nil, fmt.Errorf("failed to create RPC client for '%s'", rpcFullURL)
+// bidValueWei parses the decimal wei value of a bid trace
+func (t *relayBidTrace) bidValueWei() (*big.Int, error) {
+	value, ok := new(big.Int).SetString(t.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid bid value: %v", t.Value)
 	}
-	return mev2RelayBackendClient, nil
+	return value, nil
 }
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestRelay serves the given bid traces, or fails if status isn't 200
+func newTestRelay(t *testing.T, status int, traces string) string {
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, traces)
+	}))
+	t.Cleanup(relay.Close)
+	return relay.URL
+}
+
+func TestGetRelayDeliveredPayload(t *testing.T) {
+	const blockHash = "0xabc"
+	delivered := `[{"slot":"7","block_hash":"0xABC","proposer_fee_recipient":"0x1","value":"1000000000"}]`
+	notDelivered := `[]`
+
+	// All relays answered without the block; it's vanilla
+	network := &Network{MEVRelays: []string{newTestRelay(t, 200, notDelivered), newTestRelay(t, 200, notDelivered)}}
+	if trace, _, errTrace := getRelayDeliveredPayload(network, 7, blockHash); trace != nil || errTrace != nil {
+		t.Errorf("expected vanilla block, got %+v (%v)", trace, errTrace)
+	}
+
+	// A relay which failed may have delivered the block
+	network = &Network{MEVRelays: []string{newTestRelay(t, 500, ""), newTestRelay(t, 200, notDelivered)}}
+	if trace, _, errTrace := getRelayDeliveredPayload(network, 7, blockHash); trace != nil || !IsRelaysUnavailable(errTrace) {
+		t.Errorf("expected unknown status while a relay is down, got %+v (%v)", trace, errTrace)
+	}
+
+	// A delivery is known regardless of failed relays
+	network = &Network{MEVRelays: []string{newTestRelay(t, 500, ""), newTestRelay(t, 200, delivered)}}
+	trace, relays, errTrace := getRelayDeliveredPayload(network, 7, blockHash)
+	if trace == nil || errTrace != nil || len(relays) != 1 {
+		t.Errorf("expected block delivered by one relay, got %+v %v (%v)", trace, relays, errTrace)
+	}
+}
@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// This file contains the subset of SSZ merkleization required to verify light client data.
+
+var zeroHashes = buildZeroHashes(64)
+
+func buildZeroHashes(depth int) [][32]byte {
+	hashes := make([][32]byte, depth+1)
+	for i := 1; i <= depth; i++ {
+		hashes[i] = hashPair(hashes[i-1], hashes[i-1])
+	}
+	return hashes
+}
+
+func hashPair(a, b [32]byte) [32]byte {
+	return sha256.Sum256(append(a[:], b[:]...))
+}
+
+// merkleize returns the root of the chunks, padded with zero chunks to the next power of two of limit
+func merkleize(chunks [][32]byte, limit int) [32]byte {
+	if limit < len(chunks) {
+		limit = len(chunks)
+	}
+	depth := 0
+	for (1 << depth) < limit {
+		depth++
+	}
+	if len(chunks) == 0 {
+		return zeroHashes[depth]
+	}
+
+	layer := chunks
+	for level := 0; level < depth; level++ {
+		next := make([][32]byte, (len(layer)+1)/2)
+		for i := range next {
+			right := zeroHashes[level]
+			if 2*i+1 < len(layer) {
+				right = layer[2*i+1]
+			}
+			next[i] = hashPair(layer[2*i], right)
+		}
+		layer = next
+	}
+	return layer[0]
+}
+
+// mixInLength returns the root of a list with the given length
+func mixInLength(root [32]byte, length uint64) [32]byte {
+	return hashPair(root, uint64Root(length))
+}
+
+// packBytes splits the value into zero padded 32 byte chunks
+func packBytes(value []byte) [][32]byte {
+	chunks := make([][32]byte, (len(value)+31)/32)
+	for i := range chunks {
+		copy(chunks[i][:], value[i*32:])
+	}
+	return chunks
+}
+
+// bytesRoot returns the root of a fixed size byte vector
+func bytesRoot(value []byte) [32]byte {
+	return merkleize(packBytes(value), 0)
+}
+
+// byteListRoot returns the root of a byte list with the given maximum length
+func byteListRoot(value []byte, maxLength int) [32]byte {
+	return mixInLength(merkleize(packBytes(value), (maxLength+31)/32), uint64(len(value)))
+}
+
+func uint64Root(value uint64) [32]byte {
+	var root [32]byte
+	binary.LittleEndian.PutUint64(root[:8], value)
+	return root
+}
+
+func uint256Root(value *big.Int) [32]byte {
+	var root [32]byte
+	bigEndian := value.Bytes()
+	for i := 0; i < len(bigEndian) && i < 32; i++ {
+		root[i] = bigEndian[len(bigEndian)-1-i]
+	}
+	return root
+}
+
+// isValidMerkleBranch verifies the leaf is part of the tree with the given root at the given generalized index.
+// The branch has to contain exactly one sibling per level above the leaf.
+func isValidMerkleBranch(leaf [32]byte, branch [][32]byte, gindex uint64, root [32]byte) bool {
+	if len(branch) != bits.Len64(gindex)-1 {
+		return false
+	}
+	value := leaf
+	for i, sibling := range branch {
+		if (gindex>>uint(i))&1 == 1 {
+			value = hashPair(sibling, value)
+		} else {
+			value = hashPair(value, sibling)
+		}
+	}
+	return value == root
+}
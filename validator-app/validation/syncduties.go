@@ -1,10 +1,43 @@
 package validation
 
+import "strconv"
+
 type SyncDutiesResponse struct {
+	// Slot is the slot the sync duties belong to; named identifiers and timestamps are resolved to it.
+	Slot uint64
 	// PublicValidatorKeys is a list of public keys of validators that had sync committee duties for the specified slot.
 	PublicValidatorKeys []string
 }
 
-func GetSyncDuties(slot uint64) (*SyncDutiesResponse, error) {
+func GetSyncDuties(network *Network, slot uint64) (*SyncDutiesResponse, error) {
+	// Ensure it's not in the future
+	if errReached := checkSlotReached(network, slot); errReached != nil {
+		return nil, errReached
+	}
+
+	// Get the validator indices of the sync committee
+	indices, errCommittee := getBeaconSyncCommittee(network, slot)
+	if errCommittee != nil {
+		return nil, errCommittee
+	}
 
+	// Resolve the indices to public keys, keeping the committee order
+	validators, errValidators := getBeaconValidators(network, slot, indices)
+	if errValidators != nil {
+		return nil, errValidators
+	}
+	pubkeys := make(map[string]string, len(validators))
+	for _, validator := range validators {
+		pubkeys[strconv.FormatUint(validator.Index, 10)] = validator.Validator.Pubkey
+	}
+	response := &SyncDutiesResponse{
+		Slot:                slot,
+		PublicValidatorKeys: make([]string, 0, len(indices)),
+	}
+	for _, index := range indices {
+		if pubkey, ok := pubkeys[index]; ok {
+			response.PublicValidatorKeys = append(response.PublicValidatorKeys, pubkey)
+		}
+	}
+	return response, nil
 }
@@ -0,0 +1,86 @@
+package validation
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	ErrTimeBeforeGenesis = "time is before genesis"
+	ErrSlotOutOfRange    = "slot is out of range"
+)
+
+var (
+	errTimeBeforeGenesis = errors.New(ErrTimeBeforeGenesis)
+	errSlotOutOfRange    = errors.New(ErrSlotOutOfRange)
+)
+
+type SlotTimeResponse struct {
+	// Slot is the slot number
+	Slot uint64 `json:"slot"`
+	// Timestamp is the unix timestamp the slot starts at
+	Timestamp uint64 `json:"timestamp"`
+	// Time is the start of the slot in RFC 3339 format (UTC)
+	Time string `json:"time"`
+	// Epoch is the epoch the slot belongs to
+	Epoch uint64 `json:"epoch"`
+	// SyncPeriod is the sync committee period the slot belongs to
+	SyncPeriod uint64 `json:"sync_period"`
+	// Fork is the name of the fork active in the slot
+	Fork string `json:"fork"`
+}
+
+// IsTimeBeforeGenesis returns true if the error was caused by a time before the network's genesis
+func IsTimeBeforeGenesis(err error) bool {
+	return errors.Is(err, errTimeBeforeGenesis)
+}
+
+// IsSlotOutOfRange returns true if the error was caused by a slot whose start can't be represented as unix timestamp
+func IsSlotOutOfRange(err error) bool {
+	return errors.Is(err, errSlotOutOfRange)
+}
+
+// MaxSlot returns the last slot whose start can be represented as signed unix timestamp
+func (n *Network) MaxSlot() uint64 {
+	return (math.MaxInt64 - n.GenesisTime) / n.SecondsPerSlot
+}
+
+// SlotTimestamp returns the unix timestamp the slot starts at; it overflows for slots above MaxSlot
+func (n *Network) SlotTimestamp(slot uint64) uint64 {
+	return n.GenesisTime + slot*n.SecondsPerSlot
+}
+
+// SlotAtTimestamp returns the slot active at the given unix timestamp
+func (n *Network) SlotAtTimestamp(timestamp int64) (uint64, error) {
+	if timestamp < 0 || uint64(timestamp) < n.GenesisTime {
+		return 0, errTimeBeforeGenesis
+	}
+	return (uint64(timestamp) - n.GenesisTime) / n.SecondsPerSlot, nil
+}
+
+// GetSlotTime returns time, epoch, sync period and fork of the slot
+func GetSlotTime(network *Network, slot uint64) (*SlotTimeResponse, error) {
+	if slot > network.MaxSlot() {
+		return nil, errSlotOutOfRange
+	}
+	epoch := network.EpochAtSlot(slot)
+	timestamp := network.SlotTimestamp(slot)
+	return &SlotTimeResponse{
+		Slot:       slot,
+		Timestamp:  timestamp,
+		Time:       time.Unix(int64(timestamp), 0).UTC().Format(time.RFC3339),
+		Epoch:      epoch,
+		SyncPeriod: network.SyncPeriodAtSlot(slot),
+		Fork:       network.ForkAtEpoch(epoch).Name,
+	}, nil
+}
+
+// GetSlotAtTime returns the slot active at the given unix timestamp
+func GetSlotAtTime(network *Network, timestamp int64) (*SlotTimeResponse, error) {
+	slot, errSlot := network.SlotAtTimestamp(timestamp)
+	if errSlot != nil {
+		return nil, errSlot
+	}
+	return GetSlotTime(network, slot)
+}
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSlotTimeConversion(t *testing.T) {
+	network, errNetwork := GetNetwork("mainnet")
+	if errNetwork != nil {
+		t.Fatal(errNetwork)
+	}
+
+	// First slot of Deneb on mainnet
+	slotTime, errSlotTime := GetSlotTime(network, 8626176)
+	if errSlotTime != nil {
+		t.Fatal(errSlotTime)
+	}
+	if slotTime.Timestamp != 1710338135 || slotTime.Epoch != 269568 || slotTime.SyncPeriod != 1053 || slotTime.Fork != "deneb" {
+		t.Errorf("unexpected slot time: %+v", slotTime)
+	}
+	if slotTime.Time != "2024-03-13T13:55:35Z" {
+		t.Errorf("unexpected time: %v", slotTime.Time)
+	}
+
+	// Any time within the slot resolves to the slot
+	slot, errSlot := network.SlotAtTimestamp(1710338135 + 11)
+	if errSlot != nil || slot != 8626176 {
+		t.Errorf("expected slot 8626176, got %v (%v)", slot, errSlot)
+	}
+	if _, errSlot = network.SlotAtTimestamp(int64(network.GenesisTime) - 1); !IsTimeBeforeGenesis(errSlot) {
+		t.Errorf("expected time before genesis error, got %v", errSlot)
+	}
+
+	// Slots starting after the largest unix timestamp are rejected instead of overflowing
+	maxSlot := network.MaxSlot()
+	if slotTime, errSlotTime = GetSlotTime(network, maxSlot); errSlotTime != nil || slotTime.Timestamp > math.MaxInt64 || slotTime.Timestamp < network.GenesisTime {
+		t.Errorf("expected last slot to be valid, got %+v (%v)", slotTime, errSlotTime)
+	}
+	for _, slot := range []uint64{maxSlot + 1, math.MaxUint64} {
+		if _, errSlotTime = GetSlotTime(network, slot); !IsSlotOutOfRange(errSlotTime) {
+			t.Errorf("expected slot %v to be out of range, got %v", slot, errSlotTime)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	blst "github.com/supranational/blst/bindings/go"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DomainValidatorProof is the domain type of ownership proofs. It's an application domain
+	// (lowest bit of the last byte set), so a proof can never be replayed as a consensus message.
+	DomainValidatorProof = [4]byte{0x45, 0x56, 0x00, 0x01}
+
+	errInvalidValidatorProof = errors.New("invalid validator proof")
+)
+
+// ValidatorStatus is the current state of a validator on the beacon chain
+type ValidatorStatus struct {
+	Index                 uint64 `json:"index"`
+	Pubkey                string `json:"pubkey"`
+	Status                string `json:"status"`
+	Balance               uint64 `json:"balance"`
+	EffectiveBalance      uint64 `json:"effective_balance"`
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+	Slashed               bool   `json:"slashed"`
+	ActivationEpoch       uint64 `json:"activation_epoch"`
+	ExitEpoch             uint64 `json:"exit_epoch"`
+}
+
+// ValidatorProofSigningRoot returns the root a validator signs to prove ownership of its key for the challenge.
+// The domain is bound to the genesis of the network, so proofs are only valid on a single network.
+func ValidatorProofSigningRoot(network *Network, challenge [32]byte) [32]byte {
+	domain := computeDomain(DomainValidatorProof, network.Forks[0].Version, network.GenesisValidatorsRoot)
+	return merkleize([][32]byte{challenge, domain}, 2)
+}
+
+// VerifyValidatorProof checks the BLS signature of the challenge against the validator pubkey
+func VerifyValidatorProof(network *Network, pubkey, signature string, challenge [32]byte) error {
+	pubkeyBytes, errPubkey := hexutil.Decode(pubkey)
+	signatureBytes, errSignature := hexutil.Decode(signature)
+	if errPubkey != nil || errSignature != nil {
+		return errInvalidValidatorProof
+	}
+	publicKey := new(blst.P1Affine).Uncompress(pubkeyBytes)
+	if publicKey == nil || !publicKey.KeyValidate() {
+		return fmt.Errorf("%v: invalid pubkey", errInvalidValidatorProof)
+	}
+	blsSignature := new(blst.P2Affine).Uncompress(signatureBytes)
+	if blsSignature == nil {
+		return fmt.Errorf("%v: invalid signature encoding", errInvalidValidatorProof)
+	}
+	signingRoot := ValidatorProofSigningRoot(network, challenge)
+	if !blsSignature.Verify(true, publicKey, false, signingRoot[:], blsSignatureDST) {
+		return fmt.Errorf("%v: signature mismatch for %v", errInvalidValidatorProof, pubkey)
+	}
+	return nil
+}
+
+// GetValidatorStatuses returns the current state of the validators identified by pubkey or index.
+// Validators unknown to the beacon chain are omitted.
+func GetValidatorStatuses(network *Network, ids []string) ([]ValidatorStatus, error) {
+	headSlot, errHead := ResolveBlockID(network, "head")
+	if errHead != nil {
+		return nil, errHead
+	}
+	validators, errValidators := getBeaconValidators(network, headSlot, ids)
+	if errValidators != nil {
+		return nil, errValidators
+	}
+	statuses := make([]ValidatorStatus, len(validators))
+	for i, validator := range validators {
+		statuses[i] = ValidatorStatus{
+			Index:                 validator.Index,
+			Pubkey:                strings.ToLower(validator.Validator.Pubkey),
+			Status:                validator.Status,
+			Balance:               validator.Balance,
+			EffectiveBalance:      validator.Validator.EffectiveBalance,
+			WithdrawalCredentials: validator.Validator.WithdrawalCredentials,
+			Slashed:               validator.Validator.Slashed,
+			ActivationEpoch:       validator.Validator.ActivationEpoch,
+			ExitEpoch:             validator.Validator.ExitEpoch,
+		}
+	}
+	return statuses, nil
+}
+
+// Matches returns true if the id is the pubkey or index of the validator
+func (v *ValidatorStatus) Matches(id string) bool {
+	if strings.HasPrefix(id, "0x") {
+		return strings.EqualFold(id, v.Pubkey)
+	}
+	index, errIndex := strconv.ParseUint(id, 10, 64)
+	return errIndex == nil && index == v.Index
+}
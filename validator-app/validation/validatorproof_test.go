@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"crypto/sha256"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	blst "github.com/supranational/blst/bindings/go"
+	"testing"
+)
+
+func TestVerifyValidatorProof(t *testing.T) {
+	mainnet, errNetwork := GetNetwork("mainnet")
+	if errNetwork != nil {
+		t.Fatal(errNetwork)
+	}
+	holesky, errNetwork := GetNetwork("holesky")
+	if errNetwork != nil {
+		t.Fatal(errNetwork)
+	}
+
+	ikm := sha256.Sum256([]byte("validator"))
+	secretKey := blst.KeyGen(ikm[:])
+	pubkey := hexutil.Encode(new(blst.P1Affine).From(secretKey).Compress())
+	challenge := sha256.Sum256([]byte("challenge"))
+	signingRoot := ValidatorProofSigningRoot(mainnet, challenge)
+	signature := hexutil.Encode(new(blst.P2Affine).Sign(secretKey, signingRoot[:], blsSignatureDST).Compress())
+
+	if err := VerifyValidatorProof(mainnet, pubkey, signature, challenge); err != nil {
+		t.Fatalf("expected valid proof, got %v", err)
+	}
+	if err := VerifyValidatorProof(mainnet, pubkey, signature, sha256.Sum256([]byte("other"))); err == nil {
+		t.Error("expected proof for another challenge to be rejected")
+	}
+	// The domain binds proofs to the network
+	if err := VerifyValidatorProof(holesky, pubkey, signature, challenge); err == nil {
+		t.Error("expected proof for another network to be rejected")
+	}
+}
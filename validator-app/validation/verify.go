@@ -0,0 +1,66 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ErrIntegrityCheckFailed = "integrity check failed"
+
+	IntegrityCheckBlockHash        = "block_hash"
+	IntegrityCheckTransactionsRoot = "transactions_root"
+	IntegrityCheckReceiptsRoot     = "receipts_root"
+)
+
+// IntegrityError is returned if data received from the execution backend doesn't match
+// what the beacon block committed to.
+type IntegrityError struct {
+	// Check is the name of the failed check
+	Check string
+	// Expected is the value committed to by the beacon block
+	Expected string
+	// Actual is the value computed from the execution backend's data
+	Actual string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%v: %v mismatch (expected %v, got %v)", ErrIntegrityCheckFailed, e.Check, e.Expected, e.Actual)
+}
+
+// verifyExecutionPayload ensures the execution block, its transactions and receipts are the ones committed to by the
+// beacon block's payload. All hashes are recomputed locally, so a backend can't simply echo the expected values.
+func verifyExecutionPayload(payload *beaconExecutionPayload, block *executionBlock, transactions executionTransactions, receipts executionReceipts) error {
+	blockHash, errHash := block.computeHash()
+	if errHash != nil {
+		return errHash
+	}
+	if !strings.EqualFold(payload.BlockHash, blockHash.Hex()) {
+		return &IntegrityError{
+			Check:    IntegrityCheckBlockHash,
+			Expected: payload.BlockHash,
+			Actual:   blockHash.Hex(),
+		}
+	}
+
+	// The block hash covers the transactions and receipts roots of the header; the data itself must match them as well
+	transactionsRoot := transactions.computeRoot()
+	if block.TransactionsRoot != transactionsRoot {
+		return &IntegrityError{
+			Check:    IntegrityCheckTransactionsRoot,
+			Expected: block.TransactionsRoot.Hex(),
+			Actual:   transactionsRoot.Hex(),
+		}
+	}
+
+	receiptsRoot := receipts.computeRoot()
+	if !strings.EqualFold(payload.ReceiptsRoot, receiptsRoot.Hex()) ||
+		!strings.EqualFold(block.ReceiptsRoot.Hex(), receiptsRoot.Hex()) {
+		return &IntegrityError{
+			Check:    IntegrityCheckReceiptsRoot,
+			Expected: payload.ReceiptsRoot,
+			Actual:   receiptsRoot.Hex(),
+		}
+	}
+	return nil
+}
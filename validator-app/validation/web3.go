@@ -1,9 +1,11 @@
 package validation
 
 import (
+	"errors"
 	"fmt"
-	"github.com/chenzhijie/go-web3"
-	"github.com/spf13/viper"
+	"github.com/chenzhijie/go-web3/rpc"
+	"strings"
+	"time"
 )
 
 const (
@@ -11,27 +13,71 @@ const (
 	ErrSlotInFuture     = "slot is in the future"
 )
 
-var web3client *web3.Web3
+var (
+	// Sentinel errors which allow callers to tell lookup failures apart from backend failures
+	errSlotDoesNotExist = errors.New(ErrSlotDoesNotExist)
+	errSlotInFuture     = errors.New(ErrSlotInFuture)
+)
+
+// IsSlotDoesNotExist returns true if the error was caused by a slot without a block
+func IsSlotDoesNotExist(err error) bool {
+	return errors.Is(err, errSlotDoesNotExist)
+}
+
+// IsSlotInFuture returns true if the error was caused by a slot that has not been reached yet
+func IsSlotInFuture(err error) bool {
+	return errors.Is(err, errSlotInFuture)
+}
+
+// getBackendURL builds the full backend URL of the network
+func getBackendURL(network *Network) string {
+	rpcProviderURL := strings.TrimSuffix(network.BackendEndpoint, "/")
+	// Endpoints are usually configured without scheme
+	if !strings.Contains(rpcProviderURL, "://") {
+		rpcProviderURL = "https://" + rpcProviderURL
+	}
+	if len(network.BackendToken) == 0 {
+		return rpcProviderURL
+	}
+	return fmt.Sprintf("%s/%s", rpcProviderURL, network.BackendToken)
+}
+
+// getRPCBackendClient returns a ready-to-use JSON-RPC client for the network.
+// Blocks and receipts are decoded into local types, since the bundled go-ethereum version doesn't know
+// about post-Cancun transaction types and header fields.
+func getRPCBackendClient(network *Network) (*rpc.Client, error) {
+	if !network.IsConfigured() {
+		return nil, fmt.Errorf("no backend configured for network %v", network.Name)
+	}
 
-// getWeb3BackendClient returns a ready-to-use web3 client based on this application's env vars
-func getWeb3BackendClient() (*web3.Web3, error) {
+	network.clientMtx.Lock()
+	defer network.clientMtx.Unlock()
 	// Return if already initialized
-	if web3client != nil {
-		return web3client, nil
+	if network.rpcClient != nil {
+		return network.rpcClient, nil
 	}
 
 	// Build Endpoint URL
-	rpcProviderURL := viper.GetString("BACKEND_ENDPOINT")
-	rpcProviderToken := viper.GetString("BACKEND_TOKEN")
-	rpcFullURL := fmt.Sprintf("%s/%s", rpcProviderURL, rpcProviderToken)
+	rpcFullURL := getBackendURL(network)
+	if network.BackendUseWebsocket {
+		rpcFullURL = "wss://" + strings.SplitN(rpcFullURL, "://", 2)[1]
+	}
 
 	// Init client
-	client, errInit := web3.NewWeb3(rpcFullURL)
+	client, errInit := rpc.NewClient(rpcFullURL, "")
 	if errInit != nil {
 		return nil, errInit
 	}
 
-	// Set singleton var
-	web3client = client
-	return web3client, nil
+	// Set per network singleton
+	network.rpcClient = client
+	return network.rpcClient, nil
+}
+
+// callRPCBackend calls a JSON-RPC method of the execution backend
+func callRPCBackend(client *rpc.Client, method string, result interface{}, params ...interface{}) error {
+	started := time.Now()
+	errCall := client.Call(method, result, params...)
+	observeBackendCall(BackendExecution, "json-rpc", method, started, errCall)
+	return errCall
 }